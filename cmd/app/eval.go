@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"wfts/configs"
+	"wfts/internal/repository"
+	"wfts/internal/services/evaluation"
+	"wfts/internal/services/wfts/offline/indexer"
+	"wfts/internal/utils/ltr"
+)
+
+func runEval(args []string) { // wfts eval -judgements qrels.tsv [-compare other_config.json]
+	fs := flag.NewFlagSet("eval", flag.ExitOnError)
+	configFile := fs.String("config", "configs/app_config.json", "Path to configuration file")
+	compareFile := fs.String("compare", "", "second configuration to diff against -config")
+	judgementsPath := fs.String("judgements", "", "TSV file with query, url and grade")
+	indexPath := fs.String("index", "", "index directory, overrides index_path of both configs")
+	k := fs.Int("k", 10, "cutoff for NDCG and precision")
+	depth := fs.Int("depth", 100, "number of results fetched per query for recall and MRR")
+	fs.Parse(args)
+	if *judgementsPath == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	j, err := readJudgements(*judgementsPath)
+	if err != nil {
+		panic(err)
+	}
+
+	base := evaluateConfig(*configFile, *indexPath, j, *k, *depth)
+	if *compareFile == "" {
+		base.Write(os.Stdout)
+		return
+	}
+	cand := evaluateConfig(*compareFile, *indexPath, j, *k, *depth)
+	fmt.Printf("base: %s\ncand: %s\n", *configFile, *compareFile)
+	evaluation.WriteDiff(os.Stdout, base, cand)
+}
+
+func evaluateConfig(path, indexPath string, j ltr.Judgements, k, depth int) *evaluation.Report {
+	cfg, err := configs.UploadLocalConfiguration(path)
+	if err != nil {
+		panic(err)
+	}
+	if indexPath != "" {
+		cfg.IndexPath = indexPath
+	}
+
+	ir, err := repository.NewIndexRepository(cfg.IndexPath, io.Discard, cfg.ChunkSize)
+	if err != nil {
+		panic(err)
+	}
+	defer ir.DB.Close() // badger не даст открыть тот же каталог второй конфигурацией, пока не закроем
+
+	report, err := evaluation.Evaluate(newSearcher(io.Discard, indexer.NewIndexer(ir, io.Discard, cfg), ir, cfg), j, k, depth)
+	if err != nil {
+		panic(err)
+	}
+	return report
+}
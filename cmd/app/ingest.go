@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"wfts/configs"
+	"wfts/internal/repository"
+	"wfts/internal/services/wfts/offline/indexer"
+	"wfts/internal/services/wfts/offline/scraper"
+)
+
+func runIndex(args []string) { // wfts index --from-dir ./site [--base-url https://site/] | --from-warc crawl.warc.gz
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	configFile := fs.String("config", "configs/app_config.json", "Path to configuration file")
+	fromDir := fs.String("from-dir", "", "index html, markdown, text and pdf files from a directory instead of crawling")
+	baseURL := fs.String("base-url", "", "url prefix for files from -from-dir, default https://<dir name>/")
+	fromWARC := fs.String("from-warc", "", "index response and resource records from a .warc or .warc.gz file, or every such file in a directory")
+	fs.Parse(args)
+	if (*fromDir == "") == (*fromWARC == "") {
+		fmt.Fprintln(os.Stderr, "exactly one of -from-dir and -from-warc is required")
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := configs.UploadLocalConfiguration(*configFile)
+	if err != nil {
+		panic(err)
+	}
+	out := os.Stdout
+	if cfg.InfoLogPath != "-" {
+		out, err = os.Create(cfg.InfoLogPath)
+		if err != nil {
+			panic(err)
+		}
+	}
+	defer out.Close()
+
+	ir, err := repository.NewIndexRepository(cfg.IndexPath, out, cfg.ChunkSize)
+	if err != nil {
+		panic(err)
+	}
+	defer ir.DB.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	i := indexer.NewIndexer(ir, out, cfg)
+	var stats scraper.IngestStats
+	if *fromDir != "" {
+		stats, err = i.IndexFromDir(cfg, ctx, *fromDir, *baseURL)
+	} else {
+		stats, err = i.IndexFromWARC(cfg, ctx, *fromWARC)
+	}
+	fmt.Printf("%d documents indexed, %d duplicates, %d skipped\n", stats.Indexed, stats.Duplicates, stats.Skipped)
+	if err != nil {
+		panic(err)
+	}
+}
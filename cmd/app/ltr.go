@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"wfts/configs"
+	"wfts/internal/model"
+	"wfts/internal/repository"
+	"wfts/internal/services/wfts/offline/indexer"
+	"wfts/internal/services/wfts/online/searcher"
+	"wfts/internal/utils/ltr"
+)
+
+type searchIndex interface {
+	HandleTextQuery(string) ([]string, []map[[32]byte]model.WordCountAndPositions, string, error)
+	GetAVGLen() (float64, error)
+	PositionSpans(string) [][2]int
+}
+
+func newSearcher(wr io.Writer, i searchIndex, ir *repository.IndexRepository, cfg *configs.ConfigData) *searcher.Searcher {
+	s := searcher.NewSearcher(wr, i, ir, cfg.Ranking)
+	if cfg.Ranking.ModelPath == "" {
+		return s
+	}
+	m, err := ltr.LoadModel(cfg.Ranking.ModelPath)
+	if err != nil {
+		panic(err)
+	}
+	if err := s.SetRanker(m); err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func runFeatures(args []string) { // wfts features -judgements qrels.tsv -out features.letor
+	fs := flag.NewFlagSet("features", flag.ExitOnError)
+	configFile := fs.String("config", "configs/app_config.json", "Path to configuration file")
+	judgementsPath := fs.String("judgements", "", "TSV file with query, url and grade")
+	outPath := fs.String("out", "features.letor", "output file in LETOR/SVMlight format")
+	fs.Parse(args)
+	if *judgementsPath == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := configs.UploadLocalConfiguration(*configFile)
+	if err != nil {
+		panic(err)
+	}
+	j, err := readJudgements(*judgementsPath)
+	if err != nil {
+		panic(err)
+	}
+
+	ir, err := repository.NewIndexRepository(cfg.IndexPath, io.Discard, cfg.ChunkSize)
+	if err != nil {
+		panic(err)
+	}
+	defer ir.DB.Close()
+	s := searcher.NewSearcher(io.Discard, indexer.NewIndexer(ir, io.Discard, cfg), ir, cfg.Ranking)
+
+	out, err := os.Create(*outPath)
+	if err != nil {
+		panic(err)
+	}
+	defer out.Close()
+	w := bufio.NewWriter(out)
+	defer w.Flush()
+
+	queries := j.Queries()
+	slices.Sort(queries)
+	total := 0
+	for qid, query := range queries {
+		n, err := s.LogFeatures(w, qid + 1, query, func(url string) int { return j.Grade(query, url) })
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		total += n
+	}
+	fmt.Printf("Wrote %d samples for %d queries to %s\n", total, len(queries), *outPath)
+}
+
+func runTrain(args []string) { // wfts train -in features.letor -out model.json
+	fs := flag.NewFlagSet("train", flag.ExitOnError)
+	inPath := fs.String("in", "features.letor", "training samples in LETOR/SVMlight format")
+	outPath := fs.String("out", "model.json", "where to save the trained model")
+	opts := ltr.DefaultTrainOptions()
+	fs.IntVar(&opts.Epochs, "epochs", opts.Epochs, "gradient descent epochs")
+	fs.Float64Var(&opts.LearningRate, "lr", opts.LearningRate, "learning rate")
+	fs.Float64Var(&opts.L2, "l2", opts.L2, "L2 regularization")
+	fs.Parse(args)
+
+	in, err := os.Open(*inPath)
+	if err != nil {
+		panic(err)
+	}
+	defer in.Close()
+	samples, err := ltr.ReadSamples(in)
+	if err != nil {
+		panic(err)
+	}
+
+	m, err := ltr.Train(samples, searcher.FeatureNames, opts)
+	if err != nil {
+		panic(err)
+	}
+	if err := m.Save(*outPath); err != nil {
+		panic(err)
+	}
+	fmt.Printf("Trained on %d samples, model saved to %s (set ranking.model_path to use it)\n", len(samples), *outPath)
+	for i, name := range m.Features {
+		fmt.Printf("  %-10s %+.4f\n", name, m.Weights[i])
+	}
+}
+
+func readJudgements(path string) (ltr.Judgements, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ltr.ReadJudgements(f)
+}
@@ -8,23 +8,41 @@ import (
 	"os"
 	"os/signal"
 	"strings"
-	"time"
 
 	"wfts/configs"
-	"wfts/internal/model"
 	"wfts/internal/repository"
+	"wfts/internal/services/api"
 	"wfts/internal/services/tui"
 	"wfts/internal/services/wfts/offline/indexer"
 	"wfts/internal/services/wfts/online/searcher"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
 )
 
+var commands = map[string]func([]string){
+	"features": runFeatures,
+	"train": 	runTrain,
+	"eval": 	runEval,
+	"crawl-status": runCrawlStatus,
+	"index": 	runIndex,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
+	}
+
 	var (
 		configFile = flag.String("config", "configs/app_config.json", "Path to configuration file")
 		indexFlag = flag.Bool("i", false, "disable indexing")
 		interfaceFlag = flag.Bool("gui", false, "use terminal UI")
+		serveAddr = flag.String("serve", "", "serve HTTP JSON search API on given address, e.g. :8080")
+		explainFlag = flag.Bool("explain", false, "print score breakdown for every result")
+		watchFlag = flag.Bool("watch", false, "keep running after the crawl and recrawl pages when they are due")
 	)
 	flag.Parse()
 
@@ -34,7 +52,7 @@ func main() {
 	}
 
 	if *interfaceFlag {
-		initGUI(cfg, *indexFlag)
+		initGUI(cfg, *indexFlag, *watchFlag)
 		return
 	}
 	
@@ -66,8 +84,22 @@ func main() {
 	}()
 
 	i := indexer.NewIndexer(ir, out, cfg)
+	crawl := i.Index
+	if *watchFlag { // без -serve/-gui поиск станет доступен только после остановки по Ctrl+C
+		crawl = i.Watch
+	}
+	if *serveAddr != "" {
+		srv := api.NewServer(*serveAddr, out, newSearcher(out, i, ir, cfg), ir)
+		serve(ctx, srv, func() error {
+			if *indexFlag {
+				return nil
+			}
+			return crawl(cfg, ctx)
+		})
+		return
+	}
 	if !*indexFlag {
-		if err := i.Index(cfg, ctx); err != nil {
+		if err := crawl(cfg, ctx); err != nil {
 			panic(err)
 		}
 	}
@@ -77,38 +109,89 @@ func main() {
 		panic(err)
 	}
 
-	fmt.Printf("Index built with %d documents. Enter search queries (q to exit):\n", count)
+	fmt.Printf("Index built with %d documents. Enter search queries (n/p to page, q to exit):\n", count)
 
-	s := searcher.NewSearcher(out, i, ir)
+	s := newSearcher(out, i, ir, cfg)
 
 	reader := bufio.NewReader(os.Stdin)
+	req := searcher.SearchRequest{Limit: searcher.DefaultLimit}
+	total := 0
 	for {
 		fmt.Print("\n> ")
 		query, _ := reader.ReadString('\n')
 		query = strings.TrimSpace(query)
-		if query == "q" {
+		switch query {
+		case "q":
 			return
+		case "n":
+			if req.Query == "" || req.Offset + req.Limit >= total {
+				fmt.Println("No more results.")
+				continue
+			}
+			req.Offset += req.Limit
+		case "p":
+			if req.Query == "" || req.Offset == 0 {
+				fmt.Println("Already on the first page.")
+				continue
+			}
+			req.Offset = max(req.Offset - req.Limit, 0)
+		default:
+			req.Query, req.Offset = query, 0
 		}
-		t := time.Now()
-		Present(s.Search(query, 100))
-		fmt.Printf("--Search time: %v--\n", time.Since(t))
+		res, err := s.Search(req)
+		if err != nil {
+			fmt.Println("Search failed: " + err.Error())
+			continue
+		}
+		total = res.Total
+		Present(res, req.Offset, *explainFlag)
 	}
 }
 
-func Present(docs []*model.Document) {
-	if len(docs) == 0 {
+func Present(res *searcher.SearchResponse, offset int, explain bool) {
+	if res == nil || len(res.Hits) == 0 {
 		fmt.Println("No results found.")
 		return
 	}
-	
-	fmt.Printf("Found %d results:\n", len(docs))
-	for i, doc := range docs {
-		fmt.Printf("%d. URL: %s\n\n", 
-			i+1, doc.URL)
+
+	if res.CorrectedQuery != "" {
+		fmt.Printf("Showing results for: %s\n", res.CorrectedQuery)
+	}
+	fmt.Printf("Showing %s:\n", searcher.FormatRange(offset, len(res.Hits), res.Total))
+	mark := lipgloss.NewStyle().Bold(true)
+	for i, hit := range res.Hits {
+		title := hit.Document.Title
+		if title == "" {
+			title = hit.Document.URL
+		}
+		fmt.Printf("%d. %s\n   URL: %s\n", offset+i+1, title, hit.Document.URL)
+		if hit.Snippet != nil && hit.Snippet.Text != "" {
+			fmt.Printf("   %s\n", hit.Snippet.Render(func(s string) string { return mark.Render(s) }))
+		}
+		if explain && hit.Explain != nil {
+			fmt.Printf("   %s\n", strings.ReplaceAll(hit.Explain.String(), "\n", "\n   "))
+		}
+		fmt.Println()
 	}
+	fmt.Printf("--Search time: %v--\n", res.Took)
 }
 
-func initGUI(cfg *configs.ConfigData, indexF bool) {
+func serve(ctx context.Context, srv *api.Server, index func() error) {
+	indexed := make(chan struct{})
+	go func() {
+		defer close(indexed)
+		if err := index(); err != nil {
+			panic(err)
+		}
+	}()
+
+	if err := srv.Run(ctx); err != nil {
+		panic(err)
+	}
+	<-indexed // дожидаемся сброса буферов индексатора до закрытия базы
+}
+
+func initGUI(cfg *configs.ConfigData, indexF, watch bool) {
 	lc := tui.NewLogChannel(cfg.LogChannelSize)
 	ir, err := repository.NewIndexRepository(cfg.IndexPath, lc, cfg.ChunkSize)
 	if err != nil {
@@ -127,15 +210,19 @@ func initGUI(cfg *configs.ConfigData, indexF bool) {
 	}()
 
 	i := indexer.NewIndexer(ir, lc, cfg)
+	crawl := i.Index
+	if watch {
+		crawl = i.Watch
+	}
 	if !indexF {
 		go func() {
-			if err := i.Index(cfg, ctx); err != nil {
+			if err := crawl(cfg, ctx); err != nil {
 				panic(err)
 			}
 		}()
 	}
 
-	model := tui.InitModel(lc, cfg.TUIBorderColor, ir.GetDocumentsCount, searcher.NewSearcher(lc, i, ir).Search, c)
+	model := tui.InitModel(lc, cfg.TUIBorderColor, ir.GetDocumentsCount, newSearcher(lc, i, ir, cfg).Search, c)
 	if _, err := tea.NewProgram(model).Run(); err != nil {
 		panic(err)
 	}
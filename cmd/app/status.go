@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"wfts/configs"
+	"wfts/internal/repository"
+)
+
+func runCrawlStatus(args []string) { // wfts crawl-status [-due] [-limit 50]
+	fs := flag.NewFlagSet("crawl-status", flag.ExitOnError)
+	configFile := fs.String("config", "configs/app_config.json", "Path to configuration file")
+	limit := fs.Int("limit", 50, "maximum number of pages to list, 0 for all")
+	dueOnly := fs.Bool("due", false, "list only pages that are due for recrawl")
+	fs.Parse(args)
+
+	cfg, err := configs.UploadLocalConfiguration(*configFile)
+	if err != nil {
+		panic(err)
+	}
+	ir, err := repository.NewIndexRepository(cfg.IndexPath, io.Discard, cfg.ChunkSize)
+	if err != nil {
+		panic(err)
+	}
+	defer ir.DB.Close()
+
+	schedule, err := ir.GetFetchSchedule()
+	if err != nil {
+		panic(err)
+	}
+
+	now := time.Now()
+	due := 0
+	for _, m := range schedule {
+		if !m.NextFetchAt.After(now) {
+			due++
+		}
+	}
+	frontier, err := ir.LoadFrontier()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("%d pages scheduled, %d due now, %d links queued by an interrupted crawl\n\n", len(schedule), due, len(frontier))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NEXT\tINTERVAL\tCHECKS\tCHANGES\tFREQ\tSKIPPED\tURL")
+	shown := 0
+	for _, m := range schedule {
+		if (*dueOnly && m.NextFetchAt.After(now)) || (*limit > 0 && shown >= *limit) {
+			break // расписание отсортировано по времени следующей загрузки
+		}
+		next := "due"
+		if m.NextFetchAt.After(now) {
+			next = "in " + formatInterval(m.NextFetchAt.Sub(now))
+		}
+		freq := m.ChangeFreq
+		if freq == "" {
+			freq = "-"
+		}
+		skipped := m.SkipReason // noindex, nofollow или robots.txt с последней загрузки
+		if skipped == "" {
+			skipped = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\t%s\n", next, formatInterval(m.Interval), m.Checks, m.Changes, freq, skipped, m.URL)
+		shown++
+	}
+	w.Flush()
+	if shown < len(schedule) && !*dueOnly {
+		fmt.Printf("... %d more, use -limit 0 to list all\n", len(schedule) - shown)
+	}
+}
+
+func formatInterval(d time.Duration) string {
+	switch {
+	case d >= 48 * time.Hour:
+		return fmt.Sprintf("%dd", int(d.Hours() / 24))
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+}
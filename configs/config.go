@@ -20,22 +20,113 @@ type ConfigData struct {
 	MaxTypo	  				int      	`json:"max_typo" validate:"min=1,max=4"`
 	ChunkSize 				int 		`json:"chunk_size" validate:"min=20,max=500"`
 	OnlySameDomain 			bool     	`json:"only_same_domain"`
+	RecrawlAfterHours 		int 		`json:"recrawl_after_hours" validate:"min=0,max=8760"` // 0 - посещенные страницы не перекачиваются
+	RecrawlMinHours 		int 		`json:"recrawl_min_hours" validate:"min=1,max=8760"` // границы адаптивного интервала
+	RecrawlMaxHours 		int 		`json:"recrawl_max_hours" validate:"min=1,max=8760"`
+	FrontierCheckpointSeconds int 		`json:"frontier_checkpoint_seconds" validate:"min=0,max=3600"` // как часто очередь обхода сохраняется в базу, 0 - только при остановке
+	WARCDir 				string 		`json:"warc_dir"` // пусто - скачанные ответы не архивируются
+	WARCMaxSizeMB 			int 		`json:"warc_max_size_mb" validate:"min=0,max=65536"` // размер, после которого начинается следующий файл
+	ProductToken 			string 		`json:"product_token"` // имя краулера в User-Agent и в группах robots.txt, только буквы, '_' и '-'
+	RobotsCacheHours 		int 		`json:"robots_cache_hours" validate:"min=0,max=24"` // 0 - сутки
+	HostMaxConnections 		int 		`json:"host_max_connections" validate:"min=0,max=16"` // одновременных запросов к одному хосту, 0 - один
+	HostMinDelayMs 			int 		`json:"host_min_delay_ms" validate:"min=0,max=60000"` // между запросами к одному хосту
+	MaxBackoffSeconds 		int 		`json:"max_backoff_seconds" validate:"min=0,max=3600"` // потолок паузы после 429/503 и между повторами
+	RetryAttempts 			int 		`json:"retry_attempts" validate:"min=0,max=10"` // попыток на запрос вместе с первой, 0 - 3
+	RetryBaseDelayMs 		int 		`json:"retry_base_delay_ms" validate:"min=0,max=60000"` // пауза перед первым повтором, дальше удваивается
+	RetryJitter 			float64 	`json:"retry_jitter" validate:"min=0,max=1"`
+	Ranking 				RankingConfig `json:"ranking" validate:"dive"`
+	Scope 					ScopeConfig `json:"scope"` // шаблоны и ограничения стартовых ссылок проверяются в scraper.NewScope
+}
+
+type ScopeConfig struct {
+	Include 			[]string 	`json:"include"` // glob по всему url или "re:" и регулярное выражение, пусто - любые ссылки
+	Exclude 			[]string 	`json:"exclude"`
+	StripParams 		[]string 	`json:"strip_params"` // glob имен параметров запроса, вырезаются из ссылок
+	Seeds 				[]SeedConfig `json:"seeds"`
+}
+
+type SeedConfig struct { // ограничения обхода от одной стартовой ссылки, ссылка обходится даже если ее нет в base_urls
+	URL 				string 		`json:"url"`
+	Domains 			[]string 	`json:"domains"` // зарегистрированные домены, пусто - любые
+	MaxDepth 			int 		`json:"max_depth"` // 0 - max_depth_crawl
+	MaxPages 			int 		`json:"max_pages"` // 0 - без ограничения
+}
+
+type RankingConfig struct { // score = bm25 + proximity_boost * e^(-proximity_decay * лишнее расстояние) + header_boost + url_boost * ln(1 + совпавших символов в url)
+	BM25K1 				float64 	`json:"bm25_k1" validate:"min=0,max=3"`
+	BM25B 				float64 	`json:"bm25_b" validate:"min=0,max=1"`
+	ProximityBoost 		float64 	`json:"proximity_boost" validate:"min=0,max=10"`
+	ProximityDecay 		float64 	`json:"proximity_decay" validate:"min=0,max=5"`
+	HeaderBoost 		float64 	`json:"header_boost" validate:"min=0,max=10"`
+	URLBoost 			float64 	`json:"url_boost" validate:"min=0,max=10"`
+	ModelPath 			string 		`json:"model_path"` // модель из `wfts train`, переранжирует первые rerank_top_k кандидатов
+	RerankTopK 			int 		`json:"rerank_top_k" validate:"min=1,max=1000"`
+}
+
+func DefaultRanking() RankingConfig {
+	return RankingConfig{
+		BM25K1: 			1.2,
+		BM25B: 				0.75,
+		ProximityBoost: 	1,
+		ProximityDecay: 	0.3,
+		HeaderBoost: 		0.5,
+		URLBoost: 			0.2,
+		RerankTopK: 		100,
+	}
+}
+
+func DefaultConfig() ConfigData { // конфиги, написанные до появления этих полей, тоже проходят проверку
+	return ConfigData{
+		RecrawlMinHours: 			1,
+		RecrawlMaxHours: 			720,
+		FrontierCheckpointSeconds: 	60,
+		Ranking: 					DefaultRanking(),
+	}
 }
 
 func (cfg *ConfigData) Validate() error {
 	return New("validate").Validate(*cfg)
 }
 
+func (r *RankingConfig) Validate() error {
+	return New("validate").Validate(*r)
+}
+
+var crawlFields = []string{ // поля, добавленные после исходной версии, проверяются при загрузке, теги исходных полей - нет
+	"RecrawlAfterHours",
+	"RecrawlMinHours",
+	"RecrawlMaxHours",
+	"FrontierCheckpointSeconds",
+	"WARCMaxSizeMB",
+	"RobotsCacheHours",
+	"HostMaxConnections",
+	"HostMinDelayMs",
+	"MaxBackoffSeconds",
+	"RetryAttempts",
+	"RetryBaseDelayMs",
+	"RetryJitter",
+}
+
+func (cfg *ConfigData) validateCrawl() error {
+	return New("validate").ValidateFields(*cfg, crawlFields...)
+}
+
 func UploadLocalConfiguration(fileName string) (*ConfigData, error) {
 	file, err := os.Open(fileName)
 	if err != nil {
 		return nil, err
 	}
 
-	var cfg ConfigData
+	cfg := DefaultConfig() // отсутствующие в файле поля остаются по умолчанию
 	if err := json.NewDecoder(file).Decode(&cfg); err != nil {
 		return nil, err
 	}
+	if err := cfg.Ranking.Validate(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validateCrawl(); err != nil {
+		return nil, err
+	}
 
 	return &cfg, err
 }
\ No newline at end of file
@@ -0,0 +1,143 @@
+package configs
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRankingValidation(t *testing.T) {
+	tests := []struct {
+		name 		string
+		modify 		func(*RankingConfig)
+		valid 		bool
+	}{
+		{
+			name: "defaults",
+			modify: func(r *RankingConfig) {},
+			valid: true,
+		},
+		{
+			name: "b above one",
+			modify: func(r *RankingConfig) { r.BM25B = 1.5 },
+		},
+		{
+			name: "negative boost",
+			modify: func(r *RankingConfig) { r.HeaderBoost = -0.1 },
+		},
+		{
+			name: "fractional bounds",
+			modify: func(r *RankingConfig) { r.BM25K1, r.ProximityDecay = 0.01, 4.99 },
+			valid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := DefaultRanking()
+			tt.modify(&r)
+			if err := r.Validate(); (err == nil) != tt.valid {
+				t.Errorf("Validate(%+v) = %v, valid %t", r, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestValidateDive(t *testing.T) {
+	type inner struct {
+		Weight float64 `validate:"max=1"`
+	}
+	type outer struct {
+		Inner inner `validate:"dive"`
+	}
+	if err := New("validate").Validate(outer{Inner: inner{Weight: 2}}); err == nil {
+		t.Errorf("expected nested struct to be validated")
+	}
+	if err := New("validate").Validate(outer{Inner: inner{Weight: 0.5}}); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+}
+
+func TestValidateFields(t *testing.T) {
+	type config struct {
+		Workers int `validate:"min=50"`
+		Hours 	int `validate:"min=1"`
+	}
+	if err := New("validate").ValidateFields(config{Workers: 40, Hours: 1}, "Hours"); err != nil {
+		t.Errorf("ValidateFields() = %v, want unlisted field skipped", err)
+	}
+	if err := New("validate").ValidateFields(config{Workers: 50}, "Hours"); err == nil {
+		t.Errorf("expected listed field to be validated")
+	}
+}
+
+func TestUploadLocalConfigurationRankingDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"ranking": {"header_boost": 2}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := UploadLocalConfiguration(path)
+	if err != nil {
+		t.Fatalf("UploadLocalConfiguration(): %v", err)
+	}
+	expected := DefaultRanking()
+	expected.HeaderBoost = 2
+	if cfg.Ranking != expected {
+		t.Errorf("Ranking = %+v, want %+v", cfg.Ranking, expected)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"ranking": {"bm25_b": 3}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UploadLocalConfiguration(path); err == nil {
+		t.Errorf("expected invalid ranking weights to be rejected")
+	}
+}
+
+func TestUploadLocalConfigurationCrawlSettings(t *testing.T) {
+	tests := []struct {
+		name 		string
+		config 		string
+		valid 		bool
+	}{
+		{"missing crawl settings", `{}`, true},
+		{"recrawl disabled", `{"recrawl_after_hours": 0}`, true},
+		{"negative recrawl", `{"recrawl_after_hours": -1}`, false},
+		{"baseline fields are not checked", `{"worker_count": 40}`, true},
+		{"recrawl bounds", `{"recrawl_min_hours": 2, "recrawl_max_hours": 48}`, true},
+		{"zero recrawl bound", `{"recrawl_min_hours": 0}`, false},
+		{"recrawl bound above a year", `{"recrawl_max_hours": 9000}`, false},
+		{"frontier saved only on stop", `{"frontier_checkpoint_seconds": 0}`, true},
+		{"negative checkpoint", `{"frontier_checkpoint_seconds": -5}`, false},
+		{"warc size too large", `{"warc_max_size_mb": 70000}`, false},
+		{"robots.txt cached over a day", `{"robots_cache_hours": 48}`, false},
+		{"too many host connections", `{"host_max_connections": 100}`, false},
+		{"negative host delay", `{"host_min_delay_ms": -1}`, false},
+		{"retry settings in range", `{"retry_attempts": 5, "retry_jitter": 0.5}`, true},
+		{"jitter above one", `{"retry_jitter": 1.5}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(path, []byte(tt.config), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := UploadLocalConfiguration(path); (err == nil) != tt.valid {
+				t.Errorf("UploadLocalConfiguration(%s) = %v, valid %t", tt.config, err, tt.valid)
+			}
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := UploadLocalConfiguration(path)
+	if err != nil {
+		t.Fatalf("UploadLocalConfiguration(): %v", err)
+	}
+	if expected := DefaultConfig(); !reflect.DeepEqual(*cfg, expected) {
+		t.Errorf("config without crawl settings = %+v, want defaults %+v", *cfg, expected)
+	}
+}
@@ -3,6 +3,7 @@ package configs
 import (
 	"errors"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -16,11 +17,21 @@ func New(key string) *validator {
 }
 
 func (v *validator) Validate(i any) error {
+	return v.validate(i, nil)
+}
+
+func (v *validator) ValidateFields(i any, names ...string) error { // теги остальных полей не проверяются
+	return v.validate(i, names)
+}
+
+func (v *validator) validate(i any, only []string) error {
 	fields := make([]reflect.StructField, 0)
 	val := reflect.TypeOf(i)
 
 	for i := range val.NumField() {
-		fields = append(fields, val.Field(i))
+		if only == nil || slices.Contains(only, val.Field(i).Name) {
+			fields = append(fields, val.Field(i))
+		}
 	}
 
 	for _, field := range fields {
@@ -42,7 +53,23 @@ func (v *validator) Validate(i any) error {
 					return errors.New("required field is empty: " + field.Name)
 				}
 
+			case "dive":
+				if f.Kind() == reflect.Struct {
+					if err := v.Validate(f.Interface()); err != nil {
+						return err
+					}
+				}
+
 			case "min":
+				if f.Kind() == reflect.Float64 {
+					border, err := strconv.ParseFloat(entity[1], 64)
+					if err != nil {
+						return err
+					}
+					if f.Float() < border {
+						return errors.New("field " + field.Name + " less than min")
+					}
+				}
 				if f.Kind() == reflect.Int {
 					border, err := strconv.ParseInt(entity[1], 10, 64)
 					if err != nil {
@@ -54,6 +81,15 @@ func (v *validator) Validate(i any) error {
 				}
 
 			case "max":
+				if f.Kind() == reflect.Float64 {
+					border, err := strconv.ParseFloat(entity[1], 64)
+					if err != nil {
+						return err
+					}
+					if f.Float() > border {
+						return errors.New("field " + field.Name + " greater than max")
+					}
+				}
 				if f.Kind() == reflect.Int {
 					border, err := strconv.ParseInt(entity[1], 10, 64)
 					if err != nil {
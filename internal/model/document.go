@@ -1,14 +1,22 @@
 package model
 
+import "time"
+
 type Document struct {
-	Id 				[32]byte	`json:"id"`
-	URL				string		`json:"url"`
-	TokenCount 		int			`json:"words_count"`
+	Id 				[32]byte			`json:"id"`
+	URL				string				`json:"url"`
+	TokenCount 		int					`json:"words_count"`
+	Title 			string				`json:"title"`
+	Description 	string				`json:"description"`
+	OpenGraph 		map[string]string 	`json:"open_graph,omitempty"`
+	Text 			string				`json:"-"` // хранится отдельным ключом, GetDocumentByID его не поднимает
+	Aliases 		[]string 			`json:"aliases,omitempty"` // другие адреса той же страницы: редиректы, трекинговые параметры, не канонический url
 }
 
 const (
 	BodyType = 'b'
 	HeaderType = 'h'
+	TitleType = 't'
 )
 
 type Passage struct {
@@ -28,7 +36,7 @@ type Position struct {
 
 func NewTypeTextObj[T Passage | Position](t byte, text string, i int) T {
 	switch t {
-	case BodyType, HeaderType:
+	case BodyType, HeaderType, TitleType:
 
 	default:
 		panic("unnamed passage type")
@@ -47,7 +55,36 @@ func NewTypeTextObj[T Passage | Position](t byte, text string, i int) T {
 }
 
 type CrawlNode struct {
-	Activation 	func()
+	Activation 	func() // собирается скрапером из полей ниже, в badger сохраняются только данные
+	URL 		string
 	Depth 		int
 	SameDomain 	bool
-}
\ No newline at end of file
+	Priority 	int // при равной глубине больший приоритет забирается раньше
+	Seed 		string // стартовая ссылка, от которой идет задача, по ней выбираются правила области обхода
+}
+
+type DocumentTerms struct { // что документ добавил в индекс, нужно чтобы удалить его без полного перебора ключей
+	Stems 		[]string
+	Bigrams 	map[[2]uint64]int
+	Signature 	*[128]uint64 // nil если текст был слишком коротким для minHash
+}
+
+type FetchMeta struct { // условный GET при повторном обходе и проверка что страница действительно изменилась
+	ETag 			string
+	LastModified 	string
+	FetchedAt 		time.Time
+	ContentHash 	[32]byte
+	ContentType 	string
+
+	URL 			string // расписание повторного обхода
+	Depth 			int
+	Interval 		time.Duration
+	NextFetchAt 	time.Time
+	Checks 			int
+	Changes 		int
+	ChangeFreq 		string // подсказка <changefreq> из sitemap
+	Redirects 		[]string // цепочка от запрошенного url до итогового, пусто - без редиректов
+	DocID 			[32]byte // под каким id лежит документ после редиректов и rel=canonical, нулевой - не индексировался
+	RobotsTag 		[]string // строки X-Robots-Tag ответа, в базу не сохраняются
+	SkipReason 		string // почему страница не проиндексирована или ее ссылки не обходятся, через запятую
+}
@@ -0,0 +1,267 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"wfts/internal/model"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+const (
+	DocumentTermsKeyFormat = "fwd:%s"
+	TombstoneKeyFormat     = "tomb:%s"
+)
+
+type termsDBSt struct {
+	Stems 		[]string 	`json:"stems"`
+	Bigrams 	[][3]uint64 `json:"bigrams,omitempty"` // левый хеш, правый хеш, частота
+	Signature 	[]uint64 	`json:"sig,omitempty"`
+}
+
+func (ir *IndexRepository) SaveDocumentTerms(docID [32]byte, terms *model.DocumentTerms) error {
+	p := termsDBSt{Stems: terms.Stems}
+	for lr, freq := range terms.Bigrams {
+		p.Bigrams = append(p.Bigrams, [3]uint64{lr[0], lr[1], uint64(freq)})
+	}
+	if terms.Signature != nil {
+		p.Signature = terms.Signature[:]
+	}
+	val, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return ir.DB.Update(func(txn *badger.Txn) error {
+		return txn.Set(fmt.Appendf(nil, DocumentTermsKeyFormat, docID[:]), val)
+	})
+}
+
+func (ir *IndexRepository) GetDocumentTerms(docID [32]byte) (*model.DocumentTerms, error) {
+	var p *termsDBSt
+	if err := ir.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(fmt.Appendf(nil, DocumentTermsKeyFormat, docID[:]))
+		if err != nil {
+			if err == badger.ErrKeyNotFound { // документ проиндексирован до появления прямого индекса
+				return nil
+			}
+			return err
+		}
+		p = &termsDBSt{}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, p)
+		})
+	}); err != nil || p == nil {
+		return nil, err
+	}
+
+	terms := &model.DocumentTerms{Stems: p.Stems, Bigrams: make(map[[2]uint64]int, len(p.Bigrams))}
+	for _, b := range p.Bigrams {
+		terms.Bigrams[[2]uint64{b[0], b[1]}] = int(b[2])
+	}
+	if len(p.Signature) == 128 {
+		sign := [128]uint64{}
+		copy(sign[:], p.Signature)
+		terms.Signature = &sign
+	}
+	return terms, nil
+}
+
+func (ir *IndexRepository) GetDeletedDocuments() (map[[32]byte]struct{}, error) { // все надгробия одним проходом, поиск читает их раз на запрос
+	deleted := make(map[[32]byte]struct{})
+	return deleted, ir.DB.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		prefix := []byte("tomb:")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			id := [32]byte{}
+			copy(id[:], it.Item().Key()[len(prefix):])
+			deleted[id] = struct{}{}
+		}
+		return nil
+	})
+}
+
+func (ir *IndexRepository) IsDeleted(docID [32]byte) bool {
+	return ir.DB.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(fmt.Appendf(nil, TombstoneKeyFormat, docID[:]))
+		return err
+	}) == nil
+}
+
+func (ir *IndexRepository) DeleteDocument(docID [32]byte) error {
+	doc, err := ir.GetDocumentByID(docID)
+	if err != nil {
+		return err
+	}
+	// сначала надгробие: поиск, успевший достать постинги, пропустит документ пока чистится индекс
+	if err := ir.DB.Update(func(txn *badger.Txn) error {
+		return txn.Set(fmt.Appendf(nil, TombstoneKeyFormat, docID[:]), nil)
+	}); err != nil {
+		return err
+	}
+
+	terms, err := ir.GetDocumentTerms(docID)
+	if err != nil {
+		return err
+	}
+	if terms == nil {
+		ir.log.Warn(fmt.Sprintf("no terms record for %s, bigram counts and minhash signature are left as is", doc.URL))
+		terms = &model.DocumentTerms{}
+		if terms.Stems, err = ir.scanDocumentStems(docID); err != nil {
+			return err
+		}
+	}
+
+	wb := ir.DB.NewWriteBatch()
+	defer wb.Cancel()
+	for _, stem := range terms.Stems {
+		if err := wb.Delete(fmt.Appendf(nil, WordDocumentKeyFormat, stem, docID)); err != nil {
+			return err
+		}
+	}
+	if err := wb.Flush(); err != nil {
+		return err
+	}
+	if err := ir.addBiFreq(terms.Bigrams, -1); err != nil {
+		return err
+	}
+	if terms.Signature != nil {
+		if err := ir.removeSignature(*terms.Signature); err != nil {
+			return err
+		}
+	}
+
+	requested, err := ir.requestedAs(docID)
+	if err != nil {
+		return err
+	}
+
+	return ir.DB.Update(func(txn *badger.Txn) error {
+		keys := [][]byte{
+			fmt.Appendf(nil, DocumentKeyPrefix, docID[:]),
+			fmt.Appendf(nil, DocumentTextKeyFormat, docID[:]),
+			fmt.Appendf(nil, DocumentTermsKeyFormat, docID[:]),
+			fmt.Appendf(nil, urlsKey, docID),
+			fmt.Appendf(nil, FetchMetaKeyFormat, docID[:]),
+			fmt.Appendf(nil, TombstoneKeyFormat, docID[:]), // записи документа уже нет, прерванная очистка оставила бы надгробие
+		}
+		if host := reversedHost(doc.URL); host != "" {
+			keys = append(keys, fmt.Appendf(nil, HostDocumentKeyFormat, host, docID))
+		}
+		for _, hash := range requested { // иначе расписание так и будет перекачивать удаленную страницу
+			keys = append(keys, fmt.Appendf(nil, urlsKey, hash), fmt.Appendf(nil, FetchMetaKeyFormat, hash[:]))
+		}
+		for _, key := range keys {
+			if err := txn.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (ir *IndexRepository) requestedAs(docID [32]byte) ([][32]byte, error) { // хеши адресов, скачанных в этот документ: редиректы и не канонические url
+	hashes := [][32]byte{}
+	return hashes, ir.DB.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		prefix := []byte("fetch:")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			p := fetchDBSt{}
+			if err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &p)
+			}); err != nil {
+				return err
+			}
+			if bytes.Equal(p.DocID, docID[:]) {
+				hash := [32]byte{}
+				copy(hash[:], it.Item().Key()[len(prefix):])
+				hashes = append(hashes, hash)
+			}
+		}
+		return nil
+	})
+}
+
+func (ir *IndexRepository) scanDocumentStems(docID [32]byte) ([]string, error) { // полный перебор постингов, только для старых записей
+	suffix := []byte("_" + hex.EncodeToString(docID[:]))
+	stems := []string{}
+	return stems, ir.DB.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		prefix := []byte("ri:")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			key := it.Item().Key()
+			if bytes.HasSuffix(key, suffix) {
+				stems = append(stems, string(key[len(prefix):len(key) - len(suffix)]))
+			}
+		}
+		return nil
+	})
+}
+
+func (ir *IndexRepository) removeSignature(signature [128]uint64) error {
+	for i := 0; i <= 128 - 4; i += 4 {
+		var lshKey [4]uint64
+		copy(lshKey[:], signature[i: i + 4])
+		ir.mu.Lock()
+		ir.shingleIndexer.buffer[lshKey] = slices.DeleteFunc(ir.shingleIndexer.buffer[lshKey], func(s [128]uint64) bool {
+			return s == signature
+		})
+		ir.mu.Unlock()
+
+		strs := [4]string{}
+		for i := range 4 {
+			strs[i] = strconv.FormatUint(lshKey[i], 10)
+		}
+		prefix := []byte("shingle:" + strings.Join(strs[:], ".") + ":")
+		if err := ir.DB.Update(func(txn *badger.Txn) error {
+			changed := map[string][][128]uint64{}
+			it := txn.NewIterator(badger.DefaultIteratorOptions)
+			for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+				item := it.Item()
+				var signatures [][128]uint64
+				if err := item.Value(func(val []byte) error {
+					return json.Unmarshal(val, &signatures)
+				}); err != nil {
+					it.Close()
+					return err
+				}
+				if kept := slices.DeleteFunc(signatures, func(s [128]uint64) bool { return s == signature }); len(kept) != len(signatures) {
+					changed[string(item.KeyCopy(nil))] = kept
+				}
+			}
+			it.Close() // писать в транзакцию можно только после закрытия итератора
+
+			for key, kept := range changed {
+				if len(kept) == 0 {
+					if err := txn.Delete([]byte(key)); err != nil {
+						return err
+					}
+					continue
+				}
+				val, err := json.Marshal(kept)
+				if err != nil {
+					return err
+				}
+				if err := txn.Set([]byte(key), val); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
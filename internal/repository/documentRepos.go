@@ -1,10 +1,13 @@
 package repository
 
 import (
+	"bytes"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-
+	"net/url"
 	"slices"
+	"strings"
 
 	"wfts/internal/model"
 	"github.com/dgraph-io/badger/v3"
@@ -13,19 +16,33 @@ import (
 const (
 	DocumentKeyPrefix     = "doc:%s"
 	WordDocumentKeyFormat = "ri:%s_%x"
+	HostDocumentKeyFormat = "host:%s/%x"
+	DocumentTextKeyFormat = "text:%s"
 )
 
+const docRecordVersion = 1
+
 type docDBSt struct {
-	Id        []byte      `json:"id"`
-	URL       string      `json:"url"`
-	TokenCount int        `json:"words_count"`
+	Id        	[]byte      		`json:"id"`
+	URL       	string      		`json:"url"`
+	TokenCount 	int        			`json:"words_count"`
+	Version 	int 				`json:"v,omitempty"` // 0 у записей, сохраненных до появления заголовков и описаний
+	Title 		string 				`json:"title,omitempty"`
+	Description string 				`json:"description,omitempty"`
+	OpenGraph 	map[string]string 	`json:"og,omitempty"`
+	Aliases 	[]string 			`json:"aliases,omitempty"`
 }
 
 func (ir *IndexRepository) documentToBytes(doc *model.Document) ([]byte, error) {
 	p := docDBSt{
-		Id:        doc.Id[:],
-		URL:       doc.URL,
-		TokenCount:doc.TokenCount,
+		Id:        	doc.Id[:],
+		URL:       	doc.URL,
+		TokenCount:	doc.TokenCount,
+		Version: 	docRecordVersion,
+		Title: 		doc.Title,
+		Description:doc.Description,
+		OpenGraph: 	doc.OpenGraph,
+		Aliases: 	doc.Aliases,
 	}
 	return json.Marshal(p)
 }
@@ -45,9 +62,13 @@ func (ir *IndexRepository) bytesToDocument(body []byte) (*model.Document, error)
 	copy(idArr[:], p.Id)
 	
 	return &model.Document{
-		Id:        idArr,
-		URL:       p.URL,
-		TokenCount:p.TokenCount,
+		Id:        	idArr,
+		URL:       	p.URL,
+		TokenCount:	p.TokenCount,
+		Title: 		p.Title,
+		Description:p.Description,
+		OpenGraph: 	p.OpenGraph,
+		Aliases: 	p.Aliases,
 	}, nil
 }
 
@@ -63,10 +84,83 @@ func (ir *IndexRepository) SaveDocument(doc *model.Document) error {
 		if err := txn.Set(fmt.Appendf(nil, DocumentKeyPrefix, doc.Id[:]), docBytes); err != nil {
 			return err
 		}
+		if err := txn.Delete(fmt.Appendf(nil, TombstoneKeyFormat, doc.Id[:])); err != nil { // страница снова появилась после удаления
+			return err
+		}
+		if doc.Text != "" {
+			if err := txn.Set(fmt.Appendf(nil, DocumentTextKeyFormat, doc.Id[:]), []byte(doc.Text)); err != nil {
+				return err
+			}
+		}
+		if host := reversedHost(doc.URL); host != "" {
+			return txn.Set(fmt.Appendf(nil, HostDocumentKeyFormat, host, doc.Id), nil)
+		}
 		return nil
 	})
 }
 
+func (ir *IndexRepository) GetDocumentText(docID [32]byte) (string, error) {
+	var text string
+	return text, ir.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(fmt.Appendf(nil, DocumentTextKeyFormat, docID[:]))
+		if err != nil {
+			if err == badger.ErrKeyNotFound { // документ проиндексирован до сохранения текста
+				return nil
+			}
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			text = string(val)
+			return nil
+		})
+	})
+}
+
+func (ir *IndexRepository) GetDocumentsByHost(host string) ([][32]byte, error) {
+	rev := reverseHostLabels(host)
+	if rev == "" {
+		return nil, nil
+	}
+	ids := [][32]byte{}
+	return ids, ir.DB.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for _, prefix := range [][]byte{fmt.Appendf(nil, "host:%s/", rev), fmt.Appendf(nil, "host:%s.", rev)} { // сам хост и его поддомены
+			for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+				key := it.Item().Key()
+				decoded, err := hex.DecodeString(string(key[bytes.LastIndexByte(key, '/') + 1:]))
+				if err != nil {
+					return err
+				}
+				id := [32]byte{}
+				copy(id[:], decoded)
+				ids = append(ids, id)
+			}
+		}
+		return nil
+	})
+}
+
+func reversedHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return reverseHostLabels(u.Hostname())
+}
+
+func reverseHostLabels(host string) string { // developer.mozilla.org -> org.mozilla.developer, чтобы поддомены искались по префиксу
+	host = strings.TrimPrefix(strings.Trim(strings.ToLower(host), "."), "www.")
+	if host == "" {
+		return ""
+	}
+	labels := strings.Split(host, ".")
+	slices.Reverse(labels)
+	return strings.Join(labels, ".")
+}
+
 func (ir *IndexRepository) GetDocumentByID(docID [32]byte) (*model.Document, error) {
 	ir.mu.Lock()
 	defer ir.mu.Unlock()
@@ -102,7 +196,8 @@ func (ir *IndexRepository) GetAllDocuments() ([]*model.Document, error) {
 		it := txn.NewIterator(opts)
 		defer it.Close()
 
-		for it.Seek([]byte(DocumentKeyPrefix)); it.ValidForPrefix([]byte(DocumentKeyPrefix)); it.Next() {
+		prefix := []byte("doc:") // DocumentKeyPrefix это формат, а не префикс
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
 			item := it.Item()
 			var docBytes []byte
 
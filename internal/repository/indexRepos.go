@@ -42,6 +42,9 @@ func NewIndexRepository(path string, wr io.Writer, chunkSize int) (*IndexReposit
 		shingleIndexer: &shingleChunkData{buffer: make(map[[4]uint64][][128]uint64), counts: make(map[[4]uint64]int)},
 		chunkSize: chunkSize,
 	}
+	if err := ir.migrate(); err != nil {
+		return nil, err
+	}
 	return ir, ir.UpdateChunkingCounts() // сомнительно потому что нам не нужно это прокидывать если мы не будем индексировать
 }
 
@@ -168,7 +171,12 @@ func (ir *IndexRepository) GetDocumentsByWord(word string) (map[[32]byte]model.W
 const biK = "big:%d:%d"
 
 func (ir *IndexRepository) UpdateBiFreq(biS map[[2]uint64]int) error {
+	return ir.addBiFreq(biS, 1)
+}
+
+func (ir *IndexRepository) addBiFreq(biS map[[2]uint64]int, sign int) error { // sign -1 при удалении документа
 	for lr, freq := range biS {
+		freq *= sign
 		if err := ir.DB.Update(func(txn *badger.Txn) error {
 			key := fmt.Appendf(nil, biK, lr[0], lr[1])
 			item, err := txn.Get(key)
@@ -182,6 +190,9 @@ func (ir *IndexRepository) UpdateBiFreq(biS map[[2]uint64]int) error {
 				}
 				freq += decCount(val)
 			}
+			if freq <= 0 {
+				return txn.Delete(key)
+			}
 			return txn.Set(key, encCount(freq))
 		}); err != nil {
 			return err
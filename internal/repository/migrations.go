@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+const schemaVersionKey = "meta:schema"
+
+var migrations = []func(*IndexRepository) error{ // индекс в срезе это версия схемы, с которой мигрируем
+	(*IndexRepository).indexDocumentHosts,
+	(*IndexRepository).upgradeDocumentRecords,
+}
+
+func (ir *IndexRepository) migrate() error {
+	version := 0
+	if err := ir.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(schemaVersionKey))
+		if err != nil {
+			if err == badger.ErrKeyNotFound {
+				return nil
+			}
+			return err
+		}
+		val, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		version = decCount(val)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for ; version < len(migrations); version++ {
+		if err := migrations[version](ir); err != nil {
+			return fmt.Errorf("migration to schema %d failed: %w", version + 1, err)
+		}
+		if err := ir.DB.Update(func(txn *badger.Txn) error {
+			return txn.Set([]byte(schemaVersionKey), encCount(version + 1))
+		}); err != nil {
+			return err
+		}
+		ir.log.Info(fmt.Sprintf("index migrated to schema %d", version + 1))
+	}
+	return nil
+}
+
+func (ir *IndexRepository) indexDocumentHosts() error {
+	docs, err := ir.GetAllDocuments()
+	if err != nil {
+		return err
+	}
+	wb := ir.DB.NewWriteBatch()
+	defer wb.Cancel()
+	for _, doc := range docs {
+		if host := reversedHost(doc.URL); host != "" {
+			if err := wb.Set(fmt.Appendf(nil, HostDocumentKeyFormat, host, doc.Id), nil); err != nil {
+				return err
+			}
+		}
+	}
+	return wb.Flush()
+}
+
+func (ir *IndexRepository) upgradeDocumentRecords() error { // старые записи без заголовка переписываются в текущем формате, фронтенды показывают вместо заголовка URL
+	docs, err := ir.GetAllDocuments()
+	if err != nil {
+		return err
+	}
+	wb := ir.DB.NewWriteBatch()
+	defer wb.Cancel()
+	for _, doc := range docs {
+		docBytes, err := ir.documentToBytes(doc)
+		if err != nil {
+			return err
+		}
+		if err := wb.Set(fmt.Appendf(nil, DocumentKeyPrefix, doc.Id[:]), docBytes); err != nil {
+			return err
+		}
+	}
+	return wb.Flush()
+}
@@ -0,0 +1,358 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"wfts/internal/model"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+func TestDocumentRoundTrip(t *testing.T) {
+	ir, err := NewIndexRepository(t.TempDir(), io.Discard, 20)
+	if err != nil {
+		t.Fatalf("NewIndexRepository(): %v", err)
+	}
+	defer ir.DB.Close()
+
+	doc := &model.Document{
+		Id: 			sha256.Sum256([]byte("https://developer.mozilla.org/en-US/docs")),
+		URL: 			"https://developer.mozilla.org/en-US/docs",
+		TokenCount: 	3,
+		Title: 			"MDN Web Docs",
+		Description: 	"Resources for developers",
+		OpenGraph: 		map[string]string{"og:site_name": "MDN"},
+		Text: 			"MDN Web Docs\nResources for developers\n",
+		Aliases: 		[]string{"https://developer.mozilla.org/docs?utm_source=x"},
+	}
+	if err := ir.SaveDocument(doc); err != nil {
+		t.Fatalf("SaveDocument(): %v", err)
+	}
+
+	got, err := ir.GetDocumentByID(doc.Id)
+	if err != nil {
+		t.Fatalf("GetDocumentByID(): %v", err)
+	}
+	if got.Title != doc.Title || got.Description != doc.Description || got.OpenGraph["og:site_name"] != "MDN" || !reflect.DeepEqual(got.Aliases, doc.Aliases) {
+		t.Errorf("GetDocumentByID() = %+v, want %+v", got, doc)
+	}
+	if got.Text != "" {
+		t.Errorf("GetDocumentByID() loaded text, expected it to be stored separately")
+	}
+	text, err := ir.GetDocumentText(doc.Id)
+	if err != nil || text != doc.Text {
+		t.Errorf("GetDocumentText() = %q, %v; want %q", text, err, doc.Text)
+	}
+
+	for _, host := range []string{"developer.mozilla.org", "mozilla.org", "www.developer.mozilla.org"} {
+		ids, err := ir.GetDocumentsByHost(host)
+		if err != nil || len(ids) != 1 || ids[0] != doc.Id {
+			t.Errorf("GetDocumentsByHost(%q) = %v, %v; want [%x]", host, ids, err, doc.Id)
+		}
+	}
+	if ids, _ := ir.GetDocumentsByHost("zilla.org"); len(ids) != 0 {
+		t.Errorf("GetDocumentsByHost(zilla.org) matched a different domain: %v", ids)
+	}
+}
+
+func TestLegacyDocumentMigration(t *testing.T) {
+	dir := t.TempDir()
+	ir, err := NewIndexRepository(dir, io.Discard, 20)
+	if err != nil {
+		t.Fatalf("NewIndexRepository(): %v", err)
+	}
+
+	id := sha256.Sum256([]byte("jmlr.org/papers"))
+	legacy := fmt.Appendf(nil, `{"id":%s,"url":"https://jmlr.org/papers","words_count":7}`, mustJSON(t, id[:]))
+	if err := ir.DB.Update(func(txn *badger.Txn) error {
+		if err := txn.Set(fmt.Appendf(nil, DocumentKeyPrefix, id[:]), legacy); err != nil {
+			return err
+		}
+		return txn.Set([]byte(schemaVersionKey), encCount(0)) // база в состоянии до всех миграций
+	}); err != nil {
+		t.Fatalf("writing legacy record: %v", err)
+	}
+	ir.DB.Close()
+
+	ir, err = NewIndexRepository(dir, io.Discard, 20)
+	if err != nil {
+		t.Fatalf("reopening repository: %v", err)
+	}
+	defer ir.DB.Close()
+
+	doc, err := ir.GetDocumentByID(id)
+	if err != nil {
+		t.Fatalf("GetDocumentByID(): %v", err)
+	}
+	if doc.URL != "https://jmlr.org/papers" || doc.TokenCount != 7 || doc.Title != "" {
+		t.Errorf("migrated document = %+v", doc)
+	}
+	if ids, err := ir.GetDocumentsByHost("jmlr.org"); err != nil || len(ids) != 1 {
+		t.Errorf("legacy document missing from host index: %v, %v", ids, err)
+	}
+
+	var record docDBSt
+	if err := ir.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(fmt.Appendf(nil, DocumentKeyPrefix, id[:]))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &record)
+		})
+	}); err != nil {
+		t.Fatalf("reading record: %v", err)
+	}
+	if record.Version != docRecordVersion {
+		t.Errorf("record version = %d, want %d", record.Version, docRecordVersion)
+	}
+}
+
+func mustJSON(t *testing.T, v any) []byte {
+	out, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("json.Marshal(): %v", err)
+	}
+	return out
+}
+
+func TestDeleteDocument(t *testing.T) {
+	ir, err := NewIndexRepository(t.TempDir(), io.Discard, 20)
+	if err != nil {
+		t.Fatalf("NewIndexRepository(): %v", err)
+	}
+	defer ir.DB.Close()
+
+	var sigA, sigB [128]uint64
+	for i := range 128 {
+		sigA[i], sigB[i] = uint64(i + 1), uint64(i + 1000)
+	}
+	copy(sigB[:4], sigA[:4]) // общая корзина LSH
+	docs := []struct {
+		url 	string
+		stems 	[]string
+		sign 	*[128]uint64
+		bigrams map[[2]uint64]int
+	}{
+		{"https://go.dev/doc", []string{"go", "compil"}, &sigA, map[[2]uint64]int{{1, 2}: 1, {2, 3}: 2}},
+		{"https://go.dev/blog", []string{"go", "blog"}, &sigB, map[[2]uint64]int{{1, 2}: 1}},
+		{"https://legacy.org", []string{"go", "old"}, nil, nil}, // проиндексирован без прямого индекса
+	}
+	ids := make([][32]byte, len(docs))
+	for i, d := range docs {
+		ids[i] = sha256.Sum256([]byte(d.url))
+		if err := ir.SaveDocument(&model.Document{Id: ids[i], URL: d.url, TokenCount: 2, Text: d.url}); err != nil {
+			t.Fatalf("SaveDocument(): %v", err)
+		}
+		seq, pos := map[string]int{}, map[string][]model.Position{}
+		for j, s := range d.stems {
+			seq[s] = 1
+			pos[s] = []model.Position{{I: j, Type: model.BodyType}}
+		}
+		if err := ir.IndexDocumentWords(ids[i], seq, pos); err != nil {
+			t.Fatalf("IndexDocumentWords(): %v", err)
+		}
+		if d.sign == nil {
+			continue
+		}
+		if err := ir.IndexDocShingles(*d.sign); err != nil {
+			t.Fatalf("IndexDocShingles(): %v", err)
+		}
+		if err := ir.UpdateBiFreq(d.bigrams); err != nil {
+			t.Fatalf("UpdateBiFreq(): %v", err)
+		}
+		if err := ir.SaveDocumentTerms(ids[i], &model.DocumentTerms{Stems: d.stems, Bigrams: d.bigrams, Signature: d.sign}); err != nil {
+			t.Fatalf("SaveDocumentTerms(): %v", err)
+		}
+	}
+	ir.FlushAll() // подписи и на диске, и в буфере
+
+	redirected, other := sha256.Sum256([]byte("go.dev/doc/")), sha256.Sum256([]byte("go.dev/blog/"))
+	for key, docID := range map[[32]byte][32]byte{redirected: ids[0], other: ids[1]} { // адреса, приведшие к документам
+		if err := ir.SaveFetchMeta(key, &model.FetchMeta{DocID: docID}); err != nil {
+			t.Fatalf("SaveFetchMeta(): %v", err)
+		}
+		if err := ir.IndexUrlsByHash(key, []byte("links")); err != nil {
+			t.Fatalf("IndexUrlsByHash(): %v", err)
+		}
+	}
+
+	for _, id := range [][32]byte{ids[0], ids[2]} {
+		if err := ir.DeleteDocument(id); err != nil {
+			t.Fatalf("DeleteDocument(): %v", err)
+		}
+	}
+
+	if postings, _ := ir.GetDocumentsByWord("go"); len(postings) != 1 || postings[ids[1]].Count != 1 {
+		t.Errorf("postings for shared stem = %v, want only the surviving document", postings)
+	}
+	for _, stem := range []string{"compil", "old"} {
+		if postings, _ := ir.GetDocumentsByWord(stem); len(postings) != 0 {
+			t.Errorf("postings for %q survived deletion: %v", stem, postings)
+		}
+	}
+	if f, _ := ir.GetFreq(1, 2); f != 1 {
+		t.Errorf("shared bigram count = %d, want 1", f)
+	}
+	if f, _ := ir.GetFreq(2, 3); f != 0 {
+		t.Errorf("removed bigram count = %d, want 0", f)
+	}
+	similar, err := ir.GetSimilarSignatures(sigA)
+	if err != nil {
+		t.Fatalf("GetSimilarSignatures(): %v", err)
+	}
+	if len(similar) != 1 || similar[0] != sigB {
+		t.Errorf("GetSimilarSignatures() returned %d signatures, want only the surviving one", len(similar))
+	}
+
+	if _, err := ir.GetDocumentByID(ids[0]); err == nil {
+		t.Errorf("deleted document is still stored")
+	}
+	if text, _ := ir.GetDocumentText(ids[0]); text != "" {
+		t.Errorf("deleted document text is still stored: %q", text)
+	}
+	if hosts, _ := ir.GetDocumentsByHost("go.dev"); len(hosts) != 1 || hosts[0] != ids[1] {
+		t.Errorf("GetDocumentsByHost(go.dev) = %x", hosts)
+	}
+	if c, _ := ir.GetDocumentsCount(); c != 1 {
+		t.Errorf("GetDocumentsCount() = %d, want 1", c)
+	}
+	if meta, _ := ir.GetFetchMeta(redirected); meta != nil {
+		t.Errorf("fetch meta of an address redirected to the deleted document survived: %+v", meta)
+	}
+	if _, err := ir.GetPageUrlsByHash(redirected); err == nil {
+		t.Errorf("links of an address redirected to the deleted document survived")
+	}
+	if meta, _ := ir.GetFetchMeta(other); meta == nil {
+		t.Errorf("fetch meta of a surviving document was deleted")
+	}
+	if _, err := ir.GetPageUrlsByHash(other); err != nil {
+		t.Errorf("links of a surviving document were deleted: %v", err)
+	}
+	if deleted, err := ir.GetDeletedDocuments(); err != nil || len(deleted) != 0 || ir.IsDeleted(ids[0]) {
+		t.Errorf("GetDeletedDocuments() = %x, %v, want tombstones removed after cleanup", deleted, err)
+	}
+	if err := ir.DeleteDocument(ids[0]); err == nil || err.Error() != "Key not found" {
+		t.Errorf("second DeleteDocument() = %v, want Key not found", err)
+	}
+
+	if err := ir.DB.Update(func(txn *badger.Txn) error { // очистка прервалась после надгробия
+		return txn.Set(fmt.Appendf(nil, TombstoneKeyFormat, ids[0][:]), nil)
+	}); err != nil {
+		t.Fatalf("set tombstone: %v", err)
+	}
+	if deleted, err := ir.GetDeletedDocuments(); err != nil || !reflect.DeepEqual(deleted, map[[32]byte]struct{}{ids[0]: {}}) || ir.IsDeleted(ids[1]) {
+		t.Errorf("GetDeletedDocuments() = %x, %v, want only %x", deleted, err, ids[0])
+	}
+	if err := ir.SaveDocument(&model.Document{Id: ids[0], URL: docs[0].url}); err != nil {
+		t.Fatalf("SaveDocument(): %v", err)
+	}
+	if deleted, _ := ir.GetDeletedDocuments(); ir.IsDeleted(ids[0]) || len(deleted) != 0 {
+		t.Errorf("reindexed document is still tombstoned")
+	}
+}
+
+func TestFetchMetaRoundTrip(t *testing.T) {
+	ir, err := NewIndexRepository(t.TempDir(), io.Discard, 20)
+	if err != nil {
+		t.Fatalf("NewIndexRepository(): %v", err)
+	}
+	defer ir.DB.Close()
+
+	key := sha256.Sum256([]byte("go.dev/doc"))
+	if meta, err := ir.GetFetchMeta(key); meta != nil || err != nil {
+		t.Errorf("GetFetchMeta() for unknown page = %+v, %v", meta, err)
+	}
+	meta := &model.FetchMeta{
+		ETag: 			`W/"5f2a"`,
+		LastModified: 	"Mon, 02 Jan 2006 15:04:05 GMT",
+		FetchedAt: 		time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC),
+		ContentHash: 	sha256.Sum256([]byte("<html></html>")),
+		Redirects: 		[]string{"http://go.dev/doc", "https://go.dev/doc/"},
+		DocID: 			sha256.Sum256([]byte("go.dev/doc/")),
+		SkipReason: 	"nofollow",
+	}
+	if err := ir.SaveFetchMeta(key, meta); err != nil {
+		t.Fatalf("SaveFetchMeta(): %v", err)
+	}
+	got, err := ir.GetFetchMeta(key)
+	if err != nil || got == nil || !reflect.DeepEqual(got, meta) {
+		t.Errorf("GetFetchMeta() = %+v, %v; want %+v", got, err, meta)
+	}
+
+	if schedule, _ := ir.GetFetchSchedule(); len(schedule) != 0 {
+		t.Errorf("record without url is scheduled: %+v", schedule)
+	}
+	for i, u := range []string{"https://go.dev/blog", "https://go.dev/doc", "https://go.dev/play"} {
+		scheduled := &model.FetchMeta{
+			URL: 			u,
+			Depth: 			1,
+			FetchedAt: 		meta.FetchedAt,
+			Interval: 		time.Duration(3 - i) * time.Hour,
+			NextFetchAt: 	meta.FetchedAt.Add(time.Duration(3 - i) * time.Hour),
+			Checks: 		2,
+			Changes: 		1,
+			ChangeFreq: 	"daily",
+		}
+		if err := ir.SaveFetchMeta(sha256.Sum256([]byte(u)), scheduled); err != nil {
+			t.Fatalf("SaveFetchMeta(): %v", err)
+		}
+	}
+	schedule, err := ir.GetFetchSchedule()
+	if err != nil || len(schedule) != 3 {
+		t.Fatalf("GetFetchSchedule() = %d entries, %v", len(schedule), err)
+	}
+	if schedule[0].URL != "https://go.dev/play" || schedule[2].URL != "https://go.dev/blog" || schedule[0].Interval != time.Hour || schedule[0].ChangeFreq != "daily" {
+		t.Errorf("GetFetchSchedule() order = %s, %s, %s", schedule[0].URL, schedule[1].URL, schedule[2].URL)
+	}
+}
+
+func TestFrontierRoundTrip(t *testing.T) {
+	ir, err := NewIndexRepository(t.TempDir(), io.Discard, 20)
+	if err != nil {
+		t.Fatalf("NewIndexRepository(): %v", err)
+	}
+	defer ir.DB.Close()
+
+	if nodes, err := ir.LoadFrontier(); err != nil || len(nodes) != 0 {
+		t.Errorf("LoadFrontier() on empty index = %+v, %v", nodes, err)
+	}
+	if err := ir.SaveFrontier([]model.CrawlNode{
+		{URL: "https://go.dev/blog", Depth: 2},
+		{URL: "https://go.dev/doc", Depth: 1, SameDomain: true, Priority: 3, Seed: "https://go.dev/"},
+		{URL: "https://go.dev/blog", Depth: 1, SameDomain: true}, // дубликат с меньшей глубиной побеждает
+		{URL: "", Depth: 0},
+	}); err != nil {
+		t.Fatalf("SaveFrontier(): %v", err)
+	}
+	nodes, err := ir.LoadFrontier()
+	if err != nil {
+		t.Fatalf("LoadFrontier(): %v", err)
+	}
+	want := []model.CrawlNode{
+		{URL: "https://go.dev/blog", Depth: 1, SameDomain: true},
+		{URL: "https://go.dev/doc", Depth: 1, SameDomain: true, Priority: 3, Seed: "https://go.dev/"},
+	}
+	if !reflect.DeepEqual(nodes, want) {
+		t.Errorf("LoadFrontier() = %+v, want %+v", nodes, want)
+	}
+
+	if err := ir.SaveFrontier([]model.CrawlNode{{URL: "https://go.dev/play"}}); err != nil {
+		t.Fatalf("SaveFrontier(): %v", err)
+	}
+	if nodes, _ := ir.LoadFrontier(); len(nodes) != 1 || nodes[0].URL != "https://go.dev/play" {
+		t.Errorf("LoadFrontier() after replace = %+v", nodes)
+	}
+	if err := ir.SaveFrontier(nil); err != nil {
+		t.Fatalf("SaveFrontier(nil): %v", err)
+	}
+	if nodes, _ := ir.LoadFrontier(); len(nodes) != 0 {
+		t.Errorf("LoadFrontier() after clearing = %+v", nodes)
+	}
+}
@@ -1,12 +1,90 @@
 package repository
 
 import (
+	"encoding/json"
 	"fmt"
+	"slices"
+	"time"
+
+	"wfts/internal/model"
 
 	"github.com/dgraph-io/badger/v3"
 )
 
-const urlsKey = "hashKey:%s"
+const (
+	urlsKey = "hashKey:%s"
+	FetchMetaKeyFormat = "fetch:%s"
+	FrontierKeyPrefix = "frontier:"
+)
+
+type fetchDBSt struct {
+	ETag 			string 		`json:"etag,omitempty"`
+	LastModified 	string 		`json:"last_modified,omitempty"`
+	FetchedAt 		time.Time 	`json:"fetched_at"`
+	ContentHash 	[]byte 		`json:"hash"`
+	ContentType 	string 		`json:"content_type,omitempty"`
+	URL 			string 		`json:"url,omitempty"` // пустой у записей до появления расписания
+	Depth 			int 		`json:"depth,omitempty"`
+	Interval 		int64 		`json:"interval_s,omitempty"`
+	NextFetchAt 	time.Time 	`json:"next_fetch_at"`
+	Checks 			int 		`json:"checks,omitempty"`
+	Changes 		int 		`json:"changes,omitempty"`
+	ChangeFreq 		string 		`json:"changefreq,omitempty"`
+	Redirects 		[]string 	`json:"redirects,omitempty"`
+	DocID 			[]byte 		`json:"doc,omitempty"`
+	SkipReason 		string 		`json:"skip_reason,omitempty"`
+}
+
+type frontierDBSt struct {
+	Depth 		int 	`json:"depth"`
+	SameDomain 	bool 	`json:"same_domain,omitempty"`
+	Priority 	int 	`json:"priority,omitempty"`
+	Seed 		string 	`json:"seed,omitempty"`
+}
+
+func fetchToDB(meta *model.FetchMeta) fetchDBSt {
+	p := fetchDBSt{
+		ETag: 			meta.ETag,
+		LastModified: 	meta.LastModified,
+		FetchedAt: 		meta.FetchedAt,
+		ContentHash: 	meta.ContentHash[:],
+		ContentType: 	meta.ContentType,
+		URL: 			meta.URL,
+		Depth: 			meta.Depth,
+		Interval: 		int64(meta.Interval / time.Second),
+		NextFetchAt: 	meta.NextFetchAt,
+		Checks: 		meta.Checks,
+		Changes: 		meta.Changes,
+		ChangeFreq: 	meta.ChangeFreq,
+		Redirects: 		meta.Redirects,
+		SkipReason: 	meta.SkipReason,
+	}
+	if meta.DocID != [32]byte{} {
+		p.DocID = meta.DocID[:]
+	}
+	return p
+}
+
+func (p fetchDBSt) toModel() *model.FetchMeta {
+	meta := &model.FetchMeta{
+		ETag: 			p.ETag,
+		LastModified: 	p.LastModified,
+		FetchedAt: 		p.FetchedAt,
+		ContentType: 	p.ContentType,
+		URL: 			p.URL,
+		Depth: 			p.Depth,
+		Interval: 		time.Duration(p.Interval) * time.Second,
+		NextFetchAt: 	p.NextFetchAt,
+		Checks: 		p.Checks,
+		Changes: 		p.Changes,
+		ChangeFreq: 	p.ChangeFreq,
+		Redirects: 		p.Redirects,
+		SkipReason: 	p.SkipReason,
+	}
+	copy(meta.ContentHash[:], p.ContentHash)
+	copy(meta.DocID[:], p.DocID)
+	return meta
+}
 
 func (ir *IndexRepository) IndexUrlsByHash(hash [32]byte, urlsStruct []byte) error {
 	ir.mu.Lock()
@@ -28,4 +106,135 @@ func (ir *IndexRepository) GetPageUrlsByHash(hash [32]byte) ([]byte, error) {
 		urlsStruct, err = it.ValueCopy(nil)
 		return err
 	})
-}
\ No newline at end of file
+}
+
+func (ir *IndexRepository) SaveFetchMeta(hash [32]byte, meta *model.FetchMeta) error {
+	val, err := json.Marshal(fetchToDB(meta))
+	if err != nil {
+		return err
+	}
+	return ir.DB.Update(func(txn *badger.Txn) error {
+		return txn.Set(fmt.Appendf(nil, FetchMetaKeyFormat, hash[:]), val)
+	})
+}
+
+func (ir *IndexRepository) GetFetchMeta(hash [32]byte) (*model.FetchMeta, error) {
+	var meta *model.FetchMeta
+	return meta, ir.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(fmt.Appendf(nil, FetchMetaKeyFormat, hash[:]))
+		if err != nil {
+			if err == badger.ErrKeyNotFound { // страница еще не скачивалась или скачана до появления метаданных
+				return nil
+			}
+			return err
+		}
+		p := fetchDBSt{}
+		if err := item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &p)
+		}); err != nil {
+			return err
+		}
+		meta = p.toModel()
+		return nil
+	})
+}
+
+func (ir *IndexRepository) GetFetchSchedule() ([]*model.FetchMeta, error) { // все страницы с расписанием, ближайшие к повторной загрузке первыми
+	schedule := []*model.FetchMeta{}
+	if err := ir.DB.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		prefix := []byte("fetch:")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			p := fetchDBSt{}
+			if err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &p)
+			}); err != nil {
+				return err
+			}
+			if p.URL != "" {
+				schedule = append(schedule, p.toModel())
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(schedule, func(a, b *model.FetchMeta) int {
+		return a.NextFetchAt.Compare(b.NextFetchAt)
+	})
+	return schedule, nil
+}
+
+func (ir *IndexRepository) SaveFrontier(nodes []model.CrawlNode) error { // заменяет сохраненную очередь обхода, пустой срез ее очищает
+	fresh := make(map[string]frontierDBSt, len(nodes))
+	for _, node := range nodes {
+		if node.URL == "" {
+			continue
+		}
+		if p, ok := fresh[node.URL]; ok && p.Depth <= node.Depth {
+			continue
+		}
+		fresh[node.URL] = frontierDBSt{Depth: node.Depth, SameDomain: node.SameDomain, Priority: node.Priority, Seed: node.Seed}
+	}
+
+	stale := [][]byte{}
+	if err := ir.DB.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		prefix := []byte(FrontierKeyPrefix)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			if _, ok := fresh[string(it.Item().Key()[len(prefix):])]; !ok {
+				stale = append(stale, it.Item().KeyCopy(nil))
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	wb := ir.DB.NewWriteBatch() // сначала новые записи, потом удаление старых, чтоб падение посередине не потеряло очередь
+	defer wb.Cancel()
+	for link, p := range fresh {
+		val, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		if err := wb.Set([]byte(FrontierKeyPrefix + link), val); err != nil {
+			return err
+		}
+	}
+	for _, key := range stale {
+		if err := wb.Delete(key); err != nil {
+			return err
+		}
+	}
+	return wb.Flush()
+}
+
+func (ir *IndexRepository) LoadFrontier() ([]model.CrawlNode, error) {
+	nodes := []model.CrawlNode{}
+	return nodes, ir.DB.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		prefix := []byte(FrontierKeyPrefix)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			p := frontierDBSt{}
+			if err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &p)
+			}); err != nil {
+				return err
+			}
+			nodes = append(nodes, model.CrawlNode{
+				URL: 		string(it.Item().Key()[len(prefix):]),
+				Depth: 		p.Depth,
+				SameDomain: p.SameDomain,
+				Priority: 	p.Priority,
+				Seed: 		p.Seed,
+			})
+		}
+		return nil
+	})
+}
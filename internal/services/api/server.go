@@ -0,0 +1,224 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"wfts/internal/services/wfts/online/searcher"
+)
+
+const (
+	defaultLimit = 10
+	maxLimit = 100
+	shutdownTimeout = 5 * time.Second
+)
+
+type searchEngine interface {
+	Search(searcher.SearchRequest) (*searcher.SearchResponse, error)
+}
+
+type storage interface {
+	GetDocumentsCount() (int, error)
+}
+
+type Server struct {
+	log 		*slog.Logger
+	search 		searchEngine
+	repo 		storage
+	addr 		string
+}
+
+type hitView struct {
+	URL 			string 		`json:"url"`
+	Title 			string 		`json:"title,omitempty"`
+	Description 	string 		`json:"description,omitempty"`
+	Score 			float64 	`json:"score"`
+	ModelScore 		float64 	`json:"model_score,omitempty"`
+	Reranked 		bool 		`json:"reranked,omitempty"`
+	MatchedTerms 	[]string 	`json:"matched_terms"`
+	Snippet 		*snippetView `json:"snippet,omitempty"`
+	Explain 		*searcher.Explanation `json:"explain,omitempty"`
+}
+
+type snippetView struct {
+	Text 		string 		`json:"text"`
+	Highlights 	[][2]int 	`json:"highlights"` // байтовые смещения [start, end) в text
+}
+
+type searchView struct {
+	Query 			string 		`json:"query"`
+	CorrectedQuery 	string 		`json:"corrected_query,omitempty"`
+	Offset 			int 		`json:"offset"`
+	Limit 			int 		`json:"limit"`
+	Total 			int 		`json:"total"`
+	TookMs 			float64 	`json:"took_ms"`
+	Hits 			[]hitView 	`json:"hits"`
+}
+
+type statsView struct {
+	Documents int `json:"documents"`
+}
+
+type errorView struct {
+	Error string `json:"error"`
+}
+
+func NewServer(addr string, wr io.Writer, s searchEngine, repo storage) *Server {
+	return &Server{
+		log: 		slog.New(slog.NewTextHandler(wr, &slog.HandlerOptions{})),
+		search: 	s,
+		repo: 		repo,
+		addr: 		addr,
+	}
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /search", s.handleSearch)
+	mux.HandleFunc("GET /stats", s.handleStats)
+	return mux
+}
+
+func (s *Server) Run(ctx context.Context) error {
+	srv := &http.Server{
+		Addr: 				s.addr,
+		Handler: 			s.Handler(),
+		ReadHeaderTimeout: 	10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		s.log.Info("http api listening on " + s.addr)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	c, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(c); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		s.writeJSON(w, http.StatusBadRequest, errorView{Error: "missing query parameter q"})
+		return
+	}
+	limit, err := intParam(r, "limit", defaultLimit)
+	if err != nil || limit < 1 || limit > maxLimit {
+		s.writeJSON(w, http.StatusBadRequest, errorView{Error: fmt.Sprintf("limit must be in range 1..%d", maxLimit)})
+		return
+	}
+	offset, err := intParam(r, "offset", 0)
+	if err != nil || offset < 0 {
+		s.writeJSON(w, http.StatusBadRequest, errorView{Error: "offset must be a non-negative integer"})
+		return
+	}
+	explain, err := boolParam(r, "explain")
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, errorView{Error: "explain must be a boolean"})
+		return
+	}
+
+	res, err := s.search.Search(searcher.SearchRequest{Query: q, Offset: offset, Limit: limit})
+	if qe := (*searcher.QueryError)(nil); errors.As(err, &qe) {
+		s.writeJSON(w, http.StatusBadRequest, errorView{Error: qe.Error()})
+		return
+	}
+	if err != nil { // пустой ответ нельзя отличить от "ничего не найдено"
+		s.log.Error("search error: " + err.Error())
+		s.writeJSON(w, http.StatusInternalServerError, errorView{Error: "search failed"})
+		return
+	}
+
+	view := searchView{
+		Query: 			q,
+		Offset: 		offset,
+		Limit: 			limit,
+		Hits: 			[]hitView{},
+		CorrectedQuery: res.CorrectedQuery,
+		Total: 			res.Total,
+		TookMs: 		float64(res.Took.Microseconds()) / 1000,
+	}
+	for _, hit := range res.Hits {
+		hv := hitView{
+			URL: 			hit.Document.URL,
+			Title: 			hit.Document.Title,
+			Description: 	hit.Document.Description,
+			Score: 			hit.Score,
+			ModelScore: 	hit.ModelScore,
+			Reranked: 		hit.Reranked,
+			MatchedTerms: 	hit.MatchedTerms,
+			Snippet: 		newSnippetView(hit.Snippet),
+		}
+		if explain {
+			hv.Explain = hit.Explain
+		}
+		view.Hits = append(view.Hits, hv)
+	}
+	s.writeJSON(w, http.StatusOK, view)
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	count, err := s.repo.GetDocumentsCount()
+	if err != nil {
+		s.log.Error("error counting documents: " + err.Error())
+		s.writeJSON(w, http.StatusInternalServerError, errorView{Error: "failed to count documents"})
+		return
+	}
+	s.writeJSON(w, http.StatusOK, statsView{Documents: count})
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.log.Error("error encoding response: " + err.Error())
+	}
+}
+
+func newSnippetView(sn *searcher.Snippet) *snippetView {
+	if sn == nil || sn.Text == "" {
+		return nil
+	}
+	v := &snippetView{Text: sn.Text, Highlights: sn.Highlights}
+	if v.Highlights == nil {
+		v.Highlights = [][2]int{}
+	}
+	return v
+}
+
+func intParam(r *http.Request, name string, def int) (int, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return def, nil
+	}
+	return strconv.Atoi(raw)
+}
+
+func boolParam(r *http.Request, name string) (bool, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(raw)
+}
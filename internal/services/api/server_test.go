@@ -0,0 +1,247 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"wfts/configs"
+	"wfts/internal/model"
+	"wfts/internal/repository"
+	"wfts/internal/services/wfts/offline/indexer"
+	"wfts/internal/services/wfts/online/searcher"
+)
+
+func newTestServer(t *testing.T) *Server {
+	ir, err := repository.NewIndexRepository(t.TempDir(), io.Discard, 20)
+	if err != nil {
+		t.Fatalf("NewIndexRepository(): %v", err)
+	}
+	t.Cleanup(func() { ir.DB.Close() })
+
+	idx := indexer.NewIndexer(ir, io.Discard, &configs.ConfigData{MaxTypo: 2, NGramCount: 3})
+	if err := idx.PrepareHasher(); err != nil {
+		t.Fatalf("PrepareHasher(): %v", err)
+	}
+
+	pages := []struct {
+		url  string
+		text string
+	}{
+		{"https://golang.org/doc", "golang concurrency patterns with goroutines and channels explained for beginners"},
+		{"https://example.com/cooking", "baking bread at home requires flour water salt yeast and patience"},
+		{"https://example.com/garden", "growing tomatoes in a small garden needs sunlight water and good soil"},
+	}
+	for _, p := range pages {
+		doc := &model.Document{Id: sha256.Sum256([]byte(p.url)), URL: p.url, Text: p.text}
+		if err := idx.HandleDocumentWords(doc, []model.Passage{{Text: p.text, Type: model.BodyType}}); err != nil {
+			t.Fatalf("HandleDocumentWords(%s): %v", p.url, err)
+		}
+	}
+
+	return NewServer(":0", io.Discard, searcher.NewSearcher(io.Discard, idx, ir, configs.DefaultRanking()), ir)
+}
+
+func TestSearchHandler(t *testing.T) {
+	srv := newTestServer(t)
+	tests := []struct {
+		name       string
+		target     string
+		status     int
+		expected   []string
+		negative   bool
+		total      int
+	}{
+		{
+			name:     "single match",
+			target:   "/search?q=goroutines",
+			status:   http.StatusOK,
+			expected: []string{"https://golang.org/doc"},
+		},
+		{
+			name:     "shared term",
+			target:   "/search?q=water&limit=5",
+			status:   http.StatusOK,
+			expected: []string{"https://example.com/cooking", "https://example.com/garden"},
+			total:    2,
+		},
+		{
+			name:     "second page",
+			target:   "/search?q=water&limit=1&offset=1",
+			status:   http.StatusOK,
+			expected: []string{"https://example.com/garden"},
+			total:    2,
+		},
+		{
+			name:     "offset past results",
+			target:   "/search?q=water&offset=10",
+			status:   http.StatusOK,
+			expected: []string{},
+			total:    2,
+		},
+		{
+			name:     "exact phrase",
+			target:   "/search?q=%22concurrency+patterns%22",
+			status:   http.StatusOK,
+			expected: []string{"https://golang.org/doc"},
+		},
+		{
+			name:     "phrase in wrong order",
+			target:   "/search?q=%22patterns+concurrency%22",
+			status:   http.StatusOK,
+			expected: []string{},
+		},
+		{
+			name:     "phrase with slop",
+			target:   "/search?q=%22water+soil%22~2",
+			status:   http.StatusOK,
+			expected: []string{"https://example.com/garden"},
+		},
+		{
+			name:     "site filter",
+			target:   "/search?q=water+site:example.com",
+			status:   http.StatusOK,
+			expected: []string{"https://example.com/cooking", "https://example.com/garden"},
+		},
+		{
+			name:     "site filter on other host",
+			target:   "/search?q=water+site:golang.org",
+			status:   http.StatusOK,
+			expected: []string{},
+		},
+		{
+			name:     "negation only",
+			target:   "/search?q=NOT+water",
+			status:   http.StatusOK,
+			expected: []string{"https://golang.org/doc"},
+			negative: true,
+		},
+		{
+			name:   "missing query",
+			target: "/search",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "invalid limit",
+			target: "/search?q=water&limit=1000",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "invalid offset",
+			target: "/search?q=water&offset=-1",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "malformed query",
+			target: "/search?q=%28+%29",
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if rec.Code != tt.status {
+				t.Fatalf("GET %s: status %d, want %d, body %s", tt.target, rec.Code, tt.status, rec.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var view searchView
+			if err := json.NewDecoder(rec.Body).Decode(&view); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			got := map[string]struct{}{}
+			for _, hit := range view.Hits {
+				got[hit.URL] = struct{}{}
+				if len(hit.MatchedTerms) == 0 && !tt.negative {
+					t.Errorf("hit %s has no matched terms", hit.URL)
+				}
+				if hit.Snippet == nil || len(hit.Snippet.Highlights) == 0 && !tt.negative {
+					t.Errorf("hit %s has no highlighted snippet: %+v", hit.URL, hit.Snippet)
+				}
+			}
+			if tt.total != 0 && view.Total != tt.total {
+				t.Errorf("GET %s: total %d, want %d", tt.target, view.Total, tt.total)
+			}
+			if len(got) != len(tt.expected) {
+				t.Fatalf("GET %s: got %d hits, want %d", tt.target, len(got), len(tt.expected))
+			}
+			for _, u := range tt.expected {
+				if _, ex := got[u]; !ex {
+					t.Errorf("GET %s: missing hit %s", tt.target, u)
+				}
+			}
+		})
+	}
+}
+
+type brokenSearch struct{}
+
+func (brokenSearch) Search(searcher.SearchRequest) (*searcher.SearchResponse, error) {
+	return nil, errors.New("Key not found")
+}
+
+func TestSearchEngineFailure(t *testing.T) {
+	srv := NewServer(":0", io.Discard, brokenSearch{}, nil)
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search?q=water", nil))
+	var view errorView
+	if err := json.NewDecoder(rec.Body).Decode(&view); err != nil || rec.Code != http.StatusInternalServerError || view.Error == "" {
+		t.Errorf("GET /search with a broken index: status %d, body %+v, %v; want 500 with an error", rec.Code, view, err)
+	}
+}
+
+func TestSearchExplain(t *testing.T) {
+	srv := newTestServer(t)
+	for target, want := range map[string]bool{
+		"/search?q=water+soil": false,
+		"/search?q=water+soil&explain=true": true,
+	} {
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		var view searchView
+		if err := json.NewDecoder(rec.Body).Decode(&view); err != nil {
+			t.Fatalf("decoding response: %v", err)
+		}
+		if len(view.Hits) == 0 {
+			t.Fatalf("GET %s: no hits", target)
+		}
+		for _, hit := range view.Hits {
+			if (hit.Explain != nil) != want {
+				t.Errorf("GET %s: explain present = %t, want %t", target, hit.Explain != nil, want)
+			}
+			if hit.Explain != nil && (hit.Explain.Score != hit.Score || len(hit.Explain.Terms) == 0) {
+				t.Errorf("GET %s: inconsistent explanation %+v", target, hit.Explain)
+			}
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/search?q=water&explain=maybe", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid explain: status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestStatsHandler(t *testing.T) {
+	srv := newTestServer(t)
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /stats: status %d", rec.Code)
+	}
+	var view statsView
+	if err := json.NewDecoder(rec.Body).Decode(&view); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if view.Documents != 3 {
+		t.Errorf("documents = %d, want 3", view.Documents)
+	}
+}
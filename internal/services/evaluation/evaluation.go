@@ -0,0 +1,120 @@
+package evaluation
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sort"
+
+	"wfts/internal/services/wfts/online/searcher"
+	"wfts/internal/utils/ltr"
+)
+
+type searchEngine interface {
+	Search(searcher.SearchRequest) (*searcher.SearchResponse, error)
+}
+
+type Metrics struct {
+	NDCG 		float64
+	MRR 		float64
+	Precision 	float64
+	Recall 		float64
+}
+
+type QueryResult struct {
+	Query 	string
+	Metrics
+}
+
+type Report struct {
+	K 		int
+	Depth 	int // сколько результатов учитывается для recall и MRR
+	Queries []QueryResult
+	Mean 	Metrics
+}
+
+func Evaluate(s searchEngine, j ltr.Judgements, k, depth int) (*Report, error) {
+	report := &Report{K: k, Depth: max(k, depth)}
+	queries := j.Queries()
+	slices.Sort(queries)
+	for _, query := range queries {
+		res, err := s.Search(searcher.SearchRequest{Query: query, Limit: report.Depth})
+		if err != nil { // сломанный запрос или индекс испортил бы средние как будто ничего не найдено
+			return nil, err
+		}
+		ranked := []string{}
+		for _, hit := range res.Hits {
+			ranked = append(ranked, hit.Document.URL)
+		}
+		grades := j[query]
+		qr := QueryResult{Query: query, Metrics: Metrics{
+			NDCG: 		NDCG(ranked, grades, k),
+			MRR: 		ReciprocalRank(ranked, grades),
+			Precision: 	PrecisionAt(ranked, grades, k),
+			Recall: 	Recall(ranked, grades),
+		}}
+		report.Queries = append(report.Queries, qr)
+		report.Mean.NDCG += qr.NDCG
+		report.Mean.MRR += qr.MRR
+		report.Mean.Precision += qr.Precision
+		report.Mean.Recall += qr.Recall
+	}
+	if n := float64(len(report.Queries)); n > 0 {
+		report.Mean.NDCG /= n
+		report.Mean.MRR /= n
+		report.Mean.Precision /= n
+		report.Mean.Recall /= n
+	}
+	return report, nil
+}
+
+func (r *Report) metricNames() []string {
+	return []string{fmt.Sprintf("NDCG@%d", r.K), "MRR", fmt.Sprintf("P@%d", r.K), fmt.Sprintf("Recall@%d", r.Depth)}
+}
+
+func (m Metrics) values() []float64 {
+	return []float64{m.NDCG, m.MRR, m.Precision, m.Recall}
+}
+
+func (r *Report) Write(w io.Writer) {
+	fmt.Fprintf(w, "%d queries\n", len(r.Queries))
+	values := r.Mean.values()
+	for i, name := range r.metricNames() {
+		fmt.Fprintf(w, "  %-10s %.4f\n", name, values[i])
+	}
+	fmt.Fprintln(w, "per query NDCG:")
+	for _, q := range r.Queries {
+		fmt.Fprintf(w, "  %.4f  %s\n", q.NDCG, q.Query)
+	}
+}
+
+func WriteDiff(w io.Writer, base, cand *Report) { // base и cand должны считаться по одним и тем же judgements
+	fmt.Fprintf(w, "%-10s %8s %8s %8s\n", "metric", "base", "cand", "delta")
+	bv, cv := base.Mean.values(), cand.Mean.values()
+	for i, name := range base.metricNames() {
+		fmt.Fprintf(w, "%-10s %8.4f %8.4f %+8.4f\n", name, bv[i], cv[i], cv[i] - bv[i])
+	}
+
+	byQuery := map[string]float64{}
+	for _, q := range base.Queries {
+		byQuery[q.Query] = q.NDCG
+	}
+	changed := []QueryResult{}
+	for _, q := range cand.Queries {
+		if old, ex := byQuery[q.Query]; ex && math.Abs(q.NDCG - old) > 1e-9 {
+			changed = append(changed, q)
+		}
+	}
+	if len(changed) == 0 {
+		fmt.Fprintln(w, "no per-query NDCG changes")
+		return
+	}
+	sort.Slice(changed, func(i, j int) bool {
+		return math.Abs(changed[i].NDCG - byQuery[changed[i].Query]) > math.Abs(changed[j].NDCG - byQuery[changed[j].Query])
+	})
+	fmt.Fprintln(w, "per query NDCG changes:")
+	for _, q := range changed {
+		fmt.Fprintf(w, "  %+.4f  %.4f -> %.4f  %s\n", q.NDCG - byQuery[q.Query], byQuery[q.Query], q.NDCG, q.Query)
+	}
+}
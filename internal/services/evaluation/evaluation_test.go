@@ -0,0 +1,152 @@
+package evaluation
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"testing"
+
+	"wfts/configs"
+	"wfts/internal/model"
+	"wfts/internal/repository"
+	"wfts/internal/services/wfts/offline/indexer"
+	"wfts/internal/services/wfts/online/searcher"
+	"wfts/internal/utils/ltr"
+)
+
+func TestMetrics(t *testing.T) {
+	grades := map[string]int{"a": 3, "b": 2, "c": 0, "d": 1}
+	tests := []struct {
+		name 		string
+		ranked 		[]string
+		ndcg 		float64
+		mrr 		float64
+		precision 	float64
+		recall 		float64
+	}{
+		{
+			name: "ideal order",
+			ranked: []string{"a", "b", "d", "c"},
+			ndcg: 1, mrr: 1, precision: 0.75, recall: 1,
+		},
+		{
+			name: "relevant document second",
+			ranked: []string{"c", "a"},
+			ndcg: (7 / math.Log2(3)) / (7 + 3 / math.Log2(3) + 1 / math.Log2(4)),
+			mrr: 0.5, precision: 0.25, recall: 1.0 / 3,
+		},
+		{
+			name: "nothing found",
+			ranked: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []float64{NDCG(tt.ranked, grades, 4), ReciprocalRank(tt.ranked, grades), PrecisionAt(tt.ranked, grades, 4), Recall(tt.ranked, grades)}
+			expected := []float64{tt.ndcg, tt.mrr, tt.precision, tt.recall}
+			for i := range got {
+				if math.Abs(got[i] - expected[i]) > 1e-9 {
+					t.Errorf("metrics(%v) = %v, want %v", tt.ranked, got, expected)
+					break
+				}
+			}
+		})
+	}
+}
+
+func newCorpusSearcher(t *testing.T, weights configs.RankingConfig) *searcher.Searcher {
+	ir, err := repository.NewIndexRepository(t.TempDir(), io.Discard, 20)
+	if err != nil {
+		t.Fatalf("NewIndexRepository(): %v", err)
+	}
+	t.Cleanup(func() { ir.DB.Close() })
+
+	idx := indexer.NewIndexer(ir, io.Discard, &configs.ConfigData{MaxTypo: 2, NGramCount: 3})
+	if err := idx.PrepareHasher(); err != nil {
+		t.Fatalf("PrepareHasher(): %v", err)
+	}
+
+	f, err := os.Open("testdata/corpus.tsv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if strings.HasPrefix(sc.Text(), "#") {
+			continue
+		}
+		parts := strings.Split(sc.Text(), "\t")
+		if len(parts) != 3 {
+			t.Fatalf("bad corpus line %q", sc.Text())
+		}
+		doc := &model.Document{Id: sha256.Sum256([]byte(parts[0])), URL: parts[0], Title: parts[1], Text: parts[1] + "\n" + parts[2]}
+		passages := []model.Passage{{Text: parts[1], Type: model.TitleType}, {Text: parts[2], Type: model.BodyType}}
+		if err := idx.HandleDocumentWords(doc, passages); err != nil {
+			t.Fatalf("HandleDocumentWords(%s): %v", parts[0], err)
+		}
+	}
+	return searcher.NewSearcher(io.Discard, idx, ir, weights)
+}
+
+func loadQrels(t *testing.T) ltr.Judgements {
+	f, err := os.Open("testdata/qrels.tsv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	j, err := ltr.ReadJudgements(f)
+	if err != nil {
+		t.Fatalf("ReadJudgements(): %v", err)
+	}
+	return j
+}
+
+func TestEvaluateSyntheticCorpus(t *testing.T) {
+	j := loadQrels(t)
+	base, err := Evaluate(newCorpusSearcher(t, configs.DefaultRanking()), j, 10, 100)
+	if err != nil {
+		t.Fatalf("Evaluate(): %v", err)
+	}
+	if len(base.Queries) != len(j) {
+		t.Fatalf("evaluated %d queries, want %d", len(base.Queries), len(j))
+	}
+	// базовый уровень: NDCG@10 0.85, MRR 1, recall 0.81 (стеммер не сводит indexes -> index и concurrency -> concurr),
+	// регрессия в стеммере, спеллчекере или ранжировании уронит метрики ниже порогов
+	if base.Mean.NDCG < 0.85 || base.Mean.MRR < 0.95 || base.Mean.Recall < 0.8 {
+		var sb strings.Builder
+		base.Write(&sb)
+		t.Errorf("quality regression on synthetic corpus:\n%s", sb.String())
+	}
+
+	var out strings.Builder
+	base.Write(&out)
+	for _, want := range []string{"NDCG@10", "MRR", "P@10", "Recall@100", "goroutines channels"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("report is missing %q:\n%s", want, out.String())
+		}
+	}
+
+	flat := configs.DefaultRanking()
+	flat.BM25B, flat.HeaderBoost, flat.ProximityBoost, flat.URLBoost = 0, 0, 0, 0
+	cand, err := Evaluate(newCorpusSearcher(t, flat), j, 10, 100)
+	if err != nil {
+		t.Fatalf("Evaluate(): %v", err)
+	}
+
+	var diff strings.Builder
+	WriteDiff(&diff, base, cand)
+	if !strings.Contains(diff.String(), "delta") || !strings.Contains(diff.String(), "NDCG@10") {
+		t.Errorf("unexpected diff output:\n%s", diff.String())
+	}
+
+	diff.Reset()
+	WriteDiff(&diff, base, base)
+	if !strings.Contains(diff.String(), "no per-query NDCG changes") {
+		t.Errorf("diff of identical reports:\n%s", diff.String())
+	}
+}
@@ -0,0 +1,70 @@
+package evaluation
+
+import (
+	"math"
+	"sort"
+)
+
+func DCG(ranked []string, grades map[string]int, k int) float64 {
+	dcg := 0.0
+	for i, url := range ranked[:min(k, len(ranked))] {
+		if g := grades[url]; g > 0 {
+			dcg += (math.Pow(2, float64(g)) - 1) / math.Log2(float64(i + 2))
+		}
+	}
+	return dcg
+}
+
+func NDCG(ranked []string, grades map[string]int, k int) float64 {
+	ideal := make([]string, 0, len(grades))
+	for url := range grades {
+		ideal = append(ideal, url)
+	}
+	sort.Slice(ideal, func(i, j int) bool { return grades[ideal[i]] > grades[ideal[j]] })
+	idcg := DCG(ideal, grades, k)
+	if idcg == 0 {
+		return 0
+	}
+	return DCG(ranked, grades, k) / idcg
+}
+
+func ReciprocalRank(ranked []string, grades map[string]int) float64 {
+	for i, url := range ranked {
+		if grades[url] > 0 {
+			return 1 / float64(i + 1)
+		}
+	}
+	return 0
+}
+
+func PrecisionAt(ranked []string, grades map[string]int, k int) float64 {
+	if k <= 0 {
+		return 0
+	}
+	hits := 0
+	for _, url := range ranked[:min(k, len(ranked))] {
+		if grades[url] > 0 {
+			hits++
+		}
+	}
+	return float64(hits) / float64(k) // недобор выдачи тоже штрафуется
+}
+
+func Recall(ranked []string, grades map[string]int) float64 {
+	relevant := 0
+	for _, g := range grades {
+		if g > 0 {
+			relevant++
+		}
+	}
+	if relevant == 0 {
+		return 0
+	}
+	found := 0
+	for _, url := range ranked {
+		if grades[url] > 0 {
+			found++
+		}
+	}
+	return float64(found) / float64(relevant)
+}
@@ -2,10 +2,11 @@ package tui
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
-	"wfts/internal/model"
+	"wfts/internal/services/wfts/online/searcher"
 	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
@@ -16,7 +17,7 @@ import (
 const (
 	minX = 30
 	minY = 20
-	outputSize = 100
+	pageSize = 10
 )
 
 type logMsg string
@@ -35,11 +36,19 @@ type viewModel struct {
 	searchLabel 	textinput.Model
 
 	border 			lipgloss.Style
+	titleStyle 		lipgloss.Style
+	urlStyle 		lipgloss.Style
+	markStyle 		lipgloss.Style
 	rightVessel     viewport.Model
 	leftVessel      viewport.Model
 
 	getCurrentState func() (int, error)
-	searchFunc 		func(string, int) []*model.Document
+	searchFunc 		func(searcher.SearchRequest) (*searcher.SearchResponse, error)
+	request 		searcher.SearchRequest
+	total 			int
+	hits 			[]*searcher.Hit
+	selected 		int
+	showDetail 		bool
 	logLines    	[]string
 	logPlate    	[]string
 	closeIndex 		chan struct{}
@@ -51,7 +60,7 @@ func NewLogChannel(size int) *outputChannel {
 	return &outputChannel{readCh: make(chan []byte, size)}
 }
 
-func InitModel(logChan *outputChannel, borderColor string, currentHandledNum func() (int, error), searchFunc func(string, int) []*model.Document, quitChan chan struct{}) *viewModel {
+func InitModel(logChan *outputChannel, borderColor string, currentHandledNum func() (int, error), searchFunc func(searcher.SearchRequest) (*searcher.SearchResponse, error), quitChan chan struct{}) *viewModel {
 	ti := textinput.New()
 	ti.Placeholder = "Enter request..."
 	ti.Focus()
@@ -70,6 +79,9 @@ func InitModel(logChan *outputChannel, borderColor string, currentHandledNum fun
 			rightWidth: 0,
 		},
 		border: lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color(borderColor)),
+		titleStyle: lipgloss.NewStyle().Bold(true),
+		urlStyle: lipgloss.NewStyle().Foreground(lipgloss.Color("8")),
+		markStyle: lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color(borderColor)),
 		UILogWriter: logChan,
 		searchLabel: ti,
 		rightVessel: vp,
@@ -110,7 +122,7 @@ func (vm *viewModel) waitForLog() tea.Cmd {
 
 func (vm *viewModel) renderLeftLog() {
 	width := vm.leftVessel.Width
-	if width < minX * 0.4 {
+	if width < minX * 0.4 || vm.showDetail {
 		return
 	}
 
@@ -124,6 +136,66 @@ func (vm *viewModel) renderLeftLog() {
 	vm.leftVessel.GotoBottom()
 }
 
+func (vm *viewModel) renderDetail() {
+	if !vm.showDetail {
+		vm.renderLeftLog()
+		return
+	}
+	content := "No result selected."
+	if vm.selected < len(vm.hits) && vm.hits[vm.selected].Explain != nil {
+		hit := vm.hits[vm.selected]
+		content = vm.titleStyle.Render(hit.Document.URL) + "\n\n" + hit.Explain.String()
+	}
+	vm.leftVessel.SetContent(wrap.String(content, max(vm.leftVessel.Width, minX)))
+	vm.leftVessel.GotoTop()
+}
+
+func (vm *viewModel) renderResults() {
+	vm.logLines = make([]string, 0)
+	out, err := vm.searchFunc(vm.request)
+	vm.total = 0
+	vm.hits = nil
+	vm.selected = 0
+	if err != nil {
+		vm.logLines = append(vm.logLines, "Search failed: " + err.Error())
+	}
+	if out != nil {
+		vm.total = out.Total
+		vm.hits = out.Hits
+		if out.CorrectedQuery != "" {
+			vm.logLines = append(vm.logLines, "Showing results for: " + out.CorrectedQuery)
+		}
+		if len(out.Hits) > 0 {
+			vm.logLines = append(vm.logLines, vm.urlStyle.Render(fmt.Sprintf("%s (%v), ctrl+n/ctrl+p to page, tab to select, ctrl+e for score details", searcher.FormatRange(vm.request.Offset, len(out.Hits), out.Total), out.Took.Round(time.Microsecond))), "")
+		}
+	}
+	vm.drawResults()
+	vm.renderDetail()
+	vm.rightVessel.GotoTop()
+}
+
+func (vm *viewModel) drawResults() {
+	lines := slices.Clone(vm.logLines)
+	for i, hit := range vm.hits {
+		title := hit.Document.Title
+		if title == "" {
+			title = hit.Document.URL
+		}
+		if i == vm.selected {
+			title = "> " + title
+		}
+		lines = append(lines, vm.titleStyle.Render(title), vm.urlStyle.Render(hit.Document.URL))
+		if hit.Snippet != nil && hit.Snippet.Text != "" {
+			lines = append(lines, wrap.String(hit.Snippet.Render(func(s string) string { return vm.markStyle.Render(s) }), max(vm.rightVessel.Width, minX)))
+		}
+		lines = append(lines, "")
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "No results found.")
+	}
+	vm.rightVessel.SetContent(strings.Join(lines, "\n"))
+}
+
 func (vm *viewModel) Init() tea.Cmd {
 	return tea.Batch(textinput.Blink, vm.waitForLog(), showIndexedNum())
 }
@@ -166,15 +238,33 @@ func (vm *viewModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "enter":
 			text := strings.TrimSpace(vm.searchLabel.Value())
 			if text != "" {
-				vm.logLines = make([]string, 0)
-				out := vm.searchFunc(text, outputSize)
-				for _, doc := range out {
-					vm.logLines = append(vm.logLines, doc.URL)
-				}
-				vm.rightVessel.SetContent(strings.Join(vm.logLines, "\n"))
+				vm.request = searcher.SearchRequest{Query: text, Limit: pageSize}
+				vm.renderResults()
 				vm.searchLabel.SetValue("")
-				vm.rightVessel.GotoTop()
 			}
+		case "ctrl+n":
+			if vm.request.Query != "" && vm.request.Offset + pageSize < vm.total {
+				vm.request.Offset += pageSize
+				vm.renderResults()
+			}
+		case "ctrl+p":
+			if vm.request.Query != "" && vm.request.Offset > 0 {
+				vm.request.Offset = max(vm.request.Offset - pageSize, 0)
+				vm.renderResults()
+			}
+		case "tab", "shift+tab":
+			if len(vm.hits) > 0 {
+				step := 1
+				if msg.String() == "shift+tab" {
+					step = len(vm.hits) - 1
+				}
+				vm.selected = (vm.selected + step) % len(vm.hits)
+				vm.drawResults()
+				vm.renderDetail()
+			}
+		case "ctrl+e":
+			vm.showDetail = !vm.showDetail
+			vm.renderDetail()
 		case "q":
 			return vm, tea.Quit
 		case "ctrl+c":
@@ -5,13 +5,17 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
+	"slices"
 	"sync"
+	"time"
 
 	"wfts/configs"
 	"wfts/internal/model"
 	"wfts/internal/services/wfts/offline/indexer/spellChecker"
 	"wfts/internal/services/wfts/offline/indexer/textHandling"
 	"wfts/internal/services/wfts/offline/scraper"
+	"wfts/internal/utils/warc"
 	"wfts/internal/utils/workerPool"
 )
 
@@ -38,6 +42,14 @@ type repository interface {
 	GetDocumentsByWord(string) (map[[32]byte]model.WordCountAndPositions, error)
 
 	SaveDocument(*model.Document) error
+	SaveDocumentTerms([32]byte, *model.DocumentTerms) error
+	GetDocumentTerms([32]byte) (*model.DocumentTerms, error)
+	DeleteDocument([32]byte) error
+	SaveFetchMeta([32]byte, *model.FetchMeta) error
+	GetFetchMeta([32]byte) (*model.FetchMeta, error)
+	GetFetchSchedule() ([]*model.FetchMeta, error)
+	SaveFrontier([]model.CrawlNode) error
+	LoadFrontier() ([]model.CrawlNode, error)
 	GetDocumentByID([32]byte) (*model.Document, error)
 	GetAllDocuments() ([]*model.Document, error)
 	GetDocumentsCount() (int, error)
@@ -65,35 +77,142 @@ func NewIndexer(repo repository, wr io.Writer, config *configs.ConfigData) *inde
 }
 
 func (idx *indexer) Index(config *configs.ConfigData, global context.Context) error {
+	return idx.crawl(config, global, false)
+}
+
+func (idx *indexer) Watch(config *configs.ConfigData, global context.Context) error { // не завершается после обхода, а перекачивает страницы по расписанию
+	return idx.crawl(config, global, true)
+}
+
+func (idx *indexer) crawl(config *configs.ConfigData, global context.Context, watch bool) error {
 	vis := &sync.Map{}
 	if err := idx.repository.LoadVisitedUrls(vis); err != nil {
 		return err
 	}
 	defer idx.repository.SaveVisitedUrls(vis)
 	defer idx.repository.FlushAll()
-	if a, b, err := idx.repository.UploadSaltArrays(); err != nil && err.Error() != "Key not found" {
+	if err := idx.PrepareHasher(); err != nil {
 		return err
-	} else if err != nil && err.Error() == "Key not found" {
-		if c, err := idx.repository.GetDocumentsCount(); err != nil {
+	}
+	defer idx.repository.SaveSaltArrays(idx.minHash.a, idx.minHash.b)
+	frontier, err := idx.repository.LoadFrontier()
+	if err != nil {
+		return err
+	}
+	scfg := scraperConfig(config)
+	scfg.Frontier, scfg.Checkpoint = frontier, time.Duration(config.FrontierCheckpointSeconds) * time.Second // 0 - только при остановке
+	if scfg.Scope, err = scraper.NewScope(scopeRules(config.Scope)); err != nil {
+		return err
+	}
+	if config.WARCDir != "" {
+		size := int64(config.WARCMaxSizeMB) << 20
+		if size <= 0 {
+			size = 1 << 30 // обычный для WARC 1 ГБ
+		}
+		if scfg.Archive, err = warc.NewWriter(config.WARCDir, "wfts", size); err != nil {
 			return err
-		} else if c != 0 {
-			return fmt.Errorf("index isn't empty, but salt arrays is")
 		}
-		idx.minHash = NewHasher(a, b, true) // пересоздаем
+		defer scfg.Archive.Close()
+	}
+	idx.spider = scraper.NewScraper(vis, scfg, idx.logger,
+		workerPool.NewWorkerPool(config.WorkersCount, config.TasksCount, global),
+		idx, global)
+	if watch {
+		idx.spider.Watch()
 	} else {
-		idx.minHash = NewHasher(a, b, false) // просто получаем структуру
+		idx.spider.Run()
 	}
-	defer idx.repository.SaveSaltArrays(idx.minHash.a, idx.minHash.b)
+	stats := idx.spider.Stats()
+	idx.logger.Info(fmt.Sprintf("crawl finished: %d requests, %d retries, gave up on %d urls", stats.Requests, stats.Retries, stats.GaveUp))
+	for _, reason := range slices.Sorted(maps.Keys(stats.Skipped)) { // почему страниц нет в индексе
+		idx.logger.Info(fmt.Sprintf("skipped by %s: %d", reason, stats.Skipped[reason]))
+	}
+	return nil
+}
 
-	idx.spider = scraper.NewScraper(vis, &scraper.ConfigData{
+func scraperConfig(config *configs.ConfigData) *scraper.ConfigData {
+	return &scraper.ConfigData{
 		StartURLs:     	config.BaseURLs,
 		CacheCap: 		config.WorkersCount * 10,	
 		Depth:       	config.MaxDepth,
 		OnlySameDomain: config.OnlySameDomain,
-	}, idx.logger,
-		workerPool.NewWorkerPool(config.WorkersCount, config.TasksCount, global),
-		idx, global)
-	idx.spider.Run()
+		Recrawl: 		scraper.RecrawlPolicy{
+			Initial: 	time.Duration(config.RecrawlAfterHours) * time.Hour,
+			Min: 		time.Duration(max(config.RecrawlMinHours, 1)) * time.Hour,
+			Max: 		time.Duration(max(config.RecrawlMaxHours, config.RecrawlMinHours, 1)) * time.Hour,
+		},
+		ProductToken: 	config.ProductToken,
+		RobotsTTL: 		time.Duration(config.RobotsCacheHours) * time.Hour,
+		Retry: 			scraper.RetryPolicy{
+			Attempts: 	config.RetryAttempts,
+			BaseDelay: 	time.Duration(config.RetryBaseDelayMs) * time.Millisecond,
+			MaxDelay: 	time.Duration(config.MaxBackoffSeconds) * time.Second,
+			Jitter: 	config.RetryJitter,
+		},
+		Politeness: 	scraper.PolitenessConfig{
+			MaxConns: 		config.HostMaxConnections,
+			MinDelay: 		time.Duration(config.HostMinDelayMs) * time.Millisecond,
+			MaxBackoff: 	time.Duration(config.MaxBackoffSeconds) * time.Second,
+		},
+	}
+}
+
+func scopeRules(config configs.ScopeConfig) scraper.ScopeRules {
+	rules := scraper.ScopeRules{
+		Include: 		config.Include,
+		Exclude: 		config.Exclude,
+		StripParams: 	config.StripParams,
+	}
+	for _, seed := range config.Seeds {
+		rules.Seeds = append(rules.Seeds, scraper.SeedRules{
+			URL: 		seed.URL,
+			Domains: 	seed.Domains,
+			MaxDepth: 	seed.MaxDepth,
+			MaxPages: 	seed.MaxPages,
+		})
+	}
+	return rules
+}
+
+func (idx *indexer) IndexFromDir(config *configs.ConfigData, global context.Context, root, baseURL string) (scraper.IngestStats, error) { // без сети: html и документы из каталога
+	return idx.ingest(config, global, func(ws *scraper.WebScraper) (scraper.IngestStats, error) {
+		return ws.IngestDir(global, root, baseURL)
+	})
+}
+
+func (idx *indexer) IndexFromWARC(config *configs.ConfigData, global context.Context, path string) (scraper.IngestStats, error) {
+	return idx.ingest(config, global, func(ws *scraper.WebScraper) (scraper.IngestStats, error) {
+		return ws.IngestWARC(global, path)
+	})
+}
+
+func (idx *indexer) ingest(config *configs.ConfigData, global context.Context, run func(*scraper.WebScraper) (scraper.IngestStats, error)) (scraper.IngestStats, error) {
+	defer idx.repository.FlushAll()
+	if err := idx.PrepareHasher(); err != nil {
+		return scraper.IngestStats{}, err
+	}
+	defer idx.repository.SaveSaltArrays(idx.minHash.a, idx.minHash.b)
+
+	scfg := scraperConfig(config)
+	scfg.CacheCap = max(scfg.CacheCap, 1)
+	idx.spider = scraper.NewScraper(&sync.Map{}, scfg, idx.logger, nil, idx, global)
+	return run(idx.spider)
+}
+
+func (idx *indexer) PrepareHasher() error {
+	a, b, err := idx.repository.UploadSaltArrays()
+	if err != nil && err.Error() != "Key not found" {
+		return err
+	} else if err != nil {
+		if c, err := idx.repository.GetDocumentsCount(); err != nil {
+			return err
+		} else if c != 0 {
+			return fmt.Errorf("index isn't empty, but salt arrays is")
+		}
+		idx.minHash = NewHasher(a, b, true) // пересоздаем
+		return nil
+	}
+	idx.minHash = NewHasher(a, b, false) // просто получаем структуру
 	return nil
 }
 
@@ -120,4 +239,20 @@ func (idx *indexer) SaveUrlsToBank(key [32]byte, data []byte) error {
 
 func (idx *indexer) GetUrlsByHash(key [32]byte) ([]byte, error) {
 	return idx.repository.GetPageUrlsByHash(key)
-}
\ No newline at end of file
+}
+
+func (idx *indexer) SaveFetchMeta(key [32]byte, meta *model.FetchMeta) error {
+	return idx.repository.SaveFetchMeta(key, meta)
+}
+
+func (idx *indexer) GetFetchMeta(key [32]byte) (*model.FetchMeta, error) {
+	return idx.repository.GetFetchMeta(key)
+}
+
+func (idx *indexer) GetFetchSchedule() ([]*model.FetchMeta, error) {
+	return idx.repository.GetFetchSchedule()
+}
+
+func (idx *indexer) SaveFrontier(nodes []model.CrawlNode) error {
+	return idx.repository.SaveFrontier(nodes)
+}
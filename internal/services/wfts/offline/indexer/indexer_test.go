@@ -1,8 +1,18 @@
 package indexer
 
 import (
+	"context"
+	"crypto/sha256"
+	"io"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+
+	"wfts/configs"
+	"wfts/internal/model"
+	repos "wfts/internal/repository" // имя repository занято интерфейсом пакета
 )
 
 func TestWordHandlingFunction(t *testing.T) {
@@ -81,4 +91,128 @@ func TestHashSimilarity(t *testing.T) {
             }
         })
     }
-}
\ No newline at end of file
+}
+func TestReindexReplacesDocument(t *testing.T) {
+	ir, err := repos.NewIndexRepository(t.TempDir(), io.Discard, 20)
+	if err != nil {
+		t.Fatalf("NewIndexRepository(): %v", err)
+	}
+	defer ir.DB.Close()
+	idx := NewIndexer(ir, io.Discard, &configs.ConfigData{MaxTypo: 2, NGramCount: 3})
+	if err := idx.PrepareHasher(); err != nil {
+		t.Fatalf("PrepareHasher(): %v", err)
+	}
+
+	id := sha256.Sum256([]byte("example.com/changelog"))
+	versions := []string{
+		"release notes describe the parser rewrite and faster tokenizer",
+		"release notes describe the parser rewrite and faster tokenizer with streaming", // почти дубликат прошлой версии той же страницы
+	}
+	aliases := []string{"https://www.example.com/changelog", "https://example.com/changelog?utm_source=feed"} // вторая версия пришла по другому адресу
+	for i, text := range versions {
+		doc := &model.Document{Id: id, URL: "https://example.com/changelog", Text: text, Aliases: aliases[i:i + 1]}
+		if err := idx.HandleDocumentWords(doc, []model.Passage{{Text: text, Type: model.BodyType}}); err != nil {
+			t.Fatalf("HandleDocumentWords(%q): %v", text, err)
+		}
+	}
+
+	if c, _ := ir.GetDocumentsCount(); c != 1 {
+		t.Errorf("GetDocumentsCount() = %d, want 1", c)
+	}
+	for word, want := range map[string]int{"stream": 1, "parser": 1} {
+		postings, err := ir.GetDocumentsByWord(word)
+		if err != nil || len(postings) != 1 || postings[id].Count != want {
+			t.Errorf("GetDocumentsByWord(%q) = %v, %v", word, postings, err)
+		}
+	}
+	if doc, _ := ir.GetDocumentByID(id); doc == nil || doc.TokenCount != 8 || !reflect.DeepEqual(doc.Aliases, aliases) {
+		t.Errorf("reindexed document = %+v, want 8 tokens and aliases %q", doc, aliases)
+	}
+}
+
+func TestReindexDuplicateKeepsDocument(t *testing.T) {
+	ir, err := repos.NewIndexRepository(t.TempDir(), io.Discard, 20)
+	if err != nil {
+		t.Fatalf("NewIndexRepository(): %v", err)
+	}
+	defer ir.DB.Close()
+	idx := NewIndexer(ir, io.Discard, &configs.ConfigData{MaxTypo: 2, NGramCount: 3})
+	if err := idx.PrepareHasher(); err != nil {
+		t.Fatalf("PrepareHasher(): %v", err)
+	}
+
+	mirror := "release notes describe the parser rewrite and faster tokenizer"
+	index := func(url, text string) error {
+		doc := &model.Document{Id: sha256.Sum256([]byte(url)), URL: "https://" + url, Text: text}
+		return idx.HandleDocumentWords(doc, []model.Passage{{Text: text, Type: model.BodyType}})
+	}
+	if err := index("example.com/changelog", mirror); err != nil {
+		t.Fatalf("HandleDocumentWords(changelog): %v", err)
+	}
+	if err := index("example.com/news", "weekly news about conference talks and community meetups"); err != nil {
+		t.Fatalf("HandleDocumentWords(news): %v", err)
+	}
+	if err := index("example.com/news", mirror); err == nil || err.Error() != "page already indexed" { // новая версия повторяет другую страницу
+		t.Fatalf("HandleDocumentWords(news copy) = %v, want duplicate", err)
+	}
+
+	id := sha256.Sum256([]byte("example.com/news"))
+	if doc, err := ir.GetDocumentByID(id); err != nil || doc.URL != "https://example.com/news" {
+		t.Errorf("GetDocumentByID(news) = %+v, %v, want old version kept", doc, err)
+	}
+	if postings, err := ir.GetDocumentsByWord("meetup"); err != nil || postings[id].Count != 1 {
+		t.Errorf("GetDocumentsByWord(meetup) = %v, %v, want old version postings", postings, err)
+	}
+	if ir.IsDeleted(id) {
+		t.Errorf("IsDeleted(news) = true, want old version searchable")
+	}
+}
+
+func TestIndexFromDir(t *testing.T) { // детерминированный корпус без сети
+	site := t.TempDir()
+	files := map[string]string{
+		"index.html": 			"<html><head><title>Home</title></head><body><p>gradient boosting trees for tabular data</p><a href=\"docs/\">docs</a></body></html>",
+		"docs/index.html": 		"<html><body><h1>Documentation</h1><p>install the gradient library with a single command</p></body></html>",
+		"docs/faq.md": 			"# FAQ\n\nWhy are convolutional kernels rotated during backpropagation?\n",
+		"mirror.html": 			"<html><head><title>Home</title></head><body><p>gradient boosting trees for tabular data</p><a href=\"docs/\">docs</a></body></html>", // копия index.html, обходится после него
+		"logo.png": 			"\x89PNG",
+		".git/HEAD.html": 		"<p>ignored because of hidden directory</p>",
+	}
+	for name, body := range files {
+		p := filepath.Join(site, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ir, err := repos.NewIndexRepository(t.TempDir(), io.Discard, 20)
+	if err != nil {
+		t.Fatalf("NewIndexRepository(): %v", err)
+	}
+	defer ir.DB.Close()
+	cfg := &configs.ConfigData{MaxTypo: 2, NGramCount: 3, WorkersCount: 1, MaxDepth: 1}
+	stats, err := NewIndexer(ir, io.Discard, cfg).IndexFromDir(cfg, context.Background(), site, "https://docs.example/")
+	if err != nil {
+		t.Fatalf("IndexFromDir(): %v", err)
+	}
+	if stats.Indexed != 3 || stats.Duplicates != 1 {
+		t.Errorf("stats = %+v, want 3 indexed and 1 duplicate", stats)
+	}
+
+	urls := map[string]bool{}
+	docs, _ := ir.GetAllDocuments()
+	for _, doc := range docs {
+		urls[doc.URL] = true
+	}
+	for _, u := range []string{"https://docs.example/", "https://docs.example/docs/", "https://docs.example/docs/faq.md"} {
+		if !urls[u] {
+			t.Errorf("document %s is missing, indexed %v", u, urls)
+		}
+	}
+	if postings, _ := ir.GetDocumentsByWord("convolut"); len(postings) != 1 {
+		t.Errorf("markdown file is not searchable: %v", postings)
+	}
+}
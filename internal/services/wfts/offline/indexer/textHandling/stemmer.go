@@ -142,7 +142,7 @@ func (s *EnglishStemmer) TokenizeAndStem(text string) ([]string, []token, error)
 		if t.Type == WORD && len(t.Value) > 0 {
 			if stemmed := s.stem(t.Value); stemmed != "" { // пофиксить: не игнорировать стоп слова, их вполне можно использовать как кандидаты для замены, ну или нет, т.к. у них больше вероятность по цепям маркова
 				wordTokens = append(wordTokens, t.Value)
-				stemmedTokens = append(stemmedTokens, token{Type: WORD, Value: stemmed})
+				stemmedTokens = append(stemmedTokens, token{Type: WORD, Value: stemmed, startPos: t.startPos, endPos: t.endPos})
 			}
 		} else if t.Type != UNKNOWN && t.Type != WHITESPACE {
 			stemmedTokens = append(stemmedTokens, t)
@@ -28,6 +28,10 @@ type token struct {
 	endPos  	int
 }
 
+func (t token) Span() (int, int) { // байтовые смещения токена в исходном тексте
+	return t.startPos, t.endPos
+}
+
 type entityToken struct {
 	token
 	Priority int
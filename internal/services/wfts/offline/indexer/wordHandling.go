@@ -3,6 +3,8 @@ package indexer
 import (
 	"fmt"
 	"math"
+	"slices"
+	"strings"
 
 	"wfts/internal/services/wfts/offline/indexer/textHandling"
 	"wfts/internal/model"
@@ -16,6 +18,25 @@ func (idx *indexer) HandleDocumentWords(doc *model.Document, passages []model.Pa
 	idx.mu.Lock()
 	defer idx.mu.Unlock()
 
+	old, err := idx.repository.GetDocumentByID(doc.Id)
+	if err != nil {
+		if err.Error() != "Key not found" {
+			return err
+		}
+		old = nil
+	}
+	var oldSign *[128]uint64
+	if old != nil { // страница изменилась с прошлого обхода, старая версия не должна мешать проверке на дубликаты
+		doc.Aliases = mergeAliases(doc.URL, append(append(old.Aliases, doc.Aliases...), old.URL)) // страница могла прийти по другому адресу
+		terms, err := idx.repository.GetDocumentTerms(doc.Id)
+		if err != nil {
+			return err
+		}
+		if terms != nil {
+			oldSign = terms.Signature
+		}
+	}
+
 	allWordTokens := []string{}
 	for _, passage := range passages {
 		orig, stemmed, err := idx.stemmer.TokenizeAndStem(passage.Text)
@@ -38,17 +59,33 @@ func (idx *indexer) HandleDocumentWords(doc *model.Document, passages []model.Pa
 	}
 	doc.TokenCount = i
 
+	terms := &model.DocumentTerms{Stems: make([]string, 0, len(stem))}
+	for w := range stem {
+		terms.Stems = append(terms.Stems, w)
+	}
+
 	if len(allWordTokens) > 4 {
 		sign := idx.minHash.CreateSignature(allWordTokens)
 		conds, err := idx.repository.GetSimilarSignatures(sign)
 		if err != nil {
 			return err
 		}
-		if simRate := calcSim(sign, conds); simRate > 0.8 {
+		if oldSign != nil {
+			conds = slices.DeleteFunc(conds, func(c [128]uint64) bool { return c == *oldSign })
+		}
+		if simRate := calcSim(sign, conds); simRate > 0.8 { // дубликат другой страницы, старая версия остается в индексе
 			idx.logger.Debug(fmt.Sprintf("finded %f similar page: %s, with word tokens len: %d", simRate, doc.URL, len(allWordTokens)))
 			return fmt.Errorf("page already indexed")
 		}
-		if err := idx.repository.IndexDocShingles(sign); err != nil {
+		terms.Signature = &sign
+	}
+	if old != nil { // удаляется и старая сигнатура, поэтому до записи новой
+		if err := idx.repository.DeleteDocument(doc.Id); err != nil {
+			return err
+		}
+	}
+	if terms.Signature != nil {
+		if err := idx.repository.IndexDocShingles(*terms.Signature); err != nil {
 			return err
 		}
 	}
@@ -57,6 +94,7 @@ func (idx *indexer) HandleDocumentWords(doc *model.Document, passages []model.Pa
 	for j := 1; j < len(allWordTokens); j++ {
 		bigrams[[2]uint64{idx.minHash.Hash64(allWordTokens[j - 1]), idx.minHash.Hash64(allWordTokens[j])}]++
 	}
+	terms.Bigrams = bigrams
 	if err := idx.repository.UpdateBiFreq(bigrams); err != nil {
 		return err
 	}
@@ -64,6 +102,10 @@ func (idx *indexer) HandleDocumentWords(doc *model.Document, passages []model.Pa
 		idx.logger.Error("error saving document: " + err.Error())
 		return err
 	}
+	if err := idx.repository.SaveDocumentTerms(doc.Id, terms); err != nil {
+		idx.logger.Error("error saving document terms: " + err.Error())
+		return err
+	}
 	if err := idx.repository.IndexNGrams(allWordTokens, idx.sc.NGramCount); err != nil {
 		idx.logger.Error("error indexing ngrams: " + err.Error())
 		return err
@@ -76,30 +118,37 @@ func (idx *indexer) HandleDocumentWords(doc *model.Document, passages []model.Pa
 	return nil
 }
 
-func (idx *indexer) HandleTextQuery(text string) ([]string, []map[[32]byte]model.WordCountAndPositions, error) {
+func (idx *indexer) DeleteDocument(docID [32]byte) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.repository.DeleteDocument(docID)
+}
+
+func (idx *indexer) HandleTextQuery(text string) ([]string, []map[[32]byte]model.WordCountAndPositions, string, error) {
 	idx.mu.RLock()
 	defer idx.mu.RUnlock()
 	reverthIndex := []map[[32]byte]model.WordCountAndPositions{}
 	words, stemmed, err := idx.stemmer.TokenizeAndStem(text)
 	lenStem := len(stemmed)
 	if lenStem == 0 {
-		return nil, nil, fmt.Errorf("empty tokens")
+		return nil, nil, "", fmt.Errorf("empty tokens")
 	}
 	lenWords := len(words)
 	stemmedTokens := []string{}
 	wordPos := 0
 	isTwoWordCorrection := false
 	lastDoubleCorrPointer := lenStem
+	corrected := false
 
 	for i := 0; i < lenStem; i++ {
 		documents, err := idx.repository.GetDocumentsByWord(stemmed[i].Value)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, "", err
 		}
 		if len(documents) == 0 && stemmed[i].Type == textHandling.WORD { // исправляем только слова
 			conds, err := idx.repository.GetWordsByNGram(words[wordPos], idx.sc.NGramCount)
 			if err != nil {
-				return nil, nil, err
+				return nil, nil, "", err
 			}
 			lenCandidates := len(conds)
 			scores := make([][2]float64, lenCandidates)
@@ -118,14 +167,14 @@ func (idx *indexer) HandleTextQuery(text string) ([]string, []map[[32]byte]model
 					if left != 0 {
 						lscore, err = idx.repository.GetFreq(left, cond)
 						if err != nil {
-							return nil, nil, err
+							return nil, nil, "", err
 						}
 					}
 					rscore := 0
 					if right != 0 {
 						rscore, err = idx.repository.GetFreq(cond, right)
 						if err != nil {
-							return nil, nil, err
+							return nil, nil, "", err
 						}
 					}
 					scores[j][0], scores[j][1] = math.Log(float64(1 + lscore)), math.Log(float64(1 + rscore)) // снижаем зависимость результата от контекстуального совпадения
@@ -135,10 +184,11 @@ func (idx *indexer) HandleTextQuery(text string) ([]string, []map[[32]byte]model
 			tmpArr := make([]string, lenWords)
 			copy(tmpArr, words)
 			idx.sc.BestReplacement(&words, wordPos, conds, scores)
-			idx.logger.Debug(fmt.Sprintf("words '%s' replaced with '%s' in query", words, words))
+			idx.logger.Debug(fmt.Sprintf("words '%s' replaced with '%s' in query", tmpArr, words))
+			corrected = corrected || !slices.Equal(tmpArr, words)
 			_, stem, err := idx.stemmer.TokenizeAndStem(words[wordPos])
 			if err != nil {
-				return nil, nil, err
+				return nil, nil, "", err
 			}
 			if stem[0].Value == "" { // если заменяется на стоп слово
 				wordPos++
@@ -147,19 +197,19 @@ func (idx *indexer) HandleTextQuery(text string) ([]string, []map[[32]byte]model
 			stemmed[i] = stem[0]
 			documents, err = idx.repository.GetDocumentsByWord(stem[0].Value)
 			if err != nil {
-				return nil, nil, err
+				return nil, nil, "", err
 			}
 			if tmp > lenWords {
 				wordPos++
 				lenWords++
 				_, stem, err := idx.stemmer.TokenizeAndStem(words[wordPos])
 				if err != nil {
-					return nil, nil, err
+					return nil, nil, "", err
 				}
 				stemmed = append(stemmed, stem[0])
 				docs, err := idx.repository.GetDocumentsByWord(stem[0].Value)
 				if err != nil {
-					return nil, nil, err
+					return nil, nil, "", err
 				}
 				for k, v := range docs {
 					if _, ex := documents[k]; !ex {
@@ -184,7 +234,32 @@ func (idx *indexer) HandleTextQuery(text string) ([]string, []map[[32]byte]model
 		}
 	}
 
-	return stemmedTokens, reverthIndex, err
+	correctedQuery := ""
+	if corrected {
+		correctedQuery = strings.Join(words, " ")
+	}
+
+	return stemmedTokens, reverthIndex, correctedQuery, err
+}
+
+func (idx *indexer) PositionSpans(text string) [][2]int { // смещения в тексте для каждой позиции, в том же порядке что и в HandleDocumentWords
+	spans := [][2]int{}
+	offset := 0
+	for line := range strings.SplitAfterSeq(text, "\n") {
+		_, stemmed, err := idx.stemmer.TokenizeAndStem(line)
+		if err != nil {
+			break
+		}
+		for _, w := range stemmed {
+			if w.Type == textHandling.NUMBER || len(w.Value) > 64 {
+				continue
+			}
+			start, end := w.Span()
+			spans = append(spans, [2]int{offset + start, offset + end})
+		}
+		offset += len(line)
+	}
+	return spans
 }
 
 func calcSim(curSign [128]uint64, condidates [][128]uint64) float64 {
@@ -201,4 +276,22 @@ func calcSim(curSign [128]uint64, condidates [][128]uint64) float64 {
 		result = max(result, sim)
 	}
 	return result
+}
+
+const maxAliases = 32 // ссылки с разными трекинговыми метками не должны раздувать запись документа
+
+func mergeAliases(url string, aliases []string) []string {
+	seen := map[string]bool{url: true}
+	merged := make([]string, 0, len(aliases))
+	for _, alias := range aliases {
+		if alias == "" || seen[alias] || len(merged) >= maxAliases {
+			continue
+		}
+		seen[alias] = true
+		merged = append(merged, alias)
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+	return merged
 }
\ No newline at end of file
@@ -0,0 +1,158 @@
+package extractors
+
+import (
+	"bufio"
+	"bytes"
+	"mime"
+	"regexp"
+	"sort"
+	"strings"
+
+	"wfts/internal/model"
+)
+
+type Extractor interface {
+	Extract(body []byte) (*Result, error)
+}
+
+type Result struct {
+	Title 		string
+	Passages 	[]model.Passage
+}
+
+type Registry struct {
+	byType 		map[string]Extractor
+}
+
+func NewRegistry() *Registry { // text/html сюда не входит, его разбирает parseHTMLStream вместе со ссылками
+	r := &Registry{byType: make(map[string]Extractor)}
+	r.Register("text/plain", PlainText{})
+	r.Register("text/markdown", Markdown{})
+	r.Register("text/x-markdown", Markdown{})
+	r.Register("application/pdf", PDF{})
+	return r
+}
+
+func (r *Registry) Register(mimeType string, e Extractor) {
+	r.byType[strings.ToLower(mimeType)] = e
+}
+
+func (r *Registry) Lookup(contentType string) (Extractor, bool) { // принимает заголовок Content-Type целиком, с charset и прочими параметрами
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	e, ok := r.byType[mediaType]
+	return e, ok
+}
+
+func (r *Registry) Types() []string {
+	types := make([]string, 0, len(r.byType))
+	for t := range r.byType {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+type PlainText struct{}
+
+func (PlainText) Extract(body []byte) (*Result, error) { // абзацы разделены пустыми строками
+	res := &Result{}
+	for _, paragraph := range paragraphs(body) {
+		res.Passages = append(res.Passages, model.Passage{Text: strings.Join(paragraph, " "), Type: model.BodyType})
+	}
+	return res, nil
+}
+
+type Markdown struct{}
+
+var (
+	mdHeading 	= regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	mdImage 	= regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	mdLink 		= regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	mdEmphasis 	= regexp.MustCompile("[*_`~]+")
+	mdListMark 	= regexp.MustCompile(`^\s*([-*+]|\d+[.)])\s+`)
+)
+
+func (Markdown) Extract(body []byte) (*Result, error) {
+	res := &Result{}
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) != 0 {
+			res.Passages = append(res.Passages, model.Passage{Text: strings.Join(paragraph, " "), Type: model.BodyType})
+			paragraph = nil
+		}
+	}
+
+	inCode := false
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") { // код индексируется как есть, без разметки
+			flush()
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			if trimmed != "" {
+				paragraph = append(paragraph, trimmed)
+			}
+			continue
+		}
+		if m := mdHeading.FindStringSubmatch(trimmed); m != nil {
+			flush()
+			text := stripInline(m[2])
+			if text == "" {
+				continue
+			}
+			kind := byte(model.HeaderType)
+			if res.Title == "" && len(m[1]) == 1 { // первый заголовок первого уровня считается заголовком документа
+				res.Title, kind = text, model.TitleType
+			}
+			res.Passages = append(res.Passages, model.Passage{Text: text, Type: kind})
+			continue
+		}
+		if trimmed == "" || strings.Trim(trimmed, "-=*_ ") == "" { // пустая строка, разделитель или подчеркивание setext заголовка
+			flush()
+			continue
+		}
+		trimmed = strings.TrimLeft(trimmed, "> ")
+		trimmed = mdListMark.ReplaceAllString(trimmed, "")
+		if text := stripInline(trimmed); text != "" {
+			paragraph = append(paragraph, text)
+		}
+	}
+	flush()
+	return res, scanner.Err()
+}
+
+func stripInline(s string) string {
+	s = mdImage.ReplaceAllString(s, "$1")
+	s = mdLink.ReplaceAllString(s, "$1")
+	s = mdEmphasis.ReplaceAllString(s, "")
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func paragraphs(body []byte) [][]string {
+	var out [][]string
+	var cur []string
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		if line := strings.Join(strings.Fields(scanner.Text()), " "); line != "" {
+			cur = append(cur, line)
+			continue
+		}
+		if len(cur) != 0 {
+			out = append(out, cur)
+			cur = nil
+		}
+	}
+	if len(cur) != 0 {
+		out = append(out, cur)
+	}
+	return out
+}
@@ -0,0 +1,143 @@
+package extractors
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"wfts/internal/model"
+)
+
+func buildPDF(t *testing.T, info string, contents ...string) []byte { // минимальный файл: по сжатому потоку на страницу и словарь Info
+	t.Helper()
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	obj := 1
+	for _, content := range contents {
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		if _, err := zw.Write([]byte(content)); err != nil {
+			t.Fatalf("zlib: %v", err)
+		}
+		zw.Close()
+		fmt.Fprintf(&buf, "%d 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", obj, z.Len())
+		buf.Write(z.Bytes())
+		buf.WriteString("\nendstream\nendobj\n")
+		obj++
+	}
+	fmt.Fprintf(&buf, "%d 0 obj\n<< /Length 9 /Subtype /Image /Width 1 /Height 1 >>\nstream\n(BT Tj)\x00\x01\nendstream\nendobj\n", obj)
+	obj++
+	if info != "" {
+		fmt.Fprintf(&buf, "%d 0 obj\n<< /Title %s /Producer (test) >>\nendobj\n", obj, info)
+	}
+	buf.WriteString("trailer\n<< >>\n%%EOF\n")
+	return buf.Bytes()
+}
+
+func TestRegistryLookup(t *testing.T) {
+	r := NewRegistry()
+	tests := []struct {
+		contentType 	string
+		expected 		Extractor
+	}{
+		{"application/pdf", PDF{}},
+		{"Application/PDF; qs=0.001", PDF{}},
+		{"text/plain; charset=utf-8", PlainText{}},
+		{"text/markdown; charset=UTF-8; variant=GFM", Markdown{}},
+		{"text/x-markdown", Markdown{}},
+		{"text/html; charset=utf-8", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		e, ok := r.Lookup(tt.contentType)
+		if ok != (tt.expected != nil) || e != tt.expected {
+			t.Errorf("Lookup(%q) = %T, %t; want %T", tt.contentType, e, ok, tt.expected)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name 		string
+		extractor 	Extractor
+		body 		[]byte
+		title 		string
+		passages 	[]model.Passage
+	}{
+		{
+			name: "plain text paragraphs",
+			extractor: PlainText{},
+			body: []byte("Gradient descent\nconverges slowly.\n\n\n  Momentum   helps.\n"),
+			passages: []model.Passage{
+				{Text: "Gradient descent converges slowly.", Type: model.BodyType},
+				{Text: "Momentum helps.", Type: model.BodyType},
+			},
+		},
+		{
+			name: "markdown headings, lists and code",
+			extractor: Markdown{},
+			body: []byte("# Kernel *methods*\n\nSee [the paper](https://jmlr.org/p.pdf) and ![fig](f.png).\n\n## Setup ##\n- install `go`\n- run\n\n```go\nfmt.Println(\"hi\")\n```\n> quoted __text__\n---\n"),
+			title: "Kernel methods",
+			passages: []model.Passage{
+				{Text: "Kernel methods", Type: model.TitleType},
+				{Text: "See the paper and fig.", Type: model.BodyType},
+				{Text: "Setup", Type: model.HeaderType},
+				{Text: "install go run", Type: model.BodyType},
+				{Text: `fmt.Println("hi")`, Type: model.BodyType},
+				{Text: "quoted text", Type: model.BodyType},
+			},
+		},
+		{
+			name: "pdf text operators",
+			extractor: PDF{},
+			body: buildPDF(t, "(Sparse \\(Online\\) Learning)",
+				"BT /F1 12 Tf 72 720 Td (Sparse) Tj ( online) Tj 0 -14 Td [(learn)-20(ing)-400(with)] TJ T* (ef\\014cient) ' ET",
+				"q BI /W 1 /H 1 ID \x00\xff EI Q BT 1 0 0 1 72 700 Tm (Page) Tj 1 0 0 1 110 700 Tm (two) Tj 1 0 0 1 72 686 Tm <54776F> Tj <00410042> Tj ET"),
+			title: "Sparse (Online) Learning",
+			passages: []model.Passage{
+				{Text: "Sparse (Online) Learning", Type: model.TitleType},
+				{Text: "Sparse online", Type: model.BodyType},
+				{Text: "learning with", Type: model.BodyType},
+				{Text: "efficient", Type: model.BodyType},
+				{Text: "Page two", Type: model.BodyType},
+				{Text: "Two", Type: model.BodyType},
+			},
+		},
+		{
+			name: "pdf utf-16 title",
+			extractor: PDF{},
+			body: buildPDF(t, "<FEFF00500043004100200433>", "BT (x) Tj ET"),
+			title: "PCA г",
+			passages: []model.Passage{{Text: "PCA г", Type: model.TitleType}, {Text: "x", Type: model.BodyType}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := tt.extractor.Extract(tt.body)
+			if err != nil {
+				t.Fatalf("Extract(): %v", err)
+			}
+			if res.Title != tt.title {
+				t.Errorf("title = %q, want %q", res.Title, tt.title)
+			}
+			if !reflect.DeepEqual(res.Passages, tt.passages) {
+				t.Errorf("passages = %q, want %q", res.Passages, tt.passages)
+			}
+		})
+	}
+}
+
+func TestPDFRejectsGarbage(t *testing.T) {
+	for _, body := range [][]byte{
+		[]byte("<html><body>not a pdf</body></html>"),
+		buildPDF(t, "", "q 1 0 0 1 0 0 cm Q"), // только графика, текста нет
+		buildPDF(t, "(Scanned)", "q 612 0 0 792 0 0 cm /Im0 Do Q"), // один заголовок из Info - тоже пусто
+	} {
+		if _, err := (PDF{}).Extract(body); err == nil {
+			t.Errorf("Extract(%.20q) accepted a document without text", body)
+		}
+	}
+}
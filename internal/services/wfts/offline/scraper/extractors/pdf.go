@@ -0,0 +1,462 @@
+package extractors
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"wfts/internal/model"
+)
+
+// PDF достает текст из потоков содержимого без разбора xref: потоки ищутся по ключевым словам stream/endstream,
+// поэтому битые таблицы ссылок не мешают. Двухбайтовые шрифты с CID и ToUnicode не поддерживаются, их строки пропускаются.
+type PDF struct{}
+
+const maxStreamSize = 64 << 20
+
+var (
+	pdfLength 	= regexp.MustCompile(`/Length\s+(\d+)(\s+\d+\s+R)?`)
+	pdfSkipDict = regexp.MustCompile(`/Subtype\s*/(Image|Type1C|CIDFontType0C|OpenType|XML)|/Type\s*/(XRef|Metadata|EmbeddedFile)|/Length[123]\b`)
+	pdfFilter 	= regexp.MustCompile(`/(\w+Decode)\b`)
+	pdfTitle 	= regexp.MustCompile(`/Title\s*([(<])`)
+)
+
+func (PDF) Extract(body []byte) (*Result, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(body, "\x00\t\r\n "), []byte("%PDF-")) {
+		return nil, errors.New("not a pdf document")
+	}
+	res := &Result{Title: pdfInfoTitle(body)}
+	titled := res.Title != ""
+	if titled {
+		res.Passages = append(res.Passages, model.Passage{Text: res.Title, Type: model.TitleType})
+	}
+	for _, s := range pdfStreams(body) {
+		if pdfSkipDict.Match(s.dict) {
+			continue
+		}
+		data, err := s.decode()
+		if err != nil {
+			continue // фильтр не поддерживается или поток поврежден, остальные страницы все равно читаются
+		}
+		if bytes.Contains(s.dict, []byte("/ObjStm")) { // сжатые объекты, там может лежать словарь Info
+			if res.Title == "" {
+				res.Title = pdfInfoTitle(data)
+			}
+			continue
+		}
+		if bytes.Contains(data, []byte("begincmap")) {
+			continue
+		}
+		for _, line := range contentText(data) {
+			res.Passages = append(res.Passages, model.Passage{Text: line, Type: model.BodyType})
+		}
+	}
+	if len(res.Passages) == 0 || (titled && len(res.Passages) == 1) {
+		return nil, errors.New("no extractable text in pdf")
+	}
+	return res, nil
+}
+
+type pdfStream struct {
+	dict 	[]byte
+	data 	[]byte
+}
+
+func pdfStreams(body []byte) []pdfStream {
+	var streams []pdfStream
+	for pos := 0; ; {
+		i := bytes.Index(body[pos:], []byte("stream"))
+		if i < 0 {
+			break
+		}
+		i += pos
+		pos = i + len("stream")
+		if i >= 3 && string(body[i - 3:i]) == "end" {
+			continue
+		}
+		start := pos
+		if start < len(body) && body[start] == '\r' {
+			start++
+		}
+		if start >= len(body) || body[start] != '\n' {
+			continue
+		}
+		start++
+
+		objStart := bytes.LastIndex(body[:i], []byte("obj"))
+		if objStart < 0 {
+			continue
+		}
+		dict := body[objStart:i]
+
+		end := -1
+		if m := pdfLength.FindSubmatch(dict); m != nil && m[2] == nil { // длина прямым числом, иначе ищем endstream
+			if n, err := strconv.Atoi(string(m[1])); err == nil && start + n <= len(body) &&
+				bytes.HasPrefix(bytes.TrimLeft(body[start + n:], "\r\n \t"), []byte("endstream")) {
+				end = start + n
+			}
+		}
+		if end < 0 {
+			e := bytes.Index(body[start:], []byte("endstream"))
+			if e < 0 {
+				break
+			}
+			end = start + e
+			for end > start && (body[end - 1] == '\n' || body[end - 1] == '\r') {
+				end--
+			}
+		}
+		streams = append(streams, pdfStream{dict: dict, data: body[start:end]})
+		pos = end
+	}
+	return streams
+}
+
+func (s pdfStream) decode() ([]byte, error) {
+	filters := pdfFilter.FindAllSubmatch(s.dict, -1)
+	switch {
+	case len(filters) == 0:
+		return s.data, nil
+	case len(filters) == 1 && string(filters[0][1]) == "FlateDecode":
+		zr, err := zlib.NewReader(bytes.NewReader(s.data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		data, err := io.ReadAll(io.LimitReader(zr, maxStreamSize))
+		if err != nil && len(data) == 0 { // у многих генераторов поток обрезан без контрольной суммы, прочитанного хватает
+			return nil, err
+		}
+		return data, nil
+	default:
+		return nil, errors.New("unsupported pdf filter")
+	}
+}
+
+func pdfInfoTitle(body []byte) string {
+	loc := pdfTitle.FindSubmatchIndex(body)
+	if loc == nil {
+		return ""
+	}
+	lx := &pdfLexer{data: body, pos: loc[2]}
+	tok := lx.next()
+	if tok.kind != tokString {
+		return ""
+	}
+	raw := tok.str
+	if len(raw) >= 2 && raw[0] == 0xfe && raw[1] == 0xff { // UTF-16BE с BOM
+		u := make([]uint16, 0, len(raw) / 2)
+		for i := 2; i + 1 < len(raw); i += 2 {
+			u = append(u, uint16(raw[i]) << 8 | uint16(raw[i + 1]))
+		}
+		return strings.Join(strings.Fields(string(utf16.Decode(u))), " ")
+	}
+	return strings.Join(strings.Fields(decodePDFString(raw)), " ")
+}
+
+func contentText(data []byte) []string { // строки текста в порядке операторов показа
+	var lines []string
+	var line strings.Builder
+	newLine := func() {
+		if text := strings.Join(strings.Fields(line.String()), " "); text != "" {
+			lines = append(lines, text)
+		}
+		line.Reset()
+	}
+	space := func() {
+		if line.Len() != 0 {
+			line.WriteByte(' ')
+		}
+	}
+
+	show := func(tok pdfToken) {
+		if tok.kind != tokString || (tok.hex && bytes.IndexByte(tok.str, 0) >= 0) { // нули в hex строке - коды CID, без ToUnicode их не прочитать
+			return
+		}
+		line.WriteString(decodePDFString(tok.str))
+	}
+
+	var operands []pdfToken
+	lastY, haveY := 0.0, false
+	lx := &pdfLexer{data: data}
+	for {
+		tok := lx.next()
+		if tok.kind == tokEOF {
+			break
+		}
+		if tok.kind != tokOperator {
+			operands = append(operands, tok)
+			continue
+		}
+		switch tok.op {
+		case "BT":
+			haveY = false
+		case "ET":
+			newLine()
+		case "Td", "TD":
+			if len(operands) >= 2 && operands[len(operands) - 1].num != 0 {
+				newLine()
+			} else {
+				space()
+			}
+		case "T*":
+			newLine()
+		case "Tm":
+			if len(operands) >= 6 {
+				y := operands[len(operands) - 1].num
+				if haveY && y != lastY {
+					newLine()
+				} else {
+					space()
+				}
+				lastY, haveY = y, true
+			}
+		case "Tj":
+			if n := len(operands); n >= 1 {
+				show(operands[n - 1])
+			}
+		case "'", "\"":
+			newLine()
+			if n := len(operands); n >= 1 {
+				show(operands[n - 1])
+			}
+		case "TJ":
+			if n := len(operands); n >= 1 && operands[n - 1].kind == tokArray {
+				for _, el := range operands[n - 1].arr {
+					switch {
+					case el.kind == tokString:
+						show(el)
+					case el.kind == tokNumber && el.num < -200: // сдвиг больше пятой части em - пробел между словами
+						line.WriteByte(' ')
+					}
+				}
+			}
+		case "BI":
+			lx.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+	newLine()
+	return lines
+}
+
+var texLigatures = map[byte]string{0x0b: "ff", 0x0c: "fi", 0x0d: "fl", 0x0e: "ffi", 0x0f: "ffl"} // кодировка OT1 у pdfTeX
+
+var winAnsi = map[byte]rune{0x91: '\'', 0x92: '\'', 0x93: '"', 0x94: '"', 0x95: '•', 0x96: '-', 0x97: '-', 0x85: '…', 0xad: '-'}
+
+func decodePDFString(raw []byte) string {
+	var sb strings.Builder
+	for _, b := range raw {
+		if lig, ok := texLigatures[b]; ok {
+			sb.WriteString(lig)
+			continue
+		}
+		if r, ok := winAnsi[b]; ok {
+			sb.WriteRune(r)
+			continue
+		}
+		switch {
+		case b == '\t' || b == '\n' || b == '\r':
+			sb.WriteByte(' ')
+		case b < 0x20 || (b >= 0x7f && b < 0xa0):
+		default:
+			sb.WriteRune(rune(b)) // Latin-1 для остального
+		}
+	}
+	return sb.String()
+}
+
+const (
+	tokEOF = iota
+	tokNumber
+	tokString
+	tokName
+	tokArray
+	tokOperator
+	tokOther
+)
+
+type pdfToken struct {
+	kind 	int
+	num 	float64
+	str 	[]byte
+	hex 	bool
+	op 		string
+	arr 	[]pdfToken
+}
+
+type pdfLexer struct {
+	data 	[]byte
+	pos 	int
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
+
+func (lx *pdfLexer) next() pdfToken {
+	for lx.pos < len(lx.data) {
+		c := lx.data[lx.pos]
+		if isPDFSpace(c) {
+			lx.pos++
+			continue
+		}
+		if c == '%' {
+			for lx.pos < len(lx.data) && lx.data[lx.pos] != '\n' && lx.data[lx.pos] != '\r' {
+				lx.pos++
+			}
+			continue
+		}
+		break
+	}
+	if lx.pos >= len(lx.data) {
+		return pdfToken{kind: tokEOF}
+	}
+
+	c := lx.data[lx.pos]
+	switch {
+	case c == '(':
+		return pdfToken{kind: tokString, str: lx.literal()}
+	case c == '<' && lx.pos + 1 < len(lx.data) && lx.data[lx.pos + 1] == '<':
+		lx.pos += 2
+		return pdfToken{kind: tokOther}
+	case c == '>' && lx.pos + 1 < len(lx.data) && lx.data[lx.pos + 1] == '>':
+		lx.pos += 2
+		return pdfToken{kind: tokOther}
+	case c == '<':
+		return pdfToken{kind: tokString, str: lx.hex(), hex: true}
+	case c == '[':
+		lx.pos++
+		arr := []pdfToken{}
+		for {
+			tok := lx.next()
+			if tok.kind == tokEOF || (tok.kind == tokOther && tok.op == "]") {
+				return pdfToken{kind: tokArray, arr: arr}
+			}
+			arr = append(arr, tok)
+		}
+	case c == ']':
+		lx.pos++
+		return pdfToken{kind: tokOther, op: "]"}
+	case c == '/':
+		lx.pos++
+		return pdfToken{kind: tokName, str: lx.regular()}
+	case isPDFDelimiter(c):
+		lx.pos++
+		return pdfToken{kind: tokOther}
+	}
+
+	word := lx.regular()
+	if n, err := strconv.ParseFloat(string(word), 64); err == nil {
+		return pdfToken{kind: tokNumber, num: n}
+	}
+	return pdfToken{kind: tokOperator, op: string(word)}
+}
+
+func (lx *pdfLexer) regular() []byte {
+	start := lx.pos
+	for lx.pos < len(lx.data) && !isPDFSpace(lx.data[lx.pos]) && !isPDFDelimiter(lx.data[lx.pos]) {
+		lx.pos++
+	}
+	if lx.pos == start { // одиночный неизвестный байт, чтобы не зациклиться
+		lx.pos++
+	}
+	return lx.data[start:lx.pos]
+}
+
+func (lx *pdfLexer) literal() []byte {
+	lx.pos++ // (
+	var out []byte
+	depth := 1
+	for lx.pos < len(lx.data) {
+		c := lx.data[lx.pos]
+		lx.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return out
+			}
+		case '\\':
+			if lx.pos >= len(lx.data) {
+				return out
+			}
+			e := lx.data[lx.pos]
+			lx.pos++
+			switch e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b', 'f':
+			case '\r':
+				if lx.pos < len(lx.data) && lx.data[lx.pos] == '\n' {
+					lx.pos++
+				}
+			case '\n':
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				v := int(e - '0')
+				for k := 0; k < 2 && lx.pos < len(lx.data) && lx.data[lx.pos] >= '0' && lx.data[lx.pos] <= '7'; k++ {
+					v = v * 8 + int(lx.data[lx.pos] - '0')
+					lx.pos++
+				}
+				out = append(out, byte(v))
+			default:
+				out = append(out, e)
+			}
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func (lx *pdfLexer) hex() []byte {
+	lx.pos++ // <
+	var digits []byte
+	for lx.pos < len(lx.data) && lx.data[lx.pos] != '>' {
+		if c := lx.data[lx.pos]; (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F') {
+			digits = append(digits, c)
+		}
+		lx.pos++
+	}
+	lx.pos++ // >
+	if len(digits) % 2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits) / 2)
+	for i := range out {
+		v, _ := strconv.ParseUint(string(digits[2 * i:2 * i + 2]), 16, 8)
+		out[i] = byte(v)
+	}
+	return out
+}
+
+func (lx *pdfLexer) skipInlineImage() { // BI ... ID <двоичные данные> EI
+	if i := bytes.Index(lx.data[lx.pos:], []byte("ID")); i >= 0 {
+		lx.pos += i + 2
+	}
+	for lx.pos < len(lx.data) {
+		i := bytes.Index(lx.data[lx.pos:], []byte("EI"))
+		if i < 0 {
+			lx.pos = len(lx.data)
+			return
+		}
+		lx.pos += i + 2
+		if i > 0 && isPDFSpace(lx.data[lx.pos - 3]) && (lx.pos >= len(lx.data) || isPDFSpace(lx.data[lx.pos])) {
+			return
+		}
+	}
+}
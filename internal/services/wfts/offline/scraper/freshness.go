@@ -0,0 +1,156 @@
+package scraper
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"wfts/internal/model"
+)
+
+type RecrawlPolicy struct {
+	Initial 	time.Duration // 0 - посещенные страницы больше не запрашиваются
+	Min 		time.Duration
+	Max 		time.Duration
+}
+
+type sitemapHint struct {
+	changeFreq 	string
+	lastMod 	time.Time
+}
+
+var changeFreqIntervals = map[string]time.Duration{
+	"hourly": 	time.Hour,
+	"daily": 	24 * time.Hour,
+	"weekly": 	7 * 24 * time.Hour,
+	"monthly": 	30 * 24 * time.Hour,
+	"yearly": 	365 * 24 * time.Hour,
+}
+
+func (p RecrawlPolicy) next(prev *model.FetchMeta, changed bool, changeFreq string) time.Duration { // интервал сжимается вдвое после изменения и растет в полтора раза, пока страница стоит на месте
+	interval := p.Initial
+	switch {
+	case prev != nil && prev.Interval > 0:
+		interval = prev.Interval
+		if changed {
+			interval /= 2
+		} else {
+			interval = interval * 3 / 2
+		}
+	case changeFreq == "always":
+		interval = p.Min
+	case changeFreq == "never":
+		interval = p.Max
+	case changeFreqIntervals[changeFreq] > 0:
+		interval = changeFreqIntervals[changeFreq]
+	}
+	return min(max(interval, p.Min), p.Max)
+}
+
+func (ws *WebScraper) isDue(meta *model.FetchMeta, norm string, now time.Time) bool {
+	next := meta.NextFetchAt
+	if next.IsZero() { // записи до появления расписания
+		next = meta.FetchedAt.Add(ws.cfg.Recrawl.Initial)
+	}
+	if !now.Before(next) {
+		return true
+	}
+	h, ok := ws.hints.Load(norm)
+	return ok && h.(sitemapHint).lastMod.After(meta.FetchedAt) // sitemap сообщает об изменении раньше срока
+}
+
+func (ws *WebScraper) saveFetch(hashed [32]byte, cur *url.URL, norm string, depth int, prev, fetched *model.FetchMeta, changed bool) {
+	hint := sitemapHint{}
+	if h, ok := ws.hints.Load(norm); ok {
+		hint = h.(sitemapHint)
+	}
+	fetched.URL, fetched.Depth, fetched.ChangeFreq = cur.String(), depth, hint.changeFreq
+	if prev != nil {
+		if prev.URL != "" {
+			fetched.Depth = min(prev.Depth, depth)
+		}
+		fetched.Checks, fetched.Changes = prev.Checks, prev.Changes
+		if fetched.DocID == [32]byte{} { // страница не переиндексировалась
+			fetched.DocID = prev.DocID
+		}
+	}
+	fetched.Checks++
+	if changed {
+		fetched.Changes++
+	}
+	fetched.Interval = ws.cfg.Recrawl.next(prev, changed, hint.changeFreq)
+	fetched.NextFetchAt = fetched.FetchedAt.Add(fetched.Interval)
+	if err := ws.idx.SaveFetchMeta(hashed, fetched); err != nil {
+		ws.log.Error(fmt.Sprintf("error saving fetch meta: %s, with error: %v", cur, err))
+	}
+}
+
+func parseLastMod(s string) (time.Time, bool) { // W3C datetime, как в протоколе sitemaps
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04Z07:00", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (ws *WebScraper) Watch() { // первый обход от стартовых ссылок, затем повторные обходы страниц по расписанию до отмены контекста
+	if ws.cfg.Recrawl.Initial <= 0 { // recrawl_after_hours = 0: ни одна страница не станет due, ждать нечего
+		ws.log.Warn("recrawl is disabled, watch runs a single crawl")
+		ws.Run()
+		return
+	}
+	stop := ws.startCheckpoints()
+	ws.submitSeeds()
+	submitted := map[string]time.Time{}
+	for {
+		ws.pool.Wait()
+		due, wait := ws.dueSchedule(time.Now(), submitted)
+		if len(due) != 0 {
+			ws.log.Info(fmt.Sprintf("recrawling %d pages", len(due)))
+			for _, meta := range due {
+				submitted[meta.URL] = time.Now()
+				ws.submitScheduled(meta)
+			}
+			continue
+		}
+		ws.log.Debug(fmt.Sprintf("next recrawl in %v", wait))
+		select {
+		case <-ws.globalCtx.Done():
+			ws.pool.Stop()
+			stop()
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (ws *WebScraper) dueSchedule(now time.Time, submitted map[string]time.Time) ([]*model.FetchMeta, time.Duration) {
+	wait := ws.cfg.Recrawl.Min
+	schedule, err := ws.idx.GetFetchSchedule()
+	if err != nil {
+		ws.log.Error("error loading recrawl schedule: " + err.Error())
+		return nil, wait
+	}
+	due := []*model.FetchMeta{}
+	for _, meta := range schedule {
+		if meta.Depth >= ws.cfg.Depth {
+			continue
+		}
+		if at, ok := submitted[meta.URL]; ok && now.Sub(at) < ws.cfg.Recrawl.Min { // страница не ответила или не изменила расписание, не долбим ее по кругу
+			continue
+		}
+		norm, err := normalizeUrl(meta.URL)
+		if err != nil {
+			continue
+		}
+		if !ws.isDue(meta, norm, now) {
+			wait = min(wait, meta.NextFetchAt.Sub(now))
+			continue
+		}
+		due = append(due, meta)
+	}
+	return due, max(wait, time.Minute)
+}
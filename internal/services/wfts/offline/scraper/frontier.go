@@ -0,0 +1,68 @@
+package scraper
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"wfts/internal/model"
+)
+
+func (ws *WebScraper) interrupt(node model.CrawlNode) {
+	if norm, err := normalizeUrl(node.URL); err == nil {
+		// иначе после перезапуска страница отсеется как посещенная, а ее ссылки так и не попадут в очередь
+		if depth, ok := ws.visited.Load(norm); ok && depth.(int) >= node.Depth {
+			ws.visited.Delete(norm)
+		}
+	}
+	node.Activation = nil
+	ws.frMu.Lock()
+	ws.interrupted = append(ws.interrupted, node)
+	ws.frMu.Unlock()
+}
+
+func (ws *WebScraper) startCheckpoints() func() { // периодически сохраняет очередь на случай падения, остановка сохраняет оборванные задачи
+	done := make(chan struct{})
+	wg := new(sync.WaitGroup)
+	if ws.cfg.Checkpoint > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tic := time.NewTicker(ws.cfg.Checkpoint)
+			defer tic.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ws.globalCtx.Done(): // пул сейчас разгребает очередь вхолостую, снимок был бы неполным
+					return
+				case <-tic.C:
+					ws.saveFrontier(ws.pool.Frontier())
+				}
+			}
+		}()
+	}
+	return func() {
+		close(done)
+		wg.Wait()
+		ws.frMu.Lock()
+		nodes := ws.interrupted
+		ws.interrupted = nil
+		ws.frMu.Unlock()
+		ws.saveFrontier(nodes) // обход завершился сам - очередь пустая и сохраненная очищается
+	}
+}
+
+func (ws *WebScraper) saveFrontier(nodes []model.CrawlNode) {
+	kept := make([]model.CrawlNode, 0, len(nodes))
+	for _, node := range nodes {
+		if node.Depth < ws.cfg.Scope.maxDepth(node.Seed, ws.cfg.Depth) {
+			kept = append(kept, node)
+		}
+	}
+	if err := ws.idx.SaveFrontier(kept); err != nil {
+		ws.log.Error("error saving crawl frontier: " + err.Error())
+		return
+	}
+	ws.log.Debug(fmt.Sprintf("crawl frontier saved, %d links", len(kept)))
+}
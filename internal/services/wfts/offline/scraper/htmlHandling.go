@@ -2,31 +2,62 @@ package scraper
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
 	"time"
 
 	"wfts/internal/model"
+	"wfts/internal/services/wfts/offline/scraper/extractors"
 	"golang.org/x/net/html"
 )
 
 type linkToken struct {
 	Link 		*url.URL
 	SameDomain 	bool
+	Priority 	int // из sitemap, у ссылок со страниц 0
 }
 
+type pageMeta struct {
+	Title 		string
+	Description string
+	OpenGraph 	map[string]string
+	Text 		string
+	Canonical 	string // <link rel="canonical">, абсолютный
+	Robots 		[]string // content из <meta name="robots"> и <meta name="product token">
+}
+
+const (
+	maxTextLen = 32 << 10
+	maxDocumentSize = 32 << 20 // pdf и прочие документы читаются целиком, без построчного сканера
+	maxErrorBodySize = 64 << 10
+)
+
 func (ws *WebScraper) fetchHTMLcontent(cur *url.URL, ctx context.Context, norm string, gd int) ([]*linkToken, error) {
-	ws.rlMu.RLock()
-	rl := ws.rlMap[cur.Host]
-	ws.rlMu.RUnlock()
-	doc, err := ws.getHTML(cur.String(), rl, numOfTries)
+	hashed := sha256.Sum256([]byte(norm))
+	prev, err := ws.idx.GetFetchMeta(hashed)
+	if err != nil {
+		ws.log.Error(fmt.Sprintf("error getting fetch meta: %s, with error: %v", cur, err)) // не критично, страница скачается целиком
+	}
+	doc, fetched, err := ws.getHTML(cur.String(), prev)
+	if errors.Is(err, errNotModified) || (err == nil && prev != nil && fetched.ContentHash == prev.ContentHash) {
+		ws.log.Debug("page not modified since last crawl: " + cur.String())
+		fetched.SkipReason = prev.SkipReason // страница заново не разбиралась
+		ws.saveFetch(hashed, cur, norm, gd, prev, fetched, false)
+		return ws.storedLinks(hashed)
+	}
     if err != nil {
 		ws.log.Error(fmt.Sprintf("error getting html: %s, with error: %v", cur, err))
+		if se := (*statusError)(nil); errors.As(err, &se) && se.gone() {
+			ws.dropDocument(hashed, prev, cur)
+		}
         return nil, err
     }
 	if doc == "" {
@@ -34,33 +65,37 @@ func (ws *WebScraper) fetchHTMLcontent(cur *url.URL, ctx context.Context, norm s
         return nil, fmt.Errorf("empty html content on page: %s", cur)
 	}
 	
-	hashed := sha256.Sum256([]byte(norm))
-    document := &model.Document{
-        Id: hashed,
-        URL: cur.String(),
-    }
-
-	c, cancel := context.WithTimeout(ctx, deadlineTime)
-	defer cancel()
-    links, passages := ws.parseHTMLStream(c, doc, cur, gd)
-	if len(links) != 0 {
-		ws.lru.Put(hashed, links)
+	links, err := ws.indexPage(ctx, cur, hashed, doc, gd, fetched)
+	if err == nil || err.Error() == "page already indexed" || errors.Is(err, errNoIndex) { // дубликат и noindex тоже незачем перекачивать до следующего обхода
+		ws.saveFetch(hashed, cur, norm, gd, prev, fetched, prev != nil)
 	}
-
-	return links, ws.idx.HandleDocumentWords(document, passages)
+	if errors.Is(err, errNoIndex) {
+		return links, nil
+	}
+	return links, err
 }
 
-func (ws *WebScraper) parseHTMLStream(ctx context.Context, htmlContent string, baseURL *url.URL, currentDeep int) (links []*linkToken, pasages []model.Passage) {
+func (ws *WebScraper) parseHTMLStream(ctx context.Context, htmlContent string, baseURL *url.URL, currentDeep int) (links []*linkToken, pasages []model.Passage, meta pageMeta) {
 	tokenizer := html.NewTokenizer(strings.NewReader(htmlContent))
 	var tagStack [][2]byte
 	var garbageTagStack []string
-	var rawTextBuilder strings.Builder 
+	var titleBuilder strings.Builder
+	inTitle := false
+	defer func() {
+		meta.Title = strings.Join(strings.Fields(titleBuilder.String()), " ")
+		if meta.Description == "" {
+			meta.Description = meta.OpenGraph["og:description"]
+		}
+		if meta.Title == "" {
+			meta.Title = meta.OpenGraph["og:title"]
+		}
+		meta.Text = compactText(pasages, maxTextLen)
+	}()
 	links = make([]*linkToken, 0)
 	visit := make([]*linkToken, 0)
 
-	ws.rlMu.RLock()
-	rules := ws.rulesMap[truncatePort(baseURL)]
-	ws.rlMu.RUnlock()
+	rules := ws.cachedRobots(baseURL) // ссылки на другие хосты проверяются по их robots.txt перед загрузкой
+	seed := seedOf(ctx)
 
 	tokenCount := 0
 	const checkContextEvery = 10
@@ -88,6 +123,14 @@ func (ws *WebScraper) parseHTMLStream(ctx context.Context, htmlContent string, b
 		}
 
 		switch tokenType {
+		case html.SelfClosingTagToken:
+			switch t := tokenizer.Token(); strings.ToLower(t.Data) {
+			case "meta":
+				readMeta(t, ws.token, &meta)
+			case "link":
+				readCanonical(t, baseURL, &meta)
+			}
+
 		case html.StartTagToken:
 			if len(garbageTagStack) > 0 {
 				continue
@@ -96,6 +139,15 @@ func (ws *WebScraper) parseHTMLStream(ctx context.Context, htmlContent string, b
 			t := tokenizer.Token()
 			tagName := strings.ToLower(t.Data)
 			switch tagName {
+			case "title":
+				inTitle = titleBuilder.Len() == 0 // <title> внутри svg не должен перетирать заголовок страницы
+
+			case "meta":
+				readMeta(t, ws.token, &meta)
+
+			case "link":
+				readCanonical(t, baseURL, &meta)
+
 			case "h1", "h2":
 				tagStack = append(tagStack, [2]byte{'h', tagName[1]})
 
@@ -111,6 +163,10 @@ func (ws *WebScraper) parseHTMLStream(ctx context.Context, htmlContent string, b
 				}
 
 			case "a":
+				if slices.ContainsFunc(t.Attr, func(attr html.Attribute) bool { return strings.ToLower(attr.Key) == "rel" && relNoFollow(attr.Val) }) {
+					ws.stats.skip(SkipRelNoFollow)
+					break
+				}
 				for _, attr := range t.Attr {
 					if strings.ToLower(attr.Key) == "href" {
 						link, err := makeAbsoluteURL(attr.Val, baseURL)
@@ -118,20 +174,22 @@ func (ws *WebScraper) parseHTMLStream(ctx context.Context, htmlContent string, b
 							break
 						}
 						if link != "" {
-							normalized, err := normalizeUrl(link)
-							if err != nil {
-								ws.log.Error(fmt.Sprintf("error normalizing url: %s, with error: %v", link, err))
-								break
-							}
 							uri, err := url.Parse(link)
 							if err != nil || uri == nil {
 								ws.log.Error("error parsing link: " + err.Error())
 								break
 							}
-							if rules != nil {
-								if !rules.IsAllowed(userAgent, uri.Path) {
-									break
-								}
+							ws.cfg.Scope.stripParams(uri)
+							if !ws.cfg.Scope.allows(uri, seed) {
+								break
+							}
+							normalized, err := normalizeUrl(uri.String())
+							if err != nil {
+								ws.log.Error(fmt.Sprintf("error normalizing url: %s, with error: %v", link, err))
+								break
+							}
+							if uri.Host == baseURL.Host && !rules.IsAllowed(ws.token, uri.RequestURI()) {
+								break
 							}
 							same := isSameOrigin(uri, baseURL)
 							if depth, vis := ws.visited.Load(normalized); vis {
@@ -154,6 +212,9 @@ func (ws *WebScraper) parseHTMLStream(ctx context.Context, htmlContent string, b
 		case html.EndTagToken:
 			t := tokenizer.Token()
 			tagName := strings.ToLower(t.Data)
+			if tagName == "title" {
+				inTitle = false
+			}
 			if tagName[0] == 'h' {
 				if len(tagStack) > 0 && len(tagName) > 1 && tagStack[len(tagStack)-1][1] == tagName[1] {
 					tagStack = tagStack[:len(tagStack)-1]
@@ -169,10 +230,18 @@ func (ws *WebScraper) parseHTMLStream(ctx context.Context, htmlContent string, b
 				continue
 			}
 
+			if inTitle {
+				text := strings.TrimSpace(string(tokenizer.Text()))
+				if text != "" {
+					titleBuilder.WriteString(text + " ")
+					pasages = append(pasages, model.NewTypeTextObj[model.Passage](model.TitleType, text, 0))
+				}
+				continue
+			}
+
 			if len(tagStack) > 0 {
 				text := strings.TrimSpace(string(tokenizer.Text()))
 				if text != "" {
-					rawTextBuilder.WriteString(text)
 					pasages = append(pasages, model.NewTypeTextObj[model.Passage](model.HeaderType, text, 0))
 				}
 				continue
@@ -180,7 +249,6 @@ func (ws *WebScraper) parseHTMLStream(ctx context.Context, htmlContent string, b
 
 			text := strings.TrimSpace(string(tokenizer.Text()))
 			if text != "" {
-				rawTextBuilder.WriteString(text)
 				pasages = append(pasages, model.NewTypeTextObj[model.Passage](model.BodyType, text, 0))
 			}
 
@@ -192,55 +260,303 @@ func (ws *WebScraper) parseHTMLStream(ctx context.Context, htmlContent string, b
 	return
 }
 
-func (ws *WebScraper) getHTML(URL string, rl *rateLimiter, try int) (string, error) {
-	if try <= 0 {
-		return "", fmt.Errorf("http status code: 419, and max amount of tries was reached")
+var errNoIndex = errors.New("noindex")
+
+func (ws *WebScraper) indexPage(ctx context.Context, cur *url.URL, hashed [32]byte, doc string, gd int, fetched *model.FetchMeta) ([]*linkToken, error) { // разбор и индексация уже полученной страницы, общая для обхода и загрузки из файлов
+	c, cancel := context.WithTimeout(ctx, deadlineTime)
+	defer cancel()
+	ctype := fetched.ContentType
+	var aliases []string
+	if n := len(fetched.Redirects); n > 1 {
+		if final, err := url.Parse(fetched.Redirects[n - 1]); err == nil { // ссылки разрешаются от итогового адреса
+			cur, aliases = final, fetched.Redirects[:n - 1]
+			if finalNorm, err := normalizeUrl(final.String()); err == nil {
+				ws.visited.LoadOrStore(finalNorm, gd) // по ссылке на итоговый адрес страница второй раз не скачивается
+			}
+		}
+	}
+	var links []*linkToken
+	var passages []model.Passage
+	var meta pageMeta
+	if e, ok := ws.extractors.Lookup(ctype); ok {
+		var err error
+		if passages, meta, err = extractDocument(e, doc); err != nil {
+			ws.log.Error(fmt.Sprintf("error extracting %s: %s, with error: %v", ctype, cur, err))
+			return nil, err
+		}
+	} else {
+		links, passages, meta = ws.parseHTMLStream(c, doc, cur, gd)
+	}
+	var header, page robotsDirectives
+	for _, tag := range fetched.RobotsTag {
+		d := parseRobotsDirectives(tag, ws.token)
+		header.noIndex, header.noFollow = header.noIndex || d.noIndex, header.noFollow || d.noFollow
+	}
+	for _, content := range meta.Robots {
+		d := parseRobotsDirectives(content, "")
+		page.noIndex, page.noFollow = page.noIndex || d.noIndex, page.noFollow || d.noFollow
+	}
+	if header.noFollow || page.noFollow {
+		ws.skipPage(fetched, SkipNoFollow)
+		ws.log.Debug("not following links of nofollow page: " + cur.String())
+		links = nil
+	}
+
+	canonical, docID, aliases := ws.canonicalize(cur, meta.Canonical, append(aliases, cur.String()))
+    document := &model.Document{
+        Id: docID,
+        URL: canonical,
+		Title: meta.Title,
+		Description: meta.Description,
+		OpenGraph: meta.OpenGraph,
+		Text: meta.Text,
+		Aliases: aliases,
+    }
+	if len(links) != 0 {
+		ws.lru.Put(hashed, links)
+	}
+	if header.noIndex || page.noIndex {
+		reason := SkipNoIndex
+		if header.noIndex {
+			reason = SkipXRobotsNoIndex
+		}
+		ws.skipPage(fetched, reason)
+		ws.log.Debug(fmt.Sprintf("not indexing page: %s, reason: %s", cur, reason))
+		if err := ws.idx.DeleteDocument(docID); err != nil && err.Error() != "Key not found" { // страница могла быть проиндексирована до появления noindex
+			ws.log.Error(fmt.Sprintf("error deleting noindex document: %s, with error: %v", cur, err))
+		}
+		return links, errNoIndex
+	}
+	ws.dropAliases(docID, aliases) // до проверки на дубликаты, иначе старая копия под адресом синонима не пустит каноническую страницу
+	if err := ws.idx.HandleDocumentWords(document, passages); err != nil {
+		return links, err
+	}
+	fetched.DocID = docID
+	return links, nil
+}
+
+func extractDocument(e extractors.Extractor, body string) ([]model.Passage, pageMeta, error) { // ссылок у таких документов нет, обход на них заканчивается
+	res, err := e.Extract([]byte(body))
+	if err != nil {
+		return nil, pageMeta{}, err
+	}
+	return res.Passages, pageMeta{Title: res.Title, Text: compactText(res.Passages, maxTextLen)}, nil
+}
+
+func readMeta(t html.Token, token string, meta *pageMeta) {
+	var key, content string
+	for _, attr := range t.Attr {
+		switch strings.ToLower(attr.Key) {
+		case "name", "property":
+			key = strings.ToLower(strings.TrimSpace(attr.Val))
+		case "content":
+			content = strings.TrimSpace(attr.Val)
+		}
+	}
+	if key == "" || content == "" {
+		return
+	}
+	switch {
+	case key == "description":
+		meta.Description = content
+	case key == "robots" || key == strings.ToLower(token):
+		meta.Robots = append(meta.Robots, content)
+	case strings.HasPrefix(key, "og:"):
+		if meta.OpenGraph == nil {
+			meta.OpenGraph = make(map[string]string)
+		}
+		meta.OpenGraph[key] = content
+	}
+}
+
+func readCanonical(t html.Token, base *url.URL, meta *pageMeta) {
+	if meta.Canonical != "" {
+		return
+	}
+	var href string
+	canonical := false
+	for _, attr := range t.Attr {
+		switch strings.ToLower(attr.Key) {
+		case "rel":
+			for _, rel := range strings.Fields(strings.ToLower(attr.Val)) {
+				canonical = canonical || rel == "canonical"
+			}
+		case "href":
+			href = attr.Val
+		}
+	}
+	if !canonical {
+		return
+	}
+	if abs, err := makeAbsoluteURL(href, base); err == nil {
+		meta.Canonical = abs
+	}
+}
+
+func compactText(passages []model.Passage, limit int) string { // по строке на пассаж, чтобы повторная токенизация совпадала с позициями в индексе
+	var sb strings.Builder
+	for _, passage := range passages {
+		line := strings.Join(strings.Fields(passage.Text), " ")
+		if sb.Len() + len(line) + 1 > limit {
+			break
+		}
+		sb.WriteString(line)
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+type statusError struct {
+	Code 		int
+	RetryAfter 	string // заголовок ответа, пауза перед повтором
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("non-200 status code: %d", e.Code)
+}
+
+func (e *statusError) gone() bool { // страницы больше нет, держать ее в индексе незачем
+	return e.Code == http.StatusNotFound || e.Code == http.StatusGone
+}
+
+func (ws *WebScraper) dropDocument(hashed [32]byte, prev *model.FetchMeta, cur *url.URL) {
+	docID := hashed
+	if prev != nil && prev.DocID != [32]byte{} { // документ лежит под итоговым url редиректа или rel=canonical
+		docID = prev.DocID
+	}
+	if err := ws.idx.DeleteDocument(docID); err != nil {
+		if err.Error() != "Key not found" {
+			ws.log.Error(fmt.Sprintf("error deleting document: %s, with error: %v", cur, err))
+		}
+		return
 	}
+	ws.lru.Delete(hashed)
+	ws.log.Info("deleted missing page from index: " + cur.String())
+}
+
+var errNotModified = errors.New("not modified")
+
+func (ws *WebScraper) getHTML(URL string, prev *model.FetchMeta) (string, *model.FetchMeta, error) {
+	var doc string
+	var fetched *model.FetchMeta
+	err := ws.withRetry(ws.globalCtx, URL, func() error {
+		var err error
+		doc, fetched, err = ws.fetchDocument(URL, prev)
+		return err
+	})
+	return doc, fetched, err
+}
 
+func (ws *WebScraper) fetchDocument(URL string, prev *model.FetchMeta) (string, *model.FetchMeta, error) { // одна попытка, повторы в getHTML
 	req, err := http.NewRequest("GET", URL, nil)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
-	req.Header.Set("User-Agent", userAgent)
-	req.Header.Set("Accept", "text/html")
+	req.Header.Set("User-Agent", ws.userAgent)
+	req.Header.Set("Accept", "text/html, " + strings.Join(ws.extractors.Types(), ", "))
+	if prev != nil {
+		if prev.ETag != "" {
+			req.Header.Set("If-None-Match", prev.ETag)
+		}
+		if prev.LastModified != "" {
+			req.Header.Set("If-Modified-Since", prev.LastModified)
+		}
+	}
 
-	rl.GetToken(ws.globalCtx) // не должно ложить приложение, но в целом по желанию
+	host := req.URL.Host
+	if err := ws.polite.Acquire(ws.globalCtx, host); err != nil {
+		return "", nil, err
+	}
 	resp, err := ws.client.Do(req)
 	if err != nil {
-		return "", err
+		ws.polite.Release(host, 0, "")
+		return "", nil, err
 	}
 	defer resp.Body.Close()
+	defer ws.polite.Release(host, resp.StatusCode, resp.Header.Get("Retry-After"))
+
+	fetched := &model.FetchMeta{
+		ETag: 			resp.Header.Get("ETag"),
+		LastModified: 	resp.Header.Get("Last-Modified"),
+		FetchedAt: 		time.Now(),
+		ContentType: 	resp.Header.Get("Content-Type"),
+		Redirects: 		redirectChain(resp),
+		RobotsTag: 		resp.Header.Values("X-Robots-Tag"),
+	}
+	if resp.StatusCode == http.StatusNotModified && prev != nil {
+		fetched.ContentHash = prev.ContentHash
+		if fetched.ETag == "" { // 304 не обязан повторять валидаторы
+			fetched.ETag = prev.ETag
+		}
+		if fetched.LastModified == "" {
+			fetched.LastModified = prev.LastModified
+		}
+		if fetched.ContentType == "" {
+			fetched.ContentType = prev.ContentType
+		}
+		ws.archiveResponse(URL, resp, nil)
+		return "", fetched, errNotModified
+	}
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		if resp.StatusCode == http.StatusTooManyRequests && !ws.checkContext(ws.globalCtx, URL) {
-			<-time.After(deadlineTime)
-			return ws.getHTML(URL, rl, try-1)
-		} else {
-			return "", fmt.Errorf("non-200 status code: %d", resp.StatusCode)
+		if ws.cfg.Archive != nil {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+			ws.archiveResponse(URL, resp, body)
 		}
+		return "", nil, &statusError{Code: resp.StatusCode, RetryAfter: resp.Header.Get("Retry-After")}
 	}
 
 	if ws.checkContext(ws.globalCtx, URL) {
-		return "", fmt.Errorf("context canceled")
+		return "", nil, fmt.Errorf("context canceled")
 	}
 
-	ctype := resp.Header.Get("Content-Type")
+	ctype := fetched.ContentType
 	if !strings.Contains(strings.ToLower(ctype), "text/html") {
-		return "", fmt.Errorf("unsupported content type: %s", ctype)
+		if _, ok := ws.extractors.Lookup(ctype); !ok {
+			return "", nil, fmt.Errorf("unsupported content type: %s", ctype)
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxDocumentSize + 1))
+		if err != nil {
+			return "", nil, err
+		}
+		if len(body) > maxDocumentSize { // обрезанный pdf не разобрать, а неполный текст испортил бы индекс
+			ws.log.Warn(fmt.Sprintf("document is larger than %d bytes, skipped: %s", maxDocumentSize, URL))
+			return "", nil, fmt.Errorf("document too large: %s", URL)
+		}
+		ws.archiveResponse(URL, resp, body)
+		fetched.ContentHash = sha256.Sum256(body)
+		return string(body), fetched, nil
 	}
 
+	raw, err := io.ReadAll(resp.Body) // html, как и раньше, читается целиком: лимит документов молча обрезал бы страницу
+	if err != nil {
+		return "", nil, err
+	}
+	ws.archiveResponse(URL, resp, raw)
+
 	var builder strings.Builder
-	scanner := bufio.NewScanner(resp.Body)
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
 	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
 
 	for scanner.Scan() {
 		select {
 		case <-ws.globalCtx.Done():
-			return builder.String(), nil
+			fetched.ContentHash = sha256.Sum256([]byte(builder.String()))
+			return builder.String(), fetched, nil
 		default:
 			builder.WriteString(scanner.Text())
 		}
 	}
-	return builder.String(), scanner.Err()
-}
\ No newline at end of file
+	fetched.ContentHash = sha256.Sum256([]byte(builder.String()))
+	return builder.String(), fetched, scanner.Err()
+}
+
+func (ws *WebScraper) archiveResponse(URL string, resp *http.Response, body []byte) { // ответ в WARC как есть, чтобы переиндексировать без повторного обхода
+	if ws.cfg.Archive == nil {
+		return
+	}
+	if err := ws.cfg.Archive.WriteResponse(URL, resp, body); err != nil {
+		ws.log.Error(fmt.Sprintf("error writing warc record: %s, with error: %v", URL, err))
+	}
+}
@@ -0,0 +1,217 @@
+package scraper
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"wfts/internal/model"
+	"wfts/internal/utils/warc"
+)
+
+var fileTypes = map[string]string{
+	".html": 		"text/html",
+	".htm": 		"text/html",
+	".xhtml": 		"text/html",
+	".md": 			"text/markdown",
+	".markdown": 	"text/markdown",
+	".txt": 		"text/plain",
+	".pdf": 		"application/pdf",
+}
+
+type IngestStats struct {
+	Indexed 	int
+	Duplicates 	int
+	Skipped 	int // неподдерживаемый тип, не 2xx ответ, noindex или ошибка разбора
+}
+
+func (ws *WebScraper) IngestDir(ctx context.Context, root, baseURL string) (IngestStats, error) { // url документа - baseURL плюс путь файла относительно root
+	stats := IngestStats{}
+	base, err := dirBaseURL(root, baseURL)
+	if err != nil {
+		return stats, err
+	}
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ws.checkContext(ctx, p) {
+			return ctx.Err()
+		}
+		if d.IsDir() {
+			if p != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ctype, ok := fileTypes[strings.ToLower(filepath.Ext(p))]
+		if !ok {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		body, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		ws.ingest(ctx, base.JoinPath(filePathToURL(rel)), string(body), &model.FetchMeta{ContentType: ctype}, &stats)
+		return nil
+	})
+	return stats, err
+}
+
+func dirBaseURL(root, baseURL string) (*url.URL, error) {
+	if baseURL == "" { // ./site -> https://site/
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+		baseURL = "https://" + strings.ToLower(filepath.Base(abs)) + "/"
+	}
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("base url must be absolute: %s", baseURL)
+	}
+	return base, nil
+}
+
+func filePathToURL(rel string) string { // docs/index.html -> docs/, как отдал бы веб-сервер
+	rel = filepath.ToSlash(rel)
+	if name := path.Base(rel); name == "index.html" || name == "index.htm" {
+		return strings.TrimSuffix(rel, name)
+	}
+	return rel
+}
+
+func (ws *WebScraper) IngestWARC(ctx context.Context, name string) (IngestStats, error) { // файл или каталог с архивами, например warc_dir прошлых обходов
+	stats := IngestStats{}
+	info, err := os.Stat(name)
+	if err != nil {
+		return stats, err
+	}
+	if !info.IsDir() {
+		err = ws.ingestWARCFile(ctx, name, &stats)
+		return stats, err
+	}
+
+	files, err := os.ReadDir(name) // отсортированы по имени, а имена у ротации идут по порядку записи
+	if err != nil {
+		return stats, err
+	}
+	for _, f := range files {
+		if f.IsDir() || !(strings.HasSuffix(f.Name(), ".warc") || strings.HasSuffix(f.Name(), ".warc.gz")) {
+			continue
+		}
+		if err := ws.ingestWARCFile(ctx, filepath.Join(name, f.Name()), &stats); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+func (ws *WebScraper) ingestWARCFile(ctx context.Context, name string, stats *IngestStats) error { // response записи как HTTP ответы, resource записи как готовые документы
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	wr, err := warc.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer wr.Close()
+
+	for {
+		if ws.checkContext(ctx, name) {
+			return ctx.Err()
+		}
+		rec, err := wr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		cur, err := url.Parse(rec.TargetURI())
+		if err != nil || cur.Host == "" {
+			continue
+		}
+		switch rec.Type() {
+		case "response":
+			body, header, err := warcResponse(rec)
+			if err != nil {
+				ws.log.Debug(fmt.Sprintf("skipping warc response for %s: %v", cur, err))
+				stats.Skipped++
+				continue
+			}
+			ws.ingest(ctx, cur, body, &model.FetchMeta{ContentType: header.Get("Content-Type"), RobotsTag: header.Values("X-Robots-Tag")}, stats)
+		case "resource":
+			ws.ingest(ctx, cur, string(rec.Block), &model.FetchMeta{ContentType: rec.Header.Get("Content-Type")}, stats)
+		}
+	}
+}
+
+func warcResponse(rec *warc.Record) (string, http.Header, error) {
+	resp, err := rec.HTTPResponse()
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", nil, &statusError{Code: resp.StatusCode}
+	}
+	var body io.Reader = resp.Body
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") { // в WARC тело лежит как пришло по сети
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return "", nil, err
+		}
+		defer zr.Close()
+		body = zr
+	}
+	data, err := io.ReadAll(io.LimitReader(body, maxDocumentSize))
+	return string(data), resp.Header, err
+}
+
+func (ws *WebScraper) ingest(ctx context.Context, cur *url.URL, body string, fetched *model.FetchMeta, stats *IngestStats) { // из fetched нужны только Content-Type и X-Robots-Tag
+	if fetched.ContentType == "" {
+		fetched.ContentType = http.DetectContentType([]byte(body))
+	}
+	if _, ok := ws.extractors.Lookup(fetched.ContentType); !ok && !strings.Contains(strings.ToLower(fetched.ContentType), "text/html") {
+		stats.Skipped++
+		return
+	}
+	norm, err := normalizeUrl(cur.String())
+	if err != nil {
+		stats.Skipped++
+		return
+	}
+	_, err = ws.indexPage(ctx, cur, sha256.Sum256([]byte(norm)), body, 0, fetched)
+	switch {
+	case err == nil:
+		stats.Indexed++
+	case err.Error() == "page already indexed":
+		stats.Duplicates++
+	case errors.Is(err, errNoIndex):
+		stats.Skipped++
+	default:
+		ws.log.Error(fmt.Sprintf("error indexing %s, with error: %v", cur, err))
+		stats.Skipped++
+	}
+}
@@ -63,6 +63,15 @@ func (lru *LRUCache) Put(key [32]byte, value any) {
 	lru.insert(newNode(key, value))
 }
 
+func (lru *LRUCache) Delete(key [32]byte) {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	if v, ex := lru.mp[key]; ex {
+		lru.remove(v)
+	}
+}
+
 func (lru *LRUCache) remove(node *node) {
 	delete(lru.mp, node.key)
 	node.prev.next = node.next
@@ -0,0 +1,185 @@
+package scraper
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type PolitenessConfig struct {
+	MaxConns 		int // одновременных запросов к хосту, 0 - один
+	MinDelay 		time.Duration // между началами запросов к хосту, Crawl-delay из robots.txt может его увеличить
+	MaxBackoff 		time.Duration // потолок паузы после 429/503, 0 - 10 минут
+}
+
+const (
+	minBackoff = 5 * time.Second
+	defaultMaxBackoff = 10 * time.Minute
+)
+
+type clock interface { // в тестах подменяется, чтобы не ждать реальные задержки
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+type hostState struct {
+	active 		int
+	next 		time.Time // раньше этого запрос к хосту не начинается
+	crawlDelay 	time.Duration
+	backoff 	time.Duration // растет на 429/503 и тает после успешных ответов
+	waiters 	[]chan struct{} // очередь ждущих свободного соединения
+}
+
+type politeness struct { // планировщик вежливости: своя очередь у каждого хоста, ждут сами воркеры, отдельных горутин нет
+	cfg 		PolitenessConfig
+	clock 		clock
+	mu 			*sync.Mutex
+	hosts 		map[string]*hostState
+}
+
+func newPoliteness(cfg PolitenessConfig, c clock) *politeness {
+	if cfg.MaxConns <= 0 {
+		cfg.MaxConns = 1
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = defaultMaxBackoff
+	}
+	return &politeness{
+		cfg: 		cfg,
+		clock: 		c,
+		mu: 		new(sync.Mutex),
+		hosts: 		make(map[string]*hostState),
+	}
+}
+
+func (p *politeness) host(name string) *hostState {
+	h := p.hosts[name]
+	if h == nil {
+		h = &hostState{}
+		p.hosts[name] = h
+	}
+	return h
+}
+
+func (p *politeness) interval(h *hostState) time.Duration {
+	return max(p.cfg.MinDelay, h.crawlDelay, h.backoff)
+}
+
+func (p *politeness) Acquire(ctx context.Context, host string) error { // после успеха обязателен Release
+	p.mu.Lock()
+	h := p.host(host)
+	for {
+		now := p.clock.Now()
+		if h.active < p.cfg.MaxConns && !now.Before(h.next) {
+			h.active++
+			h.next = now.Add(p.interval(h))
+			p.mu.Unlock()
+			return nil
+		}
+
+		var slot chan struct{}
+		var wake <-chan time.Time
+		if h.active >= p.cfg.MaxConns {
+			slot = make(chan struct{}, 1)
+			h.waiters = append(h.waiters, slot)
+		} else {
+			wake = p.clock.After(h.next.Sub(now))
+		}
+		p.mu.Unlock()
+
+		select {
+		case <-slot:
+		case <-wake:
+		case <-ctx.Done():
+			p.mu.Lock()
+			select {
+			case <-slot: // освобожденное соединение достается следующему в очереди
+				p.wakeNext(h)
+			default:
+				h.dropWaiter(slot)
+			}
+			p.mu.Unlock()
+			return ctx.Err()
+		}
+		p.mu.Lock()
+	}
+}
+
+func (p *politeness) Release(host string, status int, retryAfter string) { // status 0 - ответа нет, задержки не меняются
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h := p.host(host)
+	if h.active > 0 {
+		h.active--
+	}
+	now := p.clock.Now()
+	switch {
+	case status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable:
+		h.backoff = min(max(2 * h.backoff, 2 * max(p.cfg.MinDelay, h.crawlDelay), minBackoff), p.cfg.MaxBackoff)
+		pause := h.backoff
+		if d := parseRetryAfter(retryAfter, now); d > 0 {
+			pause = min(d, p.cfg.MaxBackoff)
+		}
+		if next := now.Add(pause); next.After(h.next) {
+			h.next = next
+		}
+	case status != 0 && h.backoff > 0:
+		if h.backoff /= 2; h.backoff < minBackoff {
+			h.backoff = 0
+		}
+	}
+	p.wakeNext(h)
+}
+
+func (p *politeness) SetCrawlDelay(host string, d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.host(host).crawlDelay = d
+}
+
+func (p *politeness) readyAt(host string) time.Time { // когда к хосту можно обратиться в следующий раз
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.host(host).next
+}
+
+func (p *politeness) wakeNext(h *hostState) {
+	if len(h.waiters) == 0 {
+		return
+	}
+	w := h.waiters[0]
+	h.waiters = h.waiters[1:]
+	w <- struct{}{}
+}
+
+func (h *hostState) dropWaiter(slot chan struct{}) {
+	for i, w := range h.waiters {
+		if w == slot {
+			h.waiters = append(h.waiters[:i], h.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+func parseRetryAfter(value string, now time.Time) time.Duration { // секунды или HTTP дата, RFC 9110 10.2.3
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(secs) * time.Second, 0)
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0)
+	}
+	return 0
+}
@@ -0,0 +1,130 @@
+package scraper
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"wfts/internal/utils/parser"
+)
+
+type RetryPolicy struct {
+	Attempts 	int // всего попыток вместе с первой, 0 - numOfTries
+	BaseDelay 	time.Duration // пауза перед второй попыткой, дальше удваивается
+	MaxDelay 	time.Duration // 0 - defaultMaxBackoff
+	Jitter 		float64 // доля паузы, которая случайно срезается, 0..1, чтобы воркеры не повторяли хором
+}
+
+type RetryError struct { // попытки кончились, Err - ошибка последней
+	URL 		string
+	Attempts 	int
+	Err 		error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("%s: giving up after %d attempts: %v", e.URL, e.Attempts, e.Err)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+func (p RetryPolicy) attempts() int {
+	if p.Attempts <= 0 {
+		return numOfTries
+	}
+	return p.Attempts
+}
+
+func (p RetryPolicy) delay(attempt int, retryAfter time.Duration, random float64) time.Duration { // attempt - номер неудачной попытки, с 1
+	maxDelay := p.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = defaultMaxBackoff
+	}
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < maxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, maxDelay)
+	d -= time.Duration(float64(d) * min(max(p.Jitter, 0), 1) * random)
+	if retryAfter > d { // сервер сам сказал, сколько ждать
+		d = min(retryAfter, maxDelay)
+	}
+	return d
+}
+
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooEarly, http.StatusTooManyRequests,
+		http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func errorStatus(err error) (int, string, bool) { // код и Retry-After из ошибки ответа страницы, карты сайта или robots.txt
+	if se := (*statusError)(nil); errors.As(err, &se) {
+		return se.Code, se.RetryAfter, true
+	}
+	if pe := (*parser.StatusError)(nil); errors.As(err, &pe) {
+		return pe.Code, pe.RetryAfter, true
+	}
+	return 0, "", false
+}
+
+func retryable(err error) bool { // временные сбои: 408/425/429/5xx шлюзов, таймауты, оборванные соединения
+	if code, _, ok := errorStatus(err); ok {
+		return retryableStatus(code)
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &certErr) || errors.As(err, &unknownAuthority) || errors.As(err, &hostnameErr) {
+		return false
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return !dnsErr.IsNotFound && (dnsErr.IsTimeout || dnsErr.IsTemporary)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE)
+}
+
+func (ws *WebScraper) withRetry(ctx context.Context, URL string, fetch func() error) error { // общая для страниц, robots.txt и карт сайта
+	attempts := ws.cfg.Retry.attempts()
+	for attempt := 1; ; attempt++ {
+		ws.stats.requests.Add(1)
+		err := fetch()
+		if err == nil || !retryable(err) {
+			return err
+		}
+		if attempt >= attempts {
+			ws.stats.gaveUp.Add(1)
+			return &RetryError{URL: URL, Attempts: attempt, Err: err}
+		}
+		_, header, _ := errorStatus(err)
+		wait := ws.cfg.Retry.delay(attempt, parseRetryAfter(header, ws.clock.Now()), rand.Float64())
+		ws.stats.retries.Add(1)
+		ws.log.Info(fmt.Sprintf("attempt %d/%d failed: %s, with error: %v, retrying in %s", attempt, attempts, URL, err, wait))
+		select {
+		case <-ws.clock.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
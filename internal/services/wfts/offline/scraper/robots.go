@@ -0,0 +1,136 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"wfts/internal/utils/parser"
+)
+
+const (
+	defaultProductToken = "wfts"
+	defaultRobotsTTL = 24 * time.Hour // RFC 9309 не советует держать robots.txt в кэше дольше суток
+	unreachableRobotsTTL = 10 * time.Minute // при 5xx хост закрыт, но проверяется снова раньше
+)
+
+type robotsEntry struct {
+	done 		chan struct{} // закрывается, когда загрузка закончена, остальные воркеры хоста ждут ее
+	rules 		*parser.RobotsTxt
+	expires 	time.Time
+}
+
+func userAgentHeader(token string) string {
+	return "Mozilla/5.0 (compatible; " + token + "/1.0)"
+}
+
+func (ws *WebScraper) robotsFor(ctx context.Context, cur *url.URL) *parser.RobotsTxt { // robots.txt хоста из кэша, загружается один раз на хост и срок жизни
+	origin := cur.Scheme + "://" + cur.Host
+	now := time.Now()
+	ws.rbMu.Lock()
+	entry := ws.robots[origin]
+	if entry != nil {
+		select {
+		case <-entry.done:
+			if now.After(entry.expires) {
+				entry = nil
+			}
+		default:
+		}
+	}
+	if entry != nil {
+		ws.rbMu.Unlock()
+		select {
+		case <-entry.done:
+			return entry.rules
+		case <-ctx.Done():
+			return parser.DisallowAll()
+		}
+	}
+	entry = &robotsEntry{done: make(chan struct{})}
+	ws.robots[origin] = entry
+	ws.rbMu.Unlock()
+
+	ttl := ws.cfg.RobotsTTL
+	if ttl <= 0 {
+		ttl = defaultRobotsTTL
+	}
+	var rules *parser.RobotsTxt
+	err := ws.withRetry(ctx, origin + "/robots.txt", func() error {
+		if err := ws.polite.Acquire(ctx, cur.Host); err != nil {
+			rules = parser.DisallowAll()
+			return err
+		}
+		var err error
+		rules, err = parser.FetchRobotsTxt(ctx, origin, ws.userAgent, ws.client)
+		code, header, _ := errorStatus(err)
+		ws.polite.Release(cur.Host, code, header)
+		return err
+	})
+	if err != nil {
+		ws.log.Debug(fmt.Sprintf("robots.txt unreachable for %s, host is disallowed: %v", origin, err))
+		ttl = min(ttl, unreachableRobotsTTL)
+	}
+	entry.rules, entry.expires = rules, now.Add(ttl)
+	close(entry.done)
+
+	ws.polite.SetCrawlDelay(cur.Host, time.Duration(rules.CrawlDelay(ws.token)) * time.Second)
+	return rules
+}
+
+func (ws *WebScraper) cachedRobots(cur *url.URL) *parser.RobotsTxt { // без загрузки: для фильтра ссылок при разборе, nil - правил еще нет
+	ws.rbMu.Lock()
+	entry := ws.robots[cur.Scheme + "://" + cur.Host]
+	ws.rbMu.Unlock()
+	if entry == nil {
+		return nil
+	}
+	select {
+	case <-entry.done:
+		return entry.rules
+	default:
+		return nil
+	}
+}
+
+type robotsDirectives struct { // <meta name="robots"> и X-Robots-Tag
+	noIndex 	bool
+	noFollow 	bool
+}
+
+var valuedDirectives = map[string]bool{"unavailable_after": true, "max-snippet": true, "max-image-preview": true, "max-video-preview": true}
+
+func parseRobotsDirectives(value, token string) robotsDirectives { // "googlebot: noindex, nofollow" относится только к googlebot, пустой token - агент не проверяется
+	var d robotsDirectives
+	applies := true
+	for _, part := range strings.Split(strings.ToLower(value), ",") {
+		part = strings.TrimSpace(part)
+		if name, rest, ok := strings.Cut(part, ":"); ok && !valuedDirectives[strings.TrimSpace(name)] {
+			applies = token == "" || strings.TrimSpace(name) == strings.ToLower(token)
+			part = strings.TrimSpace(rest)
+		}
+		if !applies {
+			continue
+		}
+		switch part {
+		case "noindex":
+			d.noIndex = true
+		case "nofollow":
+			d.noFollow = true
+		case "none":
+			d.noIndex, d.noFollow = true, true
+		}
+	}
+	return d
+}
+
+func relNoFollow(rel string) bool {
+	for _, r := range strings.Fields(strings.ToLower(rel)) {
+		if r == "nofollow" {
+			return true
+		}
+	}
+	return false
+}
\ No newline at end of file
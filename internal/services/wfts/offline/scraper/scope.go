@@ -0,0 +1,210 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+type ScopeRules struct {
+	Include 	[]string // glob по всему url или "re:" и регулярное выражение, пусто - любые ссылки
+	Exclude 	[]string
+	StripParams []string // glob имен параметров запроса, которые вырезаются из ссылок до постановки в очередь
+	Seeds 		[]SeedRules
+}
+
+type SeedRules struct {
+	URL 		string
+	Domains 	[]string // зарегистрированные домены, за которые обход от этой ссылки не выходит, пусто - любые
+	MaxDepth 	int // 0 - общая глубина обхода
+	MaxPages 	int // скачанных страниц, 0 - без ограничения
+}
+
+type seedScope struct {
+	domains 	map[string]bool
+	maxDepth 	int
+	maxPages 	int64
+	pages 		atomic.Int64
+}
+
+type Scope struct { // nil - обход ограничен только глубиной и OnlySameDomain
+	include 	[]*regexp.Regexp
+	exclude 	[]*regexp.Regexp
+	strip 		[]*regexp.Regexp
+	seeds 		map[string]*seedScope // стартовая ссылка как в конфиге -> ее ограничения
+	order 		[]string
+}
+
+func NewScope(rules ScopeRules) (*Scope, error) {
+	s := &Scope{seeds: make(map[string]*seedScope)}
+	var err error
+	if s.include, err = compilePatterns(rules.Include, false); err != nil {
+		return nil, err
+	}
+	if s.exclude, err = compilePatterns(rules.Exclude, false); err != nil {
+		return nil, err
+	}
+	if s.strip, err = compilePatterns(rules.StripParams, true); err != nil {
+		return nil, err
+	}
+	for _, seed := range rules.Seeds {
+		if u, err := url.Parse(seed.URL); err != nil || u.Host == "" {
+			return nil, errors.New("invalid seed url: " + seed.URL)
+		}
+		if seed.MaxDepth < 0 || seed.MaxPages < 0 {
+			return nil, errors.New("negative limits for seed: " + seed.URL)
+		}
+		if _, dup := s.seeds[seed.URL]; dup {
+			return nil, errors.New("duplicate seed: " + seed.URL)
+		}
+		st := &seedScope{maxDepth: seed.MaxDepth, maxPages: int64(seed.MaxPages)}
+		if len(seed.Domains) != 0 {
+			st.domains = make(map[string]bool, len(seed.Domains))
+			for _, d := range seed.Domains {
+				st.domains[registeredDomain(d)] = true
+			}
+		}
+		s.seeds[seed.URL] = st
+		s.order = append(s.order, seed.URL)
+	}
+	return s, nil
+}
+
+func compilePatterns(patterns []string, caseless bool) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		expr, isRe := strings.CutPrefix(p, "re:")
+		if !isRe {
+			expr = globToRegexp(p)
+		}
+		if caseless {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("scope pattern %q: %w", p, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+func globToRegexp(glob string) string { // * - любая подстрока, в том числе с '/', ? - один символ, совпадать должна вся строка
+	var sb strings.Builder
+	sb.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	return sb.String()
+}
+
+func matchAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Scope) seedURLs() []string {
+	if s == nil {
+		return nil
+	}
+	return s.order
+}
+
+func (s *Scope) stripParams(u *url.URL) {
+	if s == nil || len(s.strip) == 0 {
+		return
+	}
+	dropParams(u, func(name string) bool { return matchAny(s.strip, name) })
+}
+
+func (s *Scope) allows(u *url.URL, seed string) bool { // шаблоны и домены стартовой ссылки, до постановки в очередь
+	if s == nil {
+		return true
+	}
+	raw := u.String()
+	if len(s.include) != 0 && !matchAny(s.include, raw) {
+		return false
+	}
+	if matchAny(s.exclude, raw) {
+		return false
+	}
+	if st := s.seeds[seed]; st != nil && st.domains != nil {
+		return st.domains[registeredDomain(u.Hostname())]
+	}
+	return true
+}
+
+func (s *Scope) maxDepth(seed string, def int) int {
+	if s == nil {
+		return def
+	}
+	if st := s.seeds[seed]; st != nil && st.maxDepth > 0 {
+		return st.maxDepth
+	}
+	return def
+}
+
+func (s *Scope) hasRoom(seed string) bool {
+	if s == nil {
+		return true
+	}
+	st := s.seeds[seed]
+	return st == nil || st.maxPages == 0 || st.pages.Load() < st.maxPages
+}
+
+func (s *Scope) takePage(seed string) bool { // false - страницы стартовой ссылки кончились
+	if s == nil {
+		return true
+	}
+	st := s.seeds[seed]
+	if st == nil || st.maxPages == 0 {
+		return true
+	}
+	if st.pages.Add(1) > st.maxPages {
+		st.pages.Add(-1)
+		return false
+	}
+	return true
+}
+
+func registeredDomain(host string) string { // eTLD+1 по списку публичных суффиксов: blog.example.co.uk -> example.co.uk
+	host = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil { // localhost или сам публичный суффикс
+		return host
+	}
+	return domain
+}
+
+type seedCtxKey struct{}
+
+func withSeed(ctx context.Context, seed string) context.Context {
+	return context.WithValue(ctx, seedCtxKey{}, seed)
+}
+
+func seedOf(ctx context.Context) string { // стартовая ссылка задачи, пусто - действуют только общие правила
+	seed, _ := ctx.Value(seedCtxKey{}).(string)
+	return seed
+}
@@ -4,11 +4,14 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/gob"
+	"fmt"
 	"log/slog"
 
 	"wfts/internal/model"
+	"wfts/internal/services/wfts/offline/scraper/extractors"
 	"wfts/internal/services/wfts/offline/scraper/lruCache"
 	"wfts/internal/utils/parser"
+	"wfts/internal/utils/warc"
 
 	"context"
 	"net/http"
@@ -21,10 +24,16 @@ type indexer interface {
     HandleDocumentWords(*model.Document, []model.Passage) error
 	SaveUrlsToBank([32]byte, []byte) error
 	GetUrlsByHash([32]byte) ([]byte, error)
+	DeleteDocument([32]byte) error
+	SaveFetchMeta([32]byte, *model.FetchMeta) error
+	GetFetchMeta([32]byte) (*model.FetchMeta, error)
+	GetFetchSchedule() ([]*model.FetchMeta, error)
+	SaveFrontier([]model.CrawlNode) error
 }
 
 type workerPool interface {
 	Submit(model.CrawlNode)
+	Frontier() []model.CrawlNode
 	Wait()
 	Stop()
 }
@@ -34,13 +43,23 @@ type WebScraper struct {
 	visited        	*sync.Map
 	cfg 		  	*ConfigData
 	log 			*slog.Logger
-	rlMu         	*sync.RWMutex
 	lru 			*lrucache.LRUCache
 	pool           	workerPool
 	idx 			indexer
 	globalCtx		context.Context
-	rlMap			map[string]*rateLimiter
-	rulesMap		map[string]*parser.RobotsTxt
+	polite 			*politeness
+	clock 			clock
+	stats 			*crawlCounters
+	rbMu 			*sync.Mutex
+	robots 			map[string]*robotsEntry // scheme://host -> robots.txt с временем жизни
+	token 			string // product token краулера, по нему выбирается группа в robots.txt
+	userAgent 		string
+	refreshed 		*sync.Map // когда страница прошлых обходов проверялась последний раз
+	hints 			*sync.Map // нормализованный url -> sitemapHint
+	sitemapsSeen 	*sync.Map // origin хоста или url карты сайта, уже разобранные в этом обходе
+	extractors 		*extractors.Registry // не-html документы по MIME типу
+	frMu 			*sync.Mutex
+	interrupted 	[]model.CrawlNode // задачи, оборванные остановкой обхода
 }
 
 type ConfigData struct {
@@ -48,16 +67,28 @@ type ConfigData struct {
 	CacheCap 		int
 	Depth       	int
 	OnlySameDomain  bool
+	Recrawl 		RecrawlPolicy
+	Frontier 		[]model.CrawlNode // очередь прошлого прерванного обхода
+	Checkpoint 		time.Duration // как часто очередь сохраняется в базу, 0 - только при остановке
+	Archive 		*warc.Writer // nil - ответы не архивируются
+	ProductToken 	string // имя краулера для User-Agent и групп robots.txt
+	Politeness 		PolitenessConfig
+	Retry 			RetryPolicy
+	RobotsTTL 		time.Duration
+	Scope 			*Scope // nil - без шаблонов и ограничений стартовых ссылок
 }
 
 const (
-	userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:140.0) Gecko/20100101 Firefox/140.0"
  	crawlTime = 600 * time.Second
  	deadlineTime = 30 * time.Second
-	numOfTries = 3 // если кто то решил поменять это на 0, чтож, удачи
+	numOfTries = 3 // попыток по умолчанию, если в RetryPolicy 0
 )
 
 func NewScraper(mp *sync.Map, cfg *ConfigData, l *slog.Logger, wp workerPool, idx indexer, c context.Context) *WebScraper {
+	token := parser.ProductToken(cfg.ProductToken)
+	if token == "" {
+		token = defaultProductToken
+	}
 	return &WebScraper{
 		client: &http.Client{
 			Timeout: deadlineTime,
@@ -70,43 +101,80 @@ func NewScraper(mp *sync.Map, cfg *ConfigData, l *slog.Logger, wp workerPool, id
 		visited:        mp,
 		cfg: 			cfg,
 		log:			l,
-		rlMu:           new(sync.RWMutex),
 		lru: 			lrucache.NewLRUCache(cfg.CacheCap),
 		pool:           wp,
 		idx: 			idx,
 		globalCtx:		c,
-		rlMap: 			make(map[string]*rateLimiter),
-		rulesMap: 		make(map[string]*parser.RobotsTxt),
+		polite: 		newPoliteness(cfg.Politeness, realClock{}),
+		clock: 			realClock{},
+		stats: 			&crawlCounters{},
+		rbMu: 			new(sync.Mutex),
+		robots: 		make(map[string]*robotsEntry),
+		token: 			token,
+		userAgent: 		userAgentHeader(token),
+		refreshed: 		&sync.Map{},
+		hints: 			&sync.Map{},
+		sitemapsSeen: 	&sync.Map{},
+		extractors: 	extractors.NewRegistry(),
+		frMu: 			new(sync.Mutex),
 	}
 }
 
 func (ws *WebScraper) Run() {
-	defer ws.putDownLimiters()
-	for _, uri := range ws.cfg.StartURLs {
-		parsed, err := url.Parse(uri)
-		if err != nil {
-			ws.log.Error("parsing url failed: " + err.Error())
-			continue
-		}
-		ws.pool.Submit(model.CrawlNode{Activation: func() {
-			ctx, cancel := context.WithTimeout(ws.globalCtx, crawlTime)
-			defer cancel()
-			ws.rlMu.Lock()
-			rl := NewRateLimiter(DefaultDelay)
-			ws.rlMap[parsed.Host] = rl
-			ws.rlMu.Unlock()
-			ws.ScrapeWithContext(ctx, parsed, 0)
-		}})
-	}
+	stop := ws.startCheckpoints()
+	ws.submitSeeds()
 	ws.pool.Wait()
 	ws.log.Debug("waiting for stoppnig worker pool")
 	ws.pool.Stop()
+	stop()
+}
+
+func (ws *WebScraper) submitSeeds() {
+	if len(ws.cfg.Frontier) != 0 {
+		ws.log.Info(fmt.Sprintf("resuming crawl with %d queued links", len(ws.cfg.Frontier)))
+	}
+	for _, node := range ws.cfg.Frontier {
+		ws.submit(node)
+	}
+	seeds := map[string]bool{}
+	for _, uri := range append(ws.cfg.StartURLs, ws.cfg.Scope.seedURLs()...) { // уже посещенные стартовые ссылки отсеются по visited
+		if !seeds[uri] {
+			seeds[uri] = true
+			ws.submit(model.CrawlNode{URL: uri, Seed: uri})
+		}
+	}
+}
+
+func (ws *WebScraper) submitScheduled(meta *model.FetchMeta) {
+	ws.submit(model.CrawlNode{URL: meta.URL, Depth: meta.Depth, SameDomain: true})
+}
+
+func (ws *WebScraper) submit(node model.CrawlNode) { // задача в пуле собирается из данных узла, поэтому узел можно сохранить и восстановить
+	parsed, err := url.Parse(node.URL)
+	if err != nil {
+		ws.log.Error("parsing url failed: " + err.Error())
+		return
+	}
+	node.Activation = func() {
+		if ws.globalCtx.Err() != nil {
+			ws.interrupt(node)
+			return
+		}
+		ctx, cancel := context.WithTimeout(ws.globalCtx, crawlTime)
+		defer cancel()
+		ws.ScrapeWithContext(withSeed(ctx, node.Seed), parsed, node.Depth)
+		if ws.globalCtx.Err() != nil { // страница могла оборваться на середине, после перезапуска ее ссылки раздадутся заново
+			ws.interrupt(node)
+		}
+	}
+	ws.pool.Submit(node)
 }
 
 func (ws *WebScraper) ScrapeWithContext(ctx context.Context, currentURL *url.URL, depth int) {
     if ws.checkContext(ctx, currentURL.String()) {return}
 
-    if depth >= ws.cfg.Depth {
+	seed := seedOf(ctx)
+    if depth >= ws.cfg.Scope.maxDepth(seed, ws.cfg.Depth) || !ws.cfg.Scope.hasRoom(seed) {
         return
     }
 	
@@ -115,97 +183,127 @@ func (ws *WebScraper) ScrapeWithContext(ctx context.Context, currentURL *url.URL
 		return
     }
 	
-	links, rls, err := ws.fetchPageRulesAndOffers(ctx, currentURL)
-	if err.Error() == BaseXMLPageError || ws.checkContext(ctx, currentURL.String()) {
+	offers, _, err := ws.fetchPageRulesAndOffers(ctx, currentURL)
+	if err != nil && err.Error() == RobotsDisallowedError {
+		ws.log.Debug("skipping page disallowed by robots.txt: " + currentURL.String())
+		ws.skipDisallowed(currentURL, normalized, depth)
+		return
+	}
+	if ws.checkContext(ctx, currentURL.String()) {
 		return
 	}
-	host := truncatePort(currentURL)
-	ws.rlMu.Lock()
-	if rls != nil && ws.rulesMap[host] == nil {
-		ws.rulesMap[host] = rls
+	ws.submitLinks(offers, currentURL, depth, seed) // ссылки карт сайта хоста, раздаются один раз
+	if err != nil && err.Error() == BaseXMLPageError {
+		return
 	}
-	ws.rlMu.Unlock()
 	hashed := sha256.Sum256([]byte(normalized))
 	load := false
-    
-	if len(links) == 0 && (err == nil || err.Error() != BaseXMLPageError) {
-		if prevDepth, loaded := ws.visited.LoadOrStore(normalized, depth); loaded && prevDepth.(int) <= depth {
+	var links []*linkToken
+
+	if prevDepth, loaded := ws.visited.LoadOrStore(normalized, depth); loaded && !ws.recrawlDue(hashed, normalized) {
+		if prevDepth.(int) <= depth {
 			return
-		} else if loaded {
-			load = true
-			if v := ws.lru.Get(hashed); v != nil {
-				links = v.([]*linkToken)
-			} else {
-				encoded, err := ws.idx.GetUrlsByHash(hashed)
-				if err != nil {
-					if err.Error() != "Key not found" {
-						ws.log.Error("error getting urls, from db: " + err.Error())
-					}
-					return
-				}
-				if err := gob.NewDecoder(bytes.NewBuffer(encoded)).Decode(&links); err != nil {
-					ws.log.Error("error unmarshalling urls from db: " + err.Error())
-					return
-				}
-				if len(links) != 0 {
-					ws.lru.Put(hashed, links)
-				}
-			}
-		} else {
-			links, err = ws.fetchHTMLcontent(currentURL, ctx, normalized, depth)
-			if err != nil {
-				return
-			}
 		}
-		
-		if len(links) == 0 {
-			ws.log.Debug("empty links in page " + currentURL.String())
+		load = true
+		if links, err = ws.storedLinks(hashed); err != nil {
+			ws.log.Error("error getting urls, from db: " + err.Error())
+			return
+		}
+	} else {
+		if loaded && prevDepth.(int) > depth {
+			ws.visited.Store(normalized, depth)
+		}
+		if !ws.cfg.Scope.takePage(seed) { // страницу еще может скачать обход от другой стартовой ссылки
+			ws.visited.Delete(normalized)
+			ws.log.Debug("page limit of seed reached: " + seed)
 			return
 		}
+		links, err = ws.fetchHTMLcontent(currentURL, ctx, normalized, depth)
+		if err != nil {
+			return
+		}
+	}
+	
+	if len(links) == 0 {
+		ws.log.Debug("empty links in page " + currentURL.String())
+		return
+	}
 
-		if !load {
-			var buf bytes.Buffer
-			if err := gob.NewEncoder(&buf).Encode(links); err != nil {
-				ws.log.Error("error marshalling urls: " + err.Error())
-				return
-			}
+	if !load {
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(links); err != nil {
+			ws.log.Error("error marshalling urls: " + err.Error())
+			return
+		}
 
-			if err := ws.idx.SaveUrlsToBank(hashed, buf.Bytes()); err != nil {
-				ws.log.Error("error saving urls: " + err.Error())
-				return
-			}
+		if err := ws.idx.SaveUrlsToBank(hashed, buf.Bytes()); err != nil {
+			ws.log.Error("error saving urls: " + err.Error())
+			return
 		}
 	}
-	
-	for _, link := range links {	
+
+	ws.submitLinks(links, currentURL, depth, seed)
+}
+
+func (ws *WebScraper) submitLinks(links []*linkToken, currentURL *url.URL, depth int, seed string) {
+	if !ws.cfg.Scope.hasRoom(seed) {
+		return
+	}
+	for _, link := range links {
 		if ws.cfg.OnlySameDomain && !link.SameDomain {
 			continue
 		}
+		if !ws.cfg.Scope.allows(link.Link, seed) { // ссылки из базы могли быть собраны обходом от другой стартовой ссылки
+			continue
+		}
 
 		if ws.checkContext(ws.globalCtx, currentURL.String()) { return }
 
-        ws.pool.Submit(model.CrawlNode{Activation: func() {
-			ws.rlMu.Lock()
-			if ws.rlMap[link.Link.Host] == nil {
-				ws.rlMap[link.Link.Host] = NewRateLimiter(DefaultDelay)
-			}
-			c, cancel := context.WithTimeout(ws.globalCtx, crawlTime)
-			defer cancel()
-			ws.rlMu.Unlock()
-			ws.ScrapeWithContext(c, link.Link, depth+1)
-		},
-			Depth: depth,
-			SameDomain: link.SameDomain,
-		})
+        ws.submit(model.CrawlNode{URL: link.Link.String(), Depth: depth + 1, SameDomain: link.SameDomain, Priority: link.Priority, Seed: seed})
     }
 }
 
-func (ws *WebScraper) putDownLimiters() {
-	ws.rlMu.Lock()
-	defer ws.rlMu.Unlock()
-	for _, limiter := range ws.rlMap {
-		limiter.Shutdown()
+func (ws *WebScraper) recrawlDue(hashed [32]byte, norm string) bool { // страница из прошлых обходов запрашивается снова по своему расписанию, но не чаще Recrawl.Min
+	if ws.cfg.Recrawl.Initial <= 0 {
+		return false
+	}
+	now := time.Now()
+	if at, checked := ws.refreshed.Load(hashed); checked && now.Sub(at.(time.Time)) < ws.cfg.Recrawl.Min {
+		return false
+	}
+	meta, err := ws.idx.GetFetchMeta(hashed)
+	if err != nil {
+		ws.log.Error("error getting fetch meta: " + err.Error())
+		return false
+	}
+	if meta != nil && !ws.isDue(meta, norm, now) {
+		return false
+	}
+	if at, checked := ws.refreshed.Swap(hashed, now); checked && now.Sub(at.(time.Time)) < ws.cfg.Recrawl.Min { // параллельный воркер успел раньше
+		return false
+	}
+	return true
+}
+
+func (ws *WebScraper) storedLinks(hashed [32]byte) ([]*linkToken, error) {
+	if v := ws.lru.Get(hashed); v != nil {
+		return v.([]*linkToken), nil
+	}
+	encoded, err := ws.idx.GetUrlsByHash(hashed)
+	if err != nil {
+		if err.Error() == "Key not found" {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var links []*linkToken
+	if err := gob.NewDecoder(bytes.NewBuffer(encoded)).Decode(&links); err != nil {
+		return nil, err
+	}
+	if len(links) != 0 {
+		ws.lru.Put(hashed, links)
 	}
+	return links, nil
 }
 
 func (ws *WebScraper) checkContext(ctx context.Context, currentURL string) bool {
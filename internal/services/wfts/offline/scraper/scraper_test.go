@@ -1,15 +1,35 @@
 package scraper
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
+	"slices"
 	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
+
+	"wfts/internal/model"
+	"wfts/internal/utils/parser"
+	"wfts/internal/utils/warc"
+	wpool "wfts/internal/utils/workerPool"
 )
 
 func TestHtmlGetter(t *testing.T) {
@@ -27,7 +47,7 @@ func TestHtmlGetter(t *testing.T) {
     
     for _, tt := range tests {
         t.Run(tt.name, func(t *testing.T) {
-            html, err := NewScraper(nil, &ConfigData{}, slog.Default(), nil, nil, context.Background()).getHTML(tt.url, NewRateLimiter(1), 3)
+            html, _, err := NewScraper(nil, &ConfigData{}, slog.Default(), nil, nil, context.Background()).getHTML(tt.url, nil)
             if err != nil {
                 t.Fatalf("getHTML(%q): %v", tt.url, err)
             }
@@ -55,56 +75,79 @@ func TestHtmlGetter(t *testing.T) {
 }
 
 func TestHaveSitemap(t *testing.T) {
-	tests := []struct {
-        name     string
-        input    string
-        expected []string
-    } {
-        {
-            name:  "google sitemap index",
-            input: "https://www.google.com/",
-            expected: []string{
-                "https://www.google.com/gmail/sitemap.xml",
-                "https://www.google.com/forms/sitemaps.xml",
-                "https://www.google.com/slides/sitemaps.xml",
-                "https://www.google.com/sheets/sitemaps.xml",
-                "https://www.google.com/drive/sitemap.xml",
-                "https://www.google.com/docs/sitemaps.xml",
-                "https://www.google.com/get/sitemap.xml",
-                "https://www.google.com/travel/flights/sitemap.xml",
-                "https://www.google.com/admob/sitemap.xml",
-                "https://www.google.com/services/sitemap.xml",
-                "https://www.google.com/partners/about/sitemap.xml",
-                "https://www.google.com/adwords/sitemap.xml",
-                "https://www.google.com/search/about/sitemap.xml",
-                "https://www.google.com/adsense/start/sitemap.xml",
-                "https://www.google.com/chromebook/sitemap.xml",
-                "https://www.google.com/chrome/sitemap.xml",
-                "https://www.google.com/calendar/about/sitemap.xml",
-                "https://www.google.com/photos/sitemap.xml",
-                "https://www.google.com/nonprofits/sitemap.xml",
-                "https://www.google.com/finance/sitemap.xml",
-                "https://www.google.com/shopping/sitemap.xml",
-            },
-        },
-    }
-    
-    for _, tt := range tests {
-        t.Run(tt.name, func(t *testing.T) {
-            parsed, _ := url.Parse(tt.input)
-            links, err := NewScraper(nil, &ConfigData{}, nil, nil, nil, context.Background()).haveSitemap(parsed)
-            if err != nil {
-                t.Fatalf("haveSitemap(%q): %v", tt.input, err)
-            }
-            sort.Strings(links)
-            sort.Strings(tt.expected)
-            
-            if !reflect.DeepEqual(links, tt.expected) {
-                t.Errorf("haveSitemap(%q) = %v; want %v",
-					tt.input, links, tt.expected)
-            }
-        })
-    }
+	var mu sync.Mutex
+	hits := map[string]int{}
+	var srvURL string
+	gz := func(s string) string {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		io.WriteString(zw, s)
+		zw.Close()
+		return buf.String()
+	}
+	index := func(locs ...string) string {
+		out := `<?xml version="1.0" encoding="UTF-8"?><sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`
+		for _, loc := range locs {
+			out += "<sitemap><loc>" + srvURL + loc + "</loc></sitemap>"
+		}
+		return out + "</sitemapindex>"
+	}
+	recent := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/robots.txt":
+			io.WriteString(w, "User-agent: *\nAllow: /\nSitemap: " + srvURL + "/sitemap_index.xml\n")
+		case "/sitemap_index.xml":
+			io.WriteString(w, index("/pages.xml", "/news.xml.gz", "/chain1.xml", "/sitemap_index.xml"))
+		case "/pages.xml":
+			io.WriteString(w, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url><loc>` + srvURL + `/a</loc><priority>0.9</priority><lastmod>` + recent + `</lastmod></url>
+<url><loc>` + srvURL + `/b</loc></url>
+<url><loc>` + srvURL + `/c</loc><priority>0.1</priority><lastmod>2001-01-01</lastmod></url>
+</urlset>`)
+		case "/news.xml.gz":
+			w.Header().Set("Content-Type", "application/gzip")
+			io.WriteString(w, gz(`<urlset><url><loc>` + srvURL + `/news</loc></url></urlset>`))
+		case "/chain1.xml":
+			io.WriteString(w, index("/chain2.xml"))
+		case "/chain2.xml":
+			io.WriteString(w, index("/chain3.xml"))
+		case "/chain3.xml":
+			io.WriteString(w, `<urlset><url><loc>` + srvURL + `/too-deep</loc></url></urlset>`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	srvURL = srv.URL
+
+	ws := newTestScraper(newFakeIndexer(), srv)
+	root, _ := url.Parse(srv.URL + "/")
+	links, _, err := ws.fetchPageRulesAndOffers(context.Background(), root)
+	if err != nil {
+		t.Fatalf("fetchPageRulesAndOffers(): %v", err)
+	}
+	got := map[string]int{}
+	for _, link := range links {
+		got[link.Link.Path] = link.Priority
+	}
+	expected := map[string]int{"/a": 14, "/b": 5, "/c": 1, "/news": 5}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("sitemap links = %v, want %v", got, expected)
+	}
+
+	page, _ := url.Parse(srv.URL + "/a")
+	if links, _, err := ws.fetchPageRulesAndOffers(context.Background(), page); err != nil || len(links) != 0 {
+		t.Errorf("second page of the host = %d links, %v; want none", len(links), err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if hits["/sitemap_index.xml"] != 1 || hits["/sitemap.xml"] != 0 || hits["/chain2.xml"] != 1 || hits["/chain3.xml"] != 0 {
+		t.Errorf("sitemap fetches = %v, want the index once, no guessed sitemap.xml and nesting cut at %d", hits, maxSitemapDepth)
+	}
 }
 
 func TestNormalizeUrl(t *testing.T) {
@@ -128,6 +171,11 @@ func TestNormalizeUrl(t *testing.T) {
 			input: "https://example.com/?id=1", 
 			expected: "example.com?id=1",
 		},
+        {
+			name: "tracking params are kept", 
+			input: "https://example.com/?utm_source=chatgpt.com&id=1&fbclid=x", 
+			expected: "example.com?fbclid=x&id=1&utm_source=chatgpt.com",
+		},
     }
     for _, tt := range tests {
         t.Run(tt.name, func(t *testing.T) {
@@ -145,6 +193,11 @@ func TestDomainDefinition(t *testing.T) {
 	parsedUrl2, _ := url.Parse("https://www.google.com/search?q=thfjngjkyk&sca_esv=492d03d456b59a14&sxsrf=ANbL-n6qW_s1ov2p-JUzb8lBX_hM-2ECbw%3A1768497888610&source=hp&ei=4CJpafXUI5yzi-gP_tXY4Ac&iflsig=AFdpzrgAAAAAaWkw8E8wYLwh1iURDenMKQfHKOYRIK5S&ved=0ahUKEwj1xL2DiI6SAxWc2QIHHf4qFnwQ4dUDCB4&uact=5&oq=thfjngjkyk&gs_lp=Egdnd3Mtd2l6Igp0aGZqbmdqa3lrMgUQABjvBTIIEAAYgAQYogQyCBAAGIAEGKIEMggQABiABBiiBDIFEAAY7wVIkwtQlwJYqgdwAXgAkAECmAHZAaABuQqqAQUwLjkuMbgBA8gBAPgBAZgCCaACngioAgrCAg0QIxiABBgnGIoFGOoCwgIHECMYJxjqAsICChAjGIAEGCcYigXCAgoQLhiABBhDGIoFwgIKEAAYgAQYQxiKBcICBRAAGIAEwgILEC4YgAQY0QMYxwHCAgUQLhiABMICBxAAGIAEGArCAgkQABiABBgKGAvCAgsQABiABBgBGAoYC8ICBxAuGIAEGA3CAgkQABiABBgKGA3CAgYQABgNGB7CAgcQABiABBgNwgILEAAYgAQYkgMYigXCAgoQABiABBjJAxgNmAMR8QWwBqhiWbg58JIHAzEuOKAH6UyyBwMwLji4B40IwgcHMC4zLjMuM8gHLoAIAA&sclient=gws-wiz")
 	parsedUrl3, _ := url.Parse("https://support.google.com/")
 	parsedUrl4, _ := url.Parse("https://domains.google/")
+	parsedUrl5, _ := url.Parse("https://x.com/")
+	parsedUrl6, _ := url.Parse("https://box.com/")
+	parsedUrl7, _ := url.Parse("https://blog.example.co.uk:8443/post")
+	parsedUrl8, _ := url.Parse("https://example.co.uk/")
+	parsedUrl9, _ := url.Parse("https://other.co.uk/")
 	tests := []struct{
 		name 		string
 		in 	 		[2]*url.URL
@@ -165,6 +218,21 @@ func TestDomainDefinition(t *testing.T) {
 			in: [2]*url.URL{parsedUrl1, parsedUrl4}, 
 			expected: false,
 		},
+		{
+			name: "host is a suffix of another", 
+			in: [2]*url.URL{parsedUrl5, parsedUrl6}, 
+			expected: false,
+		},
+		{
+			name: "public suffix subdomain", 
+			in: [2]*url.URL{parsedUrl7, parsedUrl8}, 
+			expected: true,
+		},
+		{
+			name: "same public suffix", 
+			in: [2]*url.URL{parsedUrl8, parsedUrl9}, 
+			expected: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -173,4 +241,1267 @@ func TestDomainDefinition(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestScopeRules(t *testing.T) {
+	scope, err := NewScope(ScopeRules{
+		Include: 		[]string{"https://*.example.com/*", "re:^https://docs\\.go\\.dev/"},
+		Exclude: 		[]string{"*/private/*", "re:\\.(png|zip)$"},
+		StripParams: 	[]string{"utm_*", "SID"},
+		Seeds: 			[]SeedRules{{URL: "https://www.example.com/", Domains: []string{"blog.example.com"}, MaxDepth: 2, MaxPages: 2}},
+	})
+	if err != nil {
+		t.Fatalf("NewScope(): %v", err)
+	}
+	const seed = "https://www.example.com/"
+	tests := []struct {
+		name 		string
+		in 			string
+		seed 		string
+		stripped 	string
+		allowed 	bool
+	}{
+		{"glob include", "https://www.example.com/a", "", "https://www.example.com/a", true},
+		{"regexp include", "https://docs.go.dev/x", "", "https://docs.go.dev/x", true},
+		{"not included", "https://go.dev/", "", "https://go.dev/", false},
+		{"glob exclude wins", "https://www.example.com/private/a", "", "https://www.example.com/private/a", false},
+		{"regexp exclude", "https://www.example.com/logo.png", "", "https://www.example.com/logo.png", false},
+		{"params stripped", "https://www.example.com/a?utm_source=x&id=1&sid=2&UTM_medium", "", "https://www.example.com/a?id=1", true},
+		{"all params stripped", "https://www.example.com/a?utm_source=x", "", "https://www.example.com/a", true},
+		{"seed registered domain", "https://shop.example.com/a", seed, "https://shop.example.com/a", true},
+		{"seed foreign domain", "https://docs.go.dev/x", seed, "https://docs.go.dev/x", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, _ := url.Parse(tt.in)
+			scope.stripParams(u)
+			if u.String() != tt.stripped {
+				t.Errorf("stripParams(%s) = %s, want %s", tt.in, u, tt.stripped)
+			}
+			if got := scope.allows(u, tt.seed); got != tt.allowed {
+				t.Errorf("allows(%s, %q) = %t, want %t", u, tt.seed, got, tt.allowed)
+			}
+		})
+	}
+
+	if d := scope.maxDepth(seed, 8); d != 2 {
+		t.Errorf("maxDepth(seed) = %d, want 2", d)
+	}
+	if d := scope.maxDepth("https://other.org/", 8); d != 8 {
+		t.Errorf("maxDepth(other) = %d, want 8", d)
+	}
+	if !scope.takePage(seed) || !scope.takePage(seed) || scope.takePage(seed) || scope.hasRoom(seed) {
+		t.Errorf("page limit of seed is not enforced")
+	}
+	if !scope.takePage("") || !scope.hasRoom("") {
+		t.Errorf("pages without seed must not be limited")
+	}
+
+	ws := NewScraper(&sync.Map{}, &ConfigData{Scope: scope}, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, nil, context.Background())
+	base, _ := url.Parse("https://www.example.com/")
+	page := `<a href="/a?utm_campaign=z">a</a><a href="/private/b">b</a><a href="https://go.dev/">c</a><a href="https://docs.go.dev/d">d</a>`
+	links, _, _ := ws.parseHTMLStream(withSeed(context.Background(), seed), page, base, 0)
+	var got []string
+	for _, link := range links {
+		got = append(got, link.Link.String())
+	}
+	if want := []string{"https://www.example.com/a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseHTMLStream() links = %v, want %v", got, want)
+	}
+
+	for _, bad := range []ScopeRules{
+		{Include: []string{"re:("}},
+		{Seeds: []SeedRules{{URL: "not a url"}}},
+		{Seeds: []SeedRules{{URL: "https://a.org/", MaxPages: -1}}},
+	} {
+		if _, err := NewScope(bad); err == nil {
+			t.Errorf("NewScope(%+v): expected error", bad)
+		}
+	}
+}
+
+func TestParseHTMLMeta(t *testing.T) {
+	const page = `<html><head>
+<title> Living   Standard </title>
+<meta name="description" content="HTML spec">
+<meta property="og:title" content="HTML" />
+<meta property="og:image" content="https://example.com/logo.png"/>
+<link rel="alternate canonical" href="/spec/?utm_source=feed">
+</head><body>
+<h1>Parsing</h1>
+<svg><title>icon</title></svg>
+<p>Tokenization   of
+text</p>
+<script>var ignored = 1;</script>
+</body></html>`
+	base, _ := url.Parse("https://example.com/spec")
+	ws := NewScraper(&sync.Map{}, &ConfigData{}, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, nil, context.Background())
+	_, passages, meta := ws.parseHTMLStream(context.Background(), page, base, 0)
+
+	if meta.Title != "Living Standard" {
+		t.Errorf("title = %q, want %q", meta.Title, "Living Standard")
+	}
+	if meta.Description != "HTML spec" {
+		t.Errorf("description = %q, want %q", meta.Description, "HTML spec")
+	}
+	expectedOG := map[string]string{"og:title": "HTML", "og:image": "https://example.com/logo.png"}
+	if !reflect.DeepEqual(meta.OpenGraph, expectedOG) {
+		t.Errorf("open graph = %v, want %v", meta.OpenGraph, expectedOG)
+	}
+	if expected := "Living Standard\nParsing\nicon\nTokenization of text\n"; meta.Text != expected {
+		t.Errorf("text = %q, want %q", meta.Text, expected)
+	}
+	if len(passages) == 0 || passages[0].Type != model.TitleType {
+		t.Errorf("first passage = %v, want title passage", passages)
+	}
+	if meta.Canonical != "https://example.com/spec/?utm_source=feed" {
+		t.Errorf("canonical = %q", meta.Canonical)
+	}
+}
+
+func TestCompactTextLimit(t *testing.T) {
+	passages := []model.Passage{{Text: "first line"}, {Text: "second line"}}
+	if got := compactText(passages, 15); got != "first line\n" {
+		t.Errorf("compactText() = %q, want only whole passages", got)
+	}
+}
+
+type fakeIndexer struct {
+	mu 		sync.Mutex
+	deleted [][32]byte
+	indexed []string
+	docs 	[]*model.Document
+	urls 	map[[32]byte][]byte
+	fetches map[[32]byte]*model.FetchMeta
+	frontiers [][]model.CrawlNode
+	dedup 	bool // как настоящий индексатор, отказывает копии текста уже проиндексированной страницы
+}
+
+func newFakeIndexer() *fakeIndexer {
+	return &fakeIndexer{urls: map[[32]byte][]byte{}, fetches: map[[32]byte]*model.FetchMeta{}}
+}
+
+func (f *fakeIndexer) HandleDocumentWords(doc *model.Document, _ []model.Passage) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, d := range f.docs {
+		if f.dedup && d.Id != doc.Id && d.Text == doc.Text && !slices.Contains(f.deleted, d.Id) {
+			return errors.New("page already indexed")
+		}
+	}
+	f.indexed = append(f.indexed, doc.Text)
+	f.docs = append(f.docs, doc)
+	return nil
+}
+
+func (f *fakeIndexer) SaveUrlsToBank(key [32]byte, data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.urls[key] = data
+	return nil
+}
+
+func (f *fakeIndexer) GetUrlsByHash(key [32]byte) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if data, ok := f.urls[key]; ok {
+		return data, nil
+	}
+	return nil, errors.New("Key not found")
+}
+
+func (f *fakeIndexer) DeleteDocument(id [32]byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deleted = append(f.deleted, id)
+	return nil
+}
+
+func (f *fakeIndexer) SaveFetchMeta(key [32]byte, meta *model.FetchMeta) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fetches[key] = meta
+	return nil
+}
+
+func (f *fakeIndexer) GetFetchMeta(key [32]byte) (*model.FetchMeta, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.fetches[key], nil
+}
+
+func (f *fakeIndexer) GetFetchSchedule() ([]*model.FetchMeta, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := []*model.FetchMeta{}
+	for _, m := range f.fetches {
+		if m.URL != "" {
+			out = append(out, m)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].NextFetchAt.Before(out[j].NextFetchAt) })
+	return out, nil
+}
+
+func (f *fakeIndexer) SaveFrontier(nodes []model.CrawlNode) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.frontiers = append(f.frontiers, nodes)
+	return nil
+}
+
+func newTestScraper(idx indexer, srv *httptest.Server) *WebScraper { // без задержек между запросами к тестовому серверу
+	ws := NewScraper(&sync.Map{}, &ConfigData{CacheCap: 10}, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, idx, context.Background())
+	ws.client = srv.Client()
+	return ws
+}
+
+func TestGonePagesDeleted(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/gone":
+			w.WriteHeader(http.StatusGone)
+		default:
+			w.WriteHeader(http.StatusInternalServerError) // временная ошибка, документ остается
+		}
+	}))
+	defer srv.Close()
+
+	idx := newFakeIndexer()
+	ws := newTestScraper(idx, srv)
+
+	expected := [][32]byte{}
+	for _, path := range []string{"/missing", "/gone", "/broken"} {
+		cur, _ := url.Parse(srv.URL + path)
+		norm, err := normalizeUrl(cur.String())
+		if err != nil {
+			t.Fatalf("normalizeUrl(%s): %v", cur, err)
+		}
+		if _, err := ws.fetchHTMLcontent(cur, context.Background(), norm, 0); err == nil {
+			t.Errorf("fetchHTMLcontent(%s): expected error", cur)
+		}
+		if path != "/broken" {
+			expected = append(expected, sha256.Sum256([]byte(norm)))
+		}
+	}
+	if !reflect.DeepEqual(idx.deleted, expected) {
+		t.Errorf("deleted %x, want %x", idx.deleted, expected)
+	}
+}
+
+func TestGoneCanonicalDeleted(t *testing.T) {
+	var gone atomic.Bool
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if gone.Load() {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><link rel="canonical" href="/article"></head><body><p>moved article</p></body></html>`))
+	}))
+	defer srv.Close()
+
+	idx := newFakeIndexer()
+	ws := newTestScraper(idx, srv)
+	cur, _ := url.Parse(srv.URL + "/page?ref=1")
+	norm, _ := normalizeUrl(cur.String())
+	if _, err := ws.fetchHTMLcontent(cur, context.Background(), norm, 0); err != nil {
+		t.Fatalf("fetchHTMLcontent(): %v", err)
+	}
+	canonical, _ := normalizeUrl(srv.URL + "/article")
+	docID := sha256.Sum256([]byte(canonical))
+	if len(idx.docs) != 1 || idx.docs[0].Id != docID {
+		t.Fatalf("indexed %+v, want one document under the canonical id", idx.docs)
+	}
+
+	gone.Store(true)
+	idx.deleted = nil
+	if _, err := ws.fetchHTMLcontent(cur, context.Background(), norm, 0); err == nil {
+		t.Fatal("fetchHTMLcontent(): expected error")
+	}
+	if !reflect.DeepEqual(idx.deleted, [][32]byte{docID}) {
+		t.Errorf("deleted %x, want canonical document %x", idx.deleted, docID)
+	}
+}
+
+func TestConditionalRecrawl(t *testing.T) {
+	var mu sync.Mutex
+	body, etag, lastModified := "<p>first version</p>", `"v1"`, ""
+	conditional := []string{}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { // краулер переходит только по https ссылкам
+		mu.Lock()
+		defer mu.Unlock()
+		conditional = append(conditional, r.Header.Get("If-None-Match") + "|" + r.Header.Get("If-Modified-Since"))
+		if (etag != "" && r.Header.Get("If-None-Match") == etag) || (lastModified != "" && r.Header.Get("If-Modified-Since") == lastModified) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		if lastModified != "" {
+			w.Header().Set("Last-Modified", lastModified)
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, body + `<a href="/next">next</a>`)
+	}))
+	defer srv.Close()
+
+	idx := newFakeIndexer()
+	ws := newTestScraper(idx, srv)
+	cur, _ := url.Parse(srv.URL + "/page")
+	norm, _ := normalizeUrl(cur.String())
+	hashed := sha256.Sum256([]byte(norm))
+
+	steps := []struct {
+		name 		string
+		change 		func()
+		header 		string // валидаторы, которые должен был отправить краулер
+		reindexed 	bool
+	}{
+		{"first fetch", func() {}, "|", true},
+		{"etag matches", func() {}, `"v1"|`, false},
+		{"content changed", func() { body, etag = "<p>second version</p>", `"v2"` }, `"v1"|`, true},
+		{"last-modified only", func() { etag, lastModified = "", "Mon, 02 Jan 2006 15:04:05 GMT" }, `"v2"|`, false}, // тело то же, хеш совпал
+		{"last-modified matches", func() {}, "|Mon, 02 Jan 2006 15:04:05 GMT", false},
+	}
+	for _, st := range steps {
+		mu.Lock()
+		st.change()
+		mu.Unlock()
+		before := len(idx.indexed)
+		links, err := ws.fetchHTMLcontent(cur, context.Background(), norm, 0)
+		if err != nil {
+			t.Fatalf("%s: fetchHTMLcontent(): %v", st.name, err)
+		}
+		if len(links) != 1 || links[0].Link.Path != "/next" {
+			t.Errorf("%s: links = %v, want /next", st.name, links)
+		}
+		if reindexed := len(idx.indexed) > before; reindexed != st.reindexed {
+			t.Errorf("%s: reindexed = %t, want %t", st.name, reindexed, st.reindexed)
+		}
+		if got := conditional[len(conditional) - 1]; got != st.header {
+			t.Errorf("%s: sent validators %q, want %q", st.name, got, st.header)
+		}
+		if meta := idx.fetches[hashed]; meta == nil || time.Since(meta.FetchedAt) > time.Minute {
+			t.Errorf("%s: fetch meta not updated: %+v", st.name, meta)
+		}
+	}
+	if idx.indexed[len(idx.indexed) - 1] != "second version\nnext\n" {
+		t.Errorf("last indexed text = %q", idx.indexed[len(idx.indexed) - 1])
+	}
+	if meta := idx.fetches[hashed]; meta.Checks != len(steps) || meta.Changes != 1 || meta.URL != cur.String() {
+		t.Errorf("schedule stats = %d checks, %d changes, url %q", meta.Checks, meta.Changes, meta.URL)
+	}
+}
+
+func TestCanonicalDocument(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/new?utm_source=feed", http.StatusMovedPermanently)
+		case "/new":
+			w.Write([]byte(`<html><head><link rel="canonical" href="/article"></head><body><p>moved article</p></body></html>`))
+		case "/foreign":
+			w.Write([]byte(`<html><head><link rel="canonical" href="https://other.example/x"></head><body><p>foreign</p></body></html>`))
+		default:
+			w.Write([]byte(`<html><body><p>` + r.URL.Path + `</p></body></html>`))
+		}
+	}))
+	defer srv.Close()
+
+	id := func(raw string) [32]byte {
+		norm, _ := normalizeUrl(raw)
+		return sha256.Sum256([]byte(norm))
+	}
+	tests := []struct {
+		name 		string
+		path 		string
+		url 		string
+		aliases 	[]string
+		redirects 	[]string
+	}{
+		{"redirect and canonical", "/old", "/article", []string{"/old", "/new?utm_source=feed"}, []string{"/old", "/new?utm_source=feed"}},
+		{"canonical of another site is ignored", "/foreign", "/foreign", nil, nil},
+		{"tracking params are stripped", "/plain?utm_medium=x&id=2", "/plain?id=2", []string{"/plain?utm_medium=x&id=2"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx := newFakeIndexer()
+			ws := newTestScraper(idx, srv)
+			cur, _ := url.Parse(srv.URL + tt.path)
+			norm, _ := normalizeUrl(cur.String())
+			if _, err := ws.fetchHTMLcontent(cur, context.Background(), norm, 0); err != nil {
+				t.Fatalf("fetchHTMLcontent(): %v", err)
+			}
+			if len(idx.docs) != 1 {
+				t.Fatalf("indexed %d documents, want 1", len(idx.docs))
+			}
+			doc := idx.docs[0]
+			if doc.URL != srv.URL + tt.url || doc.Id != id(srv.URL + tt.url) {
+				t.Errorf("document %s, want %s under its own id", doc.URL, srv.URL + tt.url)
+			}
+			var aliases, redirects []string
+			for _, a := range tt.aliases {
+				aliases = append(aliases, srv.URL + a)
+			}
+			for _, r := range tt.redirects {
+				redirects = append(redirects, srv.URL + r)
+			}
+			if !reflect.DeepEqual(doc.Aliases, aliases) {
+				t.Errorf("aliases = %q, want %q", doc.Aliases, aliases)
+			}
+			if meta := idx.fetches[id(cur.String())]; meta == nil || !reflect.DeepEqual(meta.Redirects, redirects) {
+				t.Errorf("fetch meta = %+v, want redirects %q", meta, redirects)
+			}
+			var dropped [][32]byte
+			for _, a := range aliases {
+				dropped = append(dropped, id(a))
+			}
+			if !reflect.DeepEqual(idx.deleted, dropped) {
+				t.Errorf("deleted %x, want alias ids %x", idx.deleted, dropped)
+			}
+		})
+	}
+}
+
+func TestAliasIndexedBeforeCanonical(t *testing.T) {
+	var canonical atomic.Bool
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if canonical.Load() {
+			w.Write([]byte(`<html><head><link rel="canonical" href="/article"></head><body><p>moved article</p></body></html>`))
+			return
+		}
+		w.Write([]byte(`<html><body><p>moved article</p></body></html>`))
+	}))
+	defer srv.Close()
+
+	idx := newFakeIndexer()
+	idx.dedup = true
+	ws := newTestScraper(idx, srv)
+	cur, _ := url.Parse(srv.URL + "/page")
+	norm, _ := normalizeUrl(cur.String())
+	if _, err := ws.fetchHTMLcontent(cur, context.Background(), norm, 0); err != nil { // страница еще без rel=canonical
+		t.Fatalf("fetchHTMLcontent(): %v", err)
+	}
+
+	canonical.Store(true)
+	if _, err := ws.fetchHTMLcontent(cur, context.Background(), norm, 0); err != nil {
+		t.Fatalf("fetchHTMLcontent() with canonical: %v", err)
+	}
+	article, _ := normalizeUrl(srv.URL + "/article")
+	if len(idx.docs) != 2 || idx.docs[1].Id != sha256.Sum256([]byte(article)) {
+		t.Fatalf("indexed %+v, want the canonical document after the alias copy", idx.docs)
+	}
+	if !reflect.DeepEqual(idx.deleted, [][32]byte{sha256.Sum256([]byte(norm))}) {
+		t.Errorf("deleted %x, want the alias copy %x", idx.deleted, sha256.Sum256([]byte(norm)))
+	}
+}
+
+func TestParseRobotsDirectives(t *testing.T) {
+	tests := []struct {
+		value 		string
+		token 		string
+		expected 	robotsDirectives
+	}{
+		{"noindex, nofollow", "", robotsDirectives{noIndex: true, noFollow: true}},
+		{"NONE", "", robotsDirectives{noIndex: true, noFollow: true}},
+		{"index,follow", "", robotsDirectives{}},
+		{"nofollow", "wfts", robotsDirectives{noFollow: true}},
+		{"googlebot: noindex", "wfts", robotsDirectives{}},
+		{"googlebot: noindex, wfts: nofollow", "wfts", robotsDirectives{noFollow: true}},
+		{"WFTS: noindex, nofollow", "wfts", robotsDirectives{noIndex: true, noFollow: true}},
+		{"unavailable_after: 25 Jun 2010 15:00:00 PST, noindex", "wfts", robotsDirectives{noIndex: true}},
+	}
+	for _, tt := range tests {
+		if got := parseRobotsDirectives(tt.value, tt.token); got != tt.expected {
+			t.Errorf("parseRobotsDirectives(%q, %q) = %+v, want %+v", tt.value, tt.token, got, tt.expected)
+		}
+	}
+}
+
+func TestRobotsDirectivesPolicy(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		body := `<a href="/x">x</a><p>` + r.URL.Path + `</p>`
+		switch r.URL.Path {
+		case "/meta-noindex":
+			body = `<meta name="robots" content="noindex">` + body
+		case "/meta-none":
+			body = `<meta name="WFTS" content="none">` + body
+		case "/header-other":
+			w.Header().Set("X-Robots-Tag", "otherbot: noindex")
+		case "/header-ours":
+			w.Header().Add("X-Robots-Tag", "otherbot: none")
+			w.Header().Add("X-Robots-Tag", "wfts: noindex")
+		case "/rel":
+			body = `<a href="/a" rel="external NoFollow">a</a>` + body
+		}
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	idx := newFakeIndexer()
+	ws := newTestScraper(idx, srv)
+	tests := []struct {
+		path 		string
+		indexed 	bool
+		links 		[]string
+		reason 		string
+	}{
+		{"/meta-noindex", false, []string{"/x"}, SkipNoIndex},
+		{"/meta-none", false, nil, SkipNoFollow + ", " + SkipNoIndex},
+		{"/header-other", true, []string{"/x"}, ""},
+		{"/header-ours", false, []string{"/x"}, SkipXRobotsNoIndex},
+		{"/rel", true, []string{"/x"}, ""}, // пропущена только ссылка, не страница
+	}
+	for _, tt := range tests {
+		cur, _ := url.Parse(srv.URL + tt.path)
+		norm, _ := normalizeUrl(cur.String())
+		before := len(idx.docs)
+		links, err := ws.fetchHTMLcontent(cur, context.Background(), norm, 0)
+		if err != nil {
+			t.Fatalf("fetchHTMLcontent(%s): %v", tt.path, err)
+		}
+		if indexed := len(idx.docs) > before; indexed != tt.indexed {
+			t.Errorf("%s indexed = %t, want %t", tt.path, indexed, tt.indexed)
+		}
+		var got []string
+		for _, link := range links {
+			got = append(got, link.Link.Path)
+		}
+		if !reflect.DeepEqual(got, tt.links) {
+			t.Errorf("%s links = %q, want %q", tt.path, got, tt.links)
+		}
+		if meta := idx.fetches[sha256.Sum256([]byte(norm))]; meta == nil || meta.SkipReason != tt.reason {
+			t.Errorf("%s fetch meta = %+v, want skip reason %q", tt.path, meta, tt.reason)
+		}
+	}
+
+	expected := map[string]int64{SkipNoIndex: 2, SkipNoFollow: 1, SkipXRobotsNoIndex: 1, SkipRelNoFollow: 1}
+	if got := ws.Stats().Skipped; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Stats().Skipped = %v, want %v", got, expected)
+	}
+}
+
+func TestRecrawlDue(t *testing.T) {
+	idx := newFakeIndexer()
+	policy := RecrawlPolicy{Initial: time.Hour, Min: 30 * time.Minute, Max: 24 * time.Hour}
+	ws := NewScraper(&sync.Map{}, &ConfigData{Recrawl: policy}, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, idx, context.Background())
+	fresh, stale, legacy, hinted, unknown := [32]byte{1}, [32]byte{2}, [32]byte{3}, [32]byte{4}, [32]byte{5}
+	now := time.Now()
+	idx.fetches[fresh] = &model.FetchMeta{FetchedAt: now.Add(-time.Minute), NextFetchAt: now.Add(time.Hour)}
+	idx.fetches[stale] = &model.FetchMeta{FetchedAt: now.Add(-2 * time.Hour), NextFetchAt: now.Add(-time.Hour)}
+	idx.fetches[legacy] = &model.FetchMeta{FetchedAt: now.Add(-2 * time.Hour)} // без расписания, считается от Initial
+	idx.fetches[hinted] = &model.FetchMeta{FetchedAt: now.Add(-time.Hour), NextFetchAt: now.Add(time.Hour)}
+	ws.rememberHint("https://example.com/news", sitemapEntry{LastMod: now.Add(-time.Minute).Format(time.RFC3339)})
+
+	got := [5]bool{
+		ws.recrawlDue(fresh, "example.com/fresh"),
+		ws.recrawlDue(stale, "example.com/stale"),
+		ws.recrawlDue(legacy, "example.com/legacy"),
+		ws.recrawlDue(hinted, "example.com/news"),
+		ws.recrawlDue(unknown, "example.com/unknown"),
+	}
+	if got != [5]bool{false, true, true, true, true} {
+		t.Errorf("recrawlDue(fresh, stale, legacy, hinted, unknown) = %v", got)
+	}
+	if ws.recrawlDue(stale, "example.com/stale") {
+		t.Errorf("page rechecked twice within the minimal interval")
+	}
+	ws.cfg.Recrawl.Initial = 0
+	if ws.recrawlDue([32]byte{6}, "example.com/new") {
+		t.Errorf("recrawl enabled with zero interval")
+	}
+}
+
+func TestWatchWithoutRecrawl(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "<html><body><p>only page</p></body></html>")
+	}))
+	defer srv.Close()
+
+	ws := newTestScraper(newFakeIndexer(), srv)
+	ws.cfg.Depth, ws.cfg.StartURLs = 1, []string{srv.URL + "/"}
+	ws.pool = wpool.NewWorkerPool(1, 10, context.Background())
+	done := make(chan struct{})
+	go func() {
+		ws.Watch() // контекст не отменяется, без повторных обходов Watch должен закончиться сам
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch() with recrawl disabled did not return after the crawl")
+	}
+}
+
+func TestRecrawlPolicy(t *testing.T) {
+	p := RecrawlPolicy{Initial: 24 * time.Hour, Min: time.Hour, Max: 30 * 24 * time.Hour}
+	tests := []struct {
+		name 		string
+		prev 		*model.FetchMeta
+		changed 	bool
+		changeFreq 	string
+		expected 	time.Duration
+	}{
+		{"first fetch", nil, false, "", 24 * time.Hour},
+		{"sitemap hint", nil, false, "weekly", 7 * 24 * time.Hour},
+		{"always is clamped", nil, false, "always", time.Hour},
+		{"never is clamped", nil, false, "never", 30 * 24 * time.Hour},
+		{"changed halves", &model.FetchMeta{Interval: 8 * time.Hour}, true, "weekly", 4 * time.Hour},
+		{"unchanged grows", &model.FetchMeta{Interval: 8 * time.Hour}, false, "", 12 * time.Hour},
+		{"lower bound", &model.FetchMeta{Interval: time.Hour}, true, "", time.Hour},
+		{"upper bound", &model.FetchMeta{Interval: 25 * 24 * time.Hour}, false, "", 30 * 24 * time.Hour},
+		{"legacy record", &model.FetchMeta{}, true, "daily", 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := p.next(tt.prev, tt.changed, tt.changeFreq); got != tt.expected {
+			t.Errorf("%s: next() = %v, want %v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestDecodeSitemapHints(t *testing.T) {
+	const sitemap = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset>
+  <url><loc>https://example.com/</loc><changefreq>daily</changefreq><lastmod>2026-10-01</lastmod></url>
+  <url><loc> https://example.com/about </loc></url>
+</urlset>`
+	entries, err := decodeSitemap(strings.NewReader(sitemap))
+	if err != nil {
+		t.Fatalf("decodeSitemap(): %v", err)
+	}
+	expected := []sitemapEntry{
+		{Loc: "https://example.com/", LastMod: "2026-10-01", ChangeFreq: "daily"},
+		{Loc: " https://example.com/about "},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("decodeSitemap() = %+v, want %+v", entries, expected)
+	}
+	for _, s := range []string{"2026-10-01", "2026-10-01T10:00+03:00", "2026-10-01T07:00:00Z"} {
+		if _, ok := parseLastMod(s); !ok {
+			t.Errorf("parseLastMod(%q) failed", s)
+		}
+	}
+}
+
+func TestDueSchedule(t *testing.T) {
+	idx := newFakeIndexer()
+	ws := NewScraper(&sync.Map{}, &ConfigData{Depth: 3, Recrawl: RecrawlPolicy{Initial: time.Hour, Min: time.Hour, Max: 24 * time.Hour}}, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, idx, context.Background())
+	now := time.Now()
+	for i, m := range []*model.FetchMeta{
+		{URL: "https://example.com/due", NextFetchAt: now.Add(-time.Minute)},
+		{URL: "https://example.com/later", NextFetchAt: now.Add(90 * time.Minute)},
+		{URL: "https://example.com/soon", NextFetchAt: now.Add(10 * time.Minute)},
+		{URL: "https://example.com/deep", Depth: 3, NextFetchAt: now.Add(-time.Minute)},
+		{URL: "https://example.com/retried", NextFetchAt: now.Add(-time.Minute)},
+	} {
+		idx.fetches[[32]byte{byte(i)}] = m
+	}
+
+	due, wait := ws.dueSchedule(now, map[string]time.Time{"https://example.com/retried": now.Add(-time.Minute)})
+	if len(due) != 1 || due[0].URL != "https://example.com/due" {
+		t.Errorf("dueSchedule() = %v, want only /due", due)
+	}
+	if wait != 10 * time.Minute {
+		t.Errorf("wait = %v, want time until /soon", wait)
+	}
+}
+
+func TestFrontierResume(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var once sync.Once
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			once.Do(cancel) // Ctrl-C пока скачивается первая страница
+			io.WriteString(w, `<html><body><p>root page</p><a href="/a">a</a><a href="/b">b</a></body></html>`)
+		case "/a", "/b":
+			io.WriteString(w, "<html><body><p>page " + r.URL.Path[1:] + "</p></body></html>")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, "<html><body>not found")
+		}
+	}))
+	defer srv.Close()
+
+	idx := newFakeIndexer()
+	vis := &sync.Map{}
+	ws := newTestScraper(idx, srv)
+	ws.visited, ws.globalCtx = vis, ctx
+	ws.cfg.Depth, ws.cfg.StartURLs = 3, []string{srv.URL + "/"}
+	ws.pool = wpool.NewWorkerPool(2, 10, ctx)
+	ws.Run()
+
+	if len(idx.frontiers) != 1 || len(idx.frontiers[0]) != 1 {
+		t.Fatalf("frontier after interrupt = %+v, want the interrupted seed", idx.frontiers)
+	}
+	saved := idx.frontiers[0][0]
+	if saved.URL != srv.URL + "/" || saved.Depth != 0 || saved.Activation != nil {
+		t.Fatalf("saved node = %+v", saved)
+	}
+
+	resumed := newTestScraper(idx, srv) // новый запуск: только сохраненная очередь, visited из базы
+	resumed.visited = vis
+	resumed.cfg.Depth, resumed.cfg.Frontier = 3, idx.frontiers[0]
+	resumed.pool = wpool.NewWorkerPool(2, 10, context.Background())
+	resumed.Run()
+
+	indexed := strings.Join(idx.indexed, "|")
+	for _, text := range []string{"page a", "page b"} {
+		if !strings.Contains(indexed, text) {
+			t.Errorf("resumed crawl did not index %q, indexed %q", text, idx.indexed)
+		}
+	}
+	if last := idx.frontiers[len(idx.frontiers) - 1]; len(last) != 0 {
+		t.Errorf("frontier after finished crawl = %+v, want empty", last)
+	}
+}
+
+func TestFetchNonHTMLDocuments(t *testing.T) {
+	var accept string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept = r.Header.Get("Accept")
+		switch r.URL.Path {
+		case "/paper.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			io.WriteString(w, "%PDF-1.4\n1 0 obj\n<< /Title (Attention) >>\nendobj\n2 0 obj\n<< /Length 0 >>\nstream\nBT (multi head) Tj T* (attention) Tj ET\nendstream\nendobj\n%%EOF\n")
+		case "/notes.md":
+			w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+			io.WriteString(w, "# Notes\n\nSelf *attention* [layers](https://arxiv.org).\n")
+		case "/README":
+			w.Header().Set("Content-Type", "text/plain")
+			io.WriteString(w, "line one\nline two\n\nsecond paragraph\n")
+		case "/huge.txt":
+			w.Header().Set("Content-Type", "text/plain")
+			io.WriteString(w, strings.Repeat("a", maxDocumentSize + 1))
+		default:
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte{0, 1, 2})
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		path 		string
+		text 		string
+		wantErr 	bool
+	}{
+		{path: "/paper.pdf", text: "Attention\nmulti head\nattention\n"},
+		{path: "/notes.md", text: "Notes\nSelf attention layers.\n"},
+		{path: "/README", text: "line one line two\nsecond paragraph\n"},
+		{path: "/model.bin", wantErr: true},
+		{path: "/huge.txt", wantErr: true}, // обрезанный документ не индексируется
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			idx := newFakeIndexer()
+			ws := newTestScraper(idx, srv)
+			cur, _ := url.Parse(srv.URL + tt.path)
+			norm, _ := normalizeUrl(cur.String())
+			links, err := ws.fetchHTMLcontent(cur, context.Background(), norm, 0)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("fetchHTMLcontent(%s) error = %v, wantErr %t", tt.path, err, tt.wantErr)
+			}
+			if !strings.Contains(accept, "application/pdf") || !strings.HasPrefix(accept, "text/html") {
+				t.Errorf("Accept = %q", accept)
+			}
+			if tt.wantErr {
+				if len(idx.indexed) != 0 {
+					t.Errorf("indexed %d bytes of %s", len(idx.indexed[0]), tt.path)
+				}
+				return
+			}
+			if len(links) != 0 {
+				t.Errorf("links from %s = %v, want none", tt.path, links)
+			}
+			if len(idx.indexed) != 1 || idx.indexed[0] != tt.text {
+				t.Errorf("indexed %q, want %q", idx.indexed, tt.text)
+			}
+		})
+	}
+}
+
+func TestIngestWARC(t *testing.T) {
+	var gzipped bytes.Buffer
+	zw := gzip.NewWriter(&gzipped)
+	io.WriteString(zw, "<html><body><p>compressed transfer body</p></body></html>")
+	zw.Close()
+
+	records := []struct{ typ, uri, ctype, block string }{
+		{"warcinfo", "", "application/warc-fields", "software: wget\r\n"},
+		{"request", "https://example.org/", "application/http; msgtype=request", "GET / HTTP/1.1\r\n\r\n"},
+		{"response", "https://example.org/", "application/http; msgtype=response",
+			"HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nTransfer-Encoding: chunked\r\n\r\n19\r\n<html><p>chunked page</p>\r\n0\r\n\r\n"},
+		{"response", "https://example.org/gz", "application/http; msgtype=response",
+			"HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nContent-Encoding: gzip\r\n\r\n" + gzipped.String()},
+		{"response", "https://example.org/missing", "application/http; msgtype=response", "HTTP/1.1 404 Not Found\r\nContent-Type: text/html\r\n\r\n<p>nope</p>"},
+		{"response", "https://example.org/logo.png", "application/http; msgtype=response", "HTTP/1.1 200 OK\r\nContent-Type: image/png\r\n\r\n\x89PNG"},
+		{"resource", "https://example.org/notes.txt", "text/plain", "plain resource record"},
+	}
+	var archive bytes.Buffer
+	for _, r := range records {
+		zw := gzip.NewWriter(&archive)
+		fmt.Fprintf(zw, "WARC/1.1\r\nWARC-Type: %s\r\nWARC-Target-URI: %s\r\nContent-Type: %s\r\nContent-Length: %d\r\n\r\n%s\r\n\r\n",
+			r.typ, r.uri, r.ctype, len(r.block), r.block)
+		zw.Close()
+	}
+	name := filepath.Join(t.TempDir(), "crawl.warc.gz")
+	if err := os.WriteFile(name, archive.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	idx := newFakeIndexer()
+	ws := NewScraper(&sync.Map{}, &ConfigData{CacheCap: 10}, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, idx, context.Background())
+	stats, err := ws.IngestWARC(context.Background(), name)
+	if err != nil {
+		t.Fatalf("IngestWARC(): %v", err)
+	}
+	if stats != (IngestStats{Indexed: 3, Skipped: 2}) {
+		t.Errorf("stats = %+v", stats)
+	}
+	expected := []string{"chunked page\n", "compressed transfer body\n", "plain resource record\n"}
+	if !reflect.DeepEqual(idx.indexed, expected) {
+		t.Errorf("indexed %q, want %q", idx.indexed, expected)
+	}
+}
+
+func TestArchiveReplay(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			io.WriteString(w, "<html><head><title>Home</title></head>\n<body><p>archived page</p>\n<p>second line</p></body></html>")
+		case "/notes.md":
+			w.Header().Set("Content-Type", "text/markdown")
+			io.WriteString(w, "# Notes\n\narchived notes\n")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, "<p>not found</p>")
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	archive, err := warc.NewWriter(dir, "test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := newFakeIndexer()
+	ws := newTestScraper(idx, srv)
+	ws.cfg.Archive = archive
+	for _, p := range []string{"/", "/notes.md", "/missing"} {
+		cur, _ := url.Parse(srv.URL + p)
+		norm, _ := normalizeUrl(cur.String())
+		ws.fetchHTMLcontent(cur, context.Background(), norm, 0)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed := newFakeIndexer()
+	rs := NewScraper(&sync.Map{}, &ConfigData{CacheCap: 10}, slog.New(slog.NewTextHandler(io.Discard, nil)), nil, replayed, context.Background())
+	stats, err := rs.IngestWARC(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("IngestWARC(): %v", err)
+	}
+	if stats != (IngestStats{Indexed: 2, Skipped: 1}) {
+		t.Errorf("stats = %+v, want the 404 skipped", stats)
+	}
+	if len(idx.indexed) != 2 || !reflect.DeepEqual(replayed.indexed, idx.indexed) {
+		t.Errorf("replayed %q, crawled %q", replayed.indexed, idx.indexed)
+	}
+}
+
+func TestRobotsPolicy(t *testing.T) {
+	var mu sync.Mutex
+	hits := map[string]int{}
+	var agent string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.RequestURI()]++
+		if r.URL.Path == "/robots.txt" {
+			agent = r.Header.Get("User-Agent")
+		}
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/robots.txt":
+			io.WriteString(w, "User-agent: *\nDisallow: /\n\nUser-agent: testbot\nDisallow: /private\nDisallow: /*.pdf$\nAllow: /private/open\n")
+		case "/":
+			io.WriteString(w, `<html><body><p>root page</p><a href="/private/x">x</a><a href="/private/open/y">y</a><a href="/paper.pdf">pdf</a><a href="/paper.pdf?v=2">pdf2</a></body></html>`)
+		case "/private/open/y", "/paper.pdf", "/private/x":
+			io.WriteString(w, "<html><body><p>page " + r.URL.Path + "</p></body></html>")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, "<html><body>not found")
+		}
+	}))
+	defer srv.Close()
+
+	idx := newFakeIndexer()
+	ws := newTestScraper(idx, srv)
+	ws.token, ws.userAgent = "TestBot", userAgentHeader("TestBot")
+	ws.cfg.Depth, ws.cfg.StartURLs = 3, []string{srv.URL + "/", srv.URL + "/private/x"}
+	ws.pool = wpool.NewWorkerPool(2, 10, context.Background())
+	ws.Run()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if hits["/robots.txt"] != 1 {
+		t.Errorf("robots.txt fetched %d times, want once per host", hits["/robots.txt"])
+	}
+	if agent != "Mozilla/5.0 (compatible; TestBot/1.0)" {
+		t.Errorf("User-Agent = %q", agent)
+	}
+	if hits["/private/x"] != 0 || hits["/paper.pdf"] != 0 {
+		t.Errorf("disallowed pages were fetched: %v", hits)
+	}
+	if n := ws.Stats().Skipped[SkipRobotsTxt]; n != 1 { // стартовая /private/x, ссылки на запрещенные страницы отсеиваются еще при разборе
+		t.Errorf("Stats().Skipped[%s] = %d, want 1", SkipRobotsTxt, n)
+	}
+	disallowed, _ := normalizeUrl(srv.URL + "/private/x")
+	if meta := idx.fetches[sha256.Sum256([]byte(disallowed))]; meta == nil || meta.SkipReason != SkipRobotsTxt || meta.NextFetchAt.IsZero() {
+		t.Errorf("fetch meta of disallowed page = %+v, want skip reason %q and next check", meta, SkipRobotsTxt)
+	}
+	if hits["/private/open/y"] != 1 || hits["/"] != 1 || hits["/paper.pdf?v=2"] != 1 {
+		t.Errorf("allowed pages were not fetched once: %v", hits)
+	}
+
+	base, _ := url.Parse(srv.URL)
+	ws.rbMu.Lock()
+	ws.robots[base.Scheme + "://" + base.Host].expires = time.Now().Add(-time.Second)
+	ws.rbMu.Unlock()
+	mu.Unlock()
+	rules := ws.robotsFor(context.Background(), base)
+	mu.Lock()
+	if hits["/robots.txt"] != 2 || rules.IsAllowed(ws.token, "/private/x") {
+		t.Errorf("expired robots.txt was not fetched again: %d fetches", hits["/robots.txt"])
+	}
+}
+
+type fakeClock struct {
+	mu 			sync.Mutex
+	now 		time.Time
+	timers 		[]fakeTimer
+	auto 		bool // каждое ожидание сразу сдвигает время, для тестов через http
+}
+
+type fakeTimer struct {
+	at 		time.Time
+	ch 		chan time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 || c.auto {
+		c.now = c.now.Add(max(d, 0))
+		ch <- c.now
+		return ch
+	}
+	c.timers = append(c.timers, fakeTimer{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.ch <- c.now
+	}
+	c.timers = pending
+}
+
+func (c *fakeClock) waitTimers(t *testing.T, n int) { // пока ждущий воркер не заведет таймер
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		got := len(c.timers)
+		c.mu.Unlock()
+		if got >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("no worker is waiting on the clock")
+}
+
+func acquireAsync(p *politeness, host string) chan error {
+	done := make(chan error, 1)
+	go func() { done <- p.Acquire(context.Background(), host) }()
+	return done
+}
+
+func acquired(done chan error, wait time.Duration) bool {
+	select {
+	case err := <-done:
+		return err == nil
+	case <-time.After(wait):
+		return false
+	}
+}
+
+func TestPolitenessDelay(t *testing.T) {
+	clk := &fakeClock{now: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)}
+	p := newPoliteness(PolitenessConfig{MaxConns: 4, MinDelay: 2 * time.Second}, clk)
+
+	if err := p.Acquire(context.Background(), "a.com"); err != nil {
+		t.Fatal(err)
+	}
+	next := acquireAsync(p, "a.com")
+	clk.waitTimers(t, 1)
+	if !acquired(acquireAsync(p, "b.com"), time.Second) {
+		t.Fatalf("other host waits for a.com")
+	}
+	clk.Advance(time.Second)
+	if acquired(next, 20 * time.Millisecond) {
+		t.Fatalf("second request to a.com started before min delay")
+	}
+	clk.Advance(time.Second)
+	if !acquired(next, time.Second) {
+		t.Fatalf("second request to a.com did not start after min delay")
+	}
+
+	p.SetCrawlDelay("a.com", 10 * time.Second) // Crawl-delay больше min delay
+	p.Release("a.com", 200, "")
+	p.Release("a.com", 200, "")
+	clk.Advance(2 * time.Second)
+	if err := p.Acquire(context.Background(), "a.com"); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.readyAt("a.com").Sub(clk.Now()); got != 10 * time.Second {
+		t.Errorf("interval with crawl-delay = %s, want 10s", got)
+	}
+}
+
+func TestPolitenessMaxConns(t *testing.T) {
+	clk := &fakeClock{now: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)}
+	p := newPoliteness(PolitenessConfig{MaxConns: 1}, clk)
+	if err := p.Acquire(context.Background(), "a.com"); err != nil {
+		t.Fatal(err)
+	}
+	next := acquireAsync(p, "a.com")
+	if acquired(next, 20 * time.Millisecond) {
+		t.Fatalf("second connection opened over the limit")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := p.Acquire(ctx, "a.com"); err == nil {
+		t.Fatalf("Acquire with cancelled context succeeded")
+	}
+
+	p.Release("a.com", 200, "")
+	if !acquired(next, time.Second) {
+		t.Fatalf("queued request did not get the released connection")
+	}
+}
+
+func TestPolitenessBackoff(t *testing.T) {
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name 		string
+		statuses 	[]int
+		retryAfter 	string
+		wait 		time.Duration // от последнего ответа до следующего запроса
+	}{
+		{"min delay only", []int{200}, "", time.Second},
+		{"first 429", []int{429}, "", minBackoff},
+		{"backoff doubles", []int{503, 503}, "", 2 * minBackoff},
+		{"capped", []int{429, 429, 429, 429, 429, 429}, "", time.Minute},
+		{"retry-after seconds", []int{429}, "30", 30 * time.Second},
+		{"retry-after date", []int{503}, start.Add(45 * time.Second).Format(http.TimeFormat), 45 * time.Second},
+		{"retry-after over the cap", []int{429}, "86400", time.Minute},
+		{"success decays backoff", []int{429, 429, 200, 200}, "", minBackoff},
+		{"backoff below minimum is dropped", []int{429, 200, 200}, "", time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := &fakeClock{now: start}
+			p := newPoliteness(PolitenessConfig{MinDelay: time.Second, MaxBackoff: time.Minute}, clk)
+			for i, status := range tt.statuses {
+				p.mu.Lock()
+				p.host("a.com").next = clk.now // каждый ответ приходит, когда хост уже свободен
+				p.mu.Unlock()
+				if err := p.Acquire(context.Background(), "a.com"); err != nil {
+					t.Fatal(err)
+				}
+				ra := ""
+				if i == len(tt.statuses) - 1 {
+					ra = tt.retryAfter
+				}
+				p.Release("a.com", status, ra)
+			}
+			if got := p.readyAt("a.com").Sub(start); got != tt.wait {
+				t.Errorf("next request after %s, want %s", got, tt.wait)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	for value, want := range map[string]time.Duration{
+		"120": 									2 * time.Minute,
+		" 5 ": 									5 * time.Second,
+		"-3": 									0,
+		"Thu, 01 Oct 2026 12:01:00 GMT": 		time.Minute,
+		"Thu, 01 Oct 2026 11:00:00 GMT": 		0,
+		"soon": 								0,
+		"": 									0,
+	} {
+		if got := parseRetryAfter(value, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", value, got, want)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: time.Second, MaxDelay: 10 * time.Second, Jitter: 0.5}
+	tests := []struct {
+		attempt 	int
+		retryAfter 	time.Duration
+		random 		float64
+		want 		time.Duration
+	}{
+		{1, 0, 0, time.Second},
+		{2, 0, 0, 2 * time.Second},
+		{3, 0, 0, 4 * time.Second},
+		{10, 0, 0, 10 * time.Second},
+		{3, 0, 1, 2 * time.Second}, // разброс срезает до половины
+		{3, 0, 0.5, 3 * time.Second},
+		{1, 7 * time.Second, 0, 7 * time.Second},
+		{1, time.Hour, 0, 10 * time.Second},
+		{3, time.Second, 0, 4 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := p.delay(tt.attempt, tt.retryAfter, tt.random); got != tt.want {
+			t.Errorf("delay(%d, %s, %v) = %s, want %s", tt.attempt, tt.retryAfter, tt.random, got, tt.want)
+		}
+	}
+	if got := (RetryPolicy{}).attempts(); got != numOfTries {
+		t.Errorf("default attempts = %d, want %d", got, numOfTries)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name 	string
+		err 	error
+		want 	bool
+	}{
+		{"429", &statusError{Code: 429}, true},
+		{"503", &statusError{Code: 503}, true},
+		{"501", &statusError{Code: 501}, false},
+		{"404", &statusError{Code: 404}, false},
+		{"robots 500", &parser.StatusError{Code: 500}, true},
+		{"timeout", &url.Error{Op: "Get", URL: "https://a", Err: context.DeadlineExceeded}, true},
+		{"cancelled", &url.Error{Op: "Get", URL: "https://a", Err: context.Canceled}, false},
+		{"reset", &url.Error{Op: "Get", URL: "https://a", Err: syscall.ECONNRESET}, true},
+		{"eof", &url.Error{Op: "Get", URL: "https://a", Err: io.EOF}, true},
+		{"no such host", &net.DNSError{Err: "no such host", Name: "a", IsNotFound: true}, false},
+		{"dns timeout", &net.DNSError{Err: "timeout", Name: "a", IsTimeout: true}, true},
+		{"bad certificate", &url.Error{Op: "Get", URL: "https://a", Err: x509.UnknownAuthorityError{}}, false},
+		{"other", errors.New("unsupported content type"), false},
+	}
+	for _, tt := range tests {
+		if got := retryable(tt.err); got != tt.want {
+			t.Errorf("retryable(%s) = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFetchRetries(t *testing.T) {
+	var mu sync.Mutex
+	hits := map[string]int{}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		n := hits[r.URL.Path]
+		mu.Unlock()
+		switch {
+		case r.URL.Path == "/robots.txt" && n == 1:
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.URL.Path == "/robots.txt":
+			io.WriteString(w, "User-agent: *\nDisallow: /private\n")
+		case r.URL.Path == "/flaky" && n <= 2:
+			w.WriteHeader(http.StatusBadGateway)
+		case r.URL.Path == "/flaky":
+			io.WriteString(w, "<html><body><p>finally</p></body></html>")
+		case r.URL.Path == "/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	clk := &fakeClock{now: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC), auto: true}
+	ws := newTestScraper(newFakeIndexer(), srv)
+	ws.clock, ws.polite = clk, newPoliteness(PolitenessConfig{}, clk)
+	ws.cfg.Retry = RetryPolicy{Attempts: 3, BaseDelay: time.Second}
+
+	base, _ := url.Parse(srv.URL)
+	start := clk.Now()
+	if rules := ws.robotsFor(context.Background(), base); rules.IsAllowed(ws.token, "/private") || !rules.IsAllowed(ws.token, "/") {
+		t.Errorf("robots.txt after a retried 503 was not applied")
+	}
+	if waited := clk.Now().Sub(start); waited < 7 * time.Second {
+		t.Errorf("waited %s before retrying robots.txt, want Retry-After 7s", waited)
+	}
+
+	tests := []struct {
+		path 		string
+		hits 		int
+		code 		int // 0 - без ошибки
+		gaveUp 		bool
+	}{
+		{"/flaky", 3, 0, false},
+		{"/broken", 3, 500, true},
+		{"/missing", 1, 404, false},
+	}
+	for _, tt := range tests {
+		doc, _, err := ws.getHTML(srv.URL + tt.path, nil)
+		if tt.code == 0 {
+			if err != nil || !strings.Contains(doc, "finally") {
+				t.Errorf("getHTML(%s) = %q, %v", tt.path, doc, err)
+			}
+		} else {
+			se := (*statusError)(nil)
+			re := (*RetryError)(nil)
+			if !errors.As(err, &se) || se.Code != tt.code || errors.As(err, &re) != tt.gaveUp {
+				t.Errorf("getHTML(%s) error = %v, want status %d, gave up %t", tt.path, err, tt.code, tt.gaveUp)
+			}
+			if tt.gaveUp && re.Attempts != 3 {
+				t.Errorf("RetryError.Attempts = %d, want 3", re.Attempts)
+			}
+		}
+		mu.Lock()
+		if hits[tt.path] != tt.hits {
+			t.Errorf("%s requested %d times, want %d", tt.path, hits[tt.path], tt.hits)
+		}
+		mu.Unlock()
+	}
+
+	if got := ws.Stats(); !reflect.DeepEqual(got, CrawlStats{Requests: 9, Retries: 5, GaveUp: 1, Skipped: map[string]int64{}}) {
+		t.Errorf("Stats() = %+v", got)
+	}
+}
@@ -2,13 +2,18 @@ package scraper
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/xml"
 	"errors"
+	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"wfts/internal/utils/parser"
 	"golang.org/x/net/html/charset"
@@ -16,45 +21,61 @@ import (
 
 const (
 	BaseXMLPageError = "sitemap page"
+	RobotsDisallowedError = "disallowed by robots.txt"
 	sitemap = "sitemap"
+	maxSitemapDepth = 2 // карта из robots.txt - уровень 0: index -> index -> urlset, глубже вложенные индексы не читаются
+	maxSitemapFiles = 50 // на хост
+	maxSitemapURLs = 50000 // как лимит одного файла в протоколе sitemaps
+	maxSitemapSize = 50 << 20 // после распаковки
 )
 
-func (ws *WebScraper) fetchPageRulesAndOffers(ctx context.Context, cur *url.URL) ([]*linkToken, *parser.RobotsTxt, error) {
-	robotsTXT := &parser.RobotsTxt{}
-	if r, err := parser.FetchRobotsTxt(ctx, cur.String(), ws.client); r != "" && err == nil {
-		*robotsTXT = *parser.ParseRobotsTxt(r)
-		ws.rlMu.Lock()
-		if lim := ws.rlMap[cur.Host]; (lim == nil || lim.R == DefaultDelay) && robotsTXT.Rules["*"].Delay > 0 {
-			ws.rlMap[cur.Host] = NewRateLimiter(robotsTXT.Rules["*"].Delay)
-		} else if lim == nil {
-			ws.rlMap[cur.Host] = NewRateLimiter(DefaultDelay)
-		}
-		ws.rlMu.Unlock()
-	} else {
-		robotsTXT = nil
+func (ws *WebScraper) fetchPageRulesAndOffers(ctx context.Context, cur *url.URL) ([]*linkToken, *parser.RobotsTxt, error) { // ссылки из карт сайта отдаются только при первой странице хоста
+	robotsTXT := ws.robotsFor(ctx, cur)
+	if !robotsTXT.IsAllowed(ws.token, cur.RequestURI()) {
+		return nil, robotsTXT, errors.New(RobotsDisallowedError)
 	}
 
-	links, err := ws.prepareSitemapLinks(cur)
-	return links, robotsTXT, err
-}
-
-func (ws *WebScraper) haveSitemap(url *url.URL) ([]string, error) {
-	sitemapURL := url.String()
-	if !strings.Contains(sitemapURL, sitemap) {
-		sitemapURL = strings.TrimSuffix(url.String(), "/")
-		sitemapURL = sitemapURL + "/" + sitemap + ".xml"
+	if isSitemapURL(cur) { // на карту сайта сослалась страница, разбирается как карта, а не как html
+		if _, seen := ws.sitemapsSeen.LoadOrStore(cur.String(), true); seen {
+			return nil, robotsTXT, errors.New(BaseXMLPageError)
+		}
+		links, err := ws.prepareSitemapLinks(ctx, cur, []string{cur.String()})
+		if err == nil {
+			err = errors.New(BaseXMLPageError)
+		}
+		return links, robotsTXT, err
 	}
 
-	urls, err := ws.processSitemap(url, sitemapURL)
-	if err != nil {
-		return nil, err
+	origin := cur.Scheme + "://" + cur.Host
+	if _, seen := ws.sitemapsSeen.LoadOrStore(origin, true); seen {
+		return nil, robotsTXT, nil
+	}
+	sitemaps := robotsTXT.Sitemaps
+	if len(sitemaps) == 0 {
+		sitemaps = []string{origin + "/" + sitemap + ".xml"}
+	}
+	links, err := ws.prepareSitemapLinks(ctx, cur, sitemaps)
+	if err != nil { // без карты сайта хост обходится по ссылкам
+		ws.log.Debug(fmt.Sprintf("no sitemap for %s: %v", origin, err))
 	}
+	return links, robotsTXT, nil
+}
+
+func isSitemapURL(u *url.URL) bool {
+	p := strings.ToLower(u.Path)
+	return strings.Contains(p, sitemap) && (strings.HasSuffix(p, ".xml") || strings.HasSuffix(p, ".xml.gz"))
+}
 
-	return urls, err
+type sitemapEntry struct {
+	Loc 		string 	`xml:"loc"`
+	LastMod 	string 	`xml:"lastmod"`
+	ChangeFreq 	string 	`xml:"changefreq"`
+	Priority 	string 	`xml:"priority"`
+	Index 		bool 	`xml:"-"` // <sitemap> из sitemapindex, ссылка на следующую карту
 }
 
-func decodeSitemap(r io.Reader) ([]string, error) {
-	var urls []string
+func decodeSitemap(r io.Reader) ([]sitemapEntry, error) {
+	var entries []sitemapEntry
 	dec := xml.NewDecoder(r)
 	dec.CharsetReader = charset.NewReaderLabel
 	for {
@@ -67,72 +88,175 @@ func decodeSitemap(r io.Reader) ([]string, error) {
 		}
 
 		if element, ok := token.(xml.StartElement); ok {
-			if element.Name.Local == "loc" {
+			switch element.Name.Local {
+			case "url", "sitemap":
+				var entry sitemapEntry
+				if err := dec.DecodeElement(&entry, &element); err != nil || entry.Loc == "" {
+					continue
+				}
+				entry.Index = element.Name.Local == "sitemap"
+				entries = append(entries, entry)
+			case "loc": // loc вне url/sitemap, нестрогие карты сайта
 				var url string
 				if err := dec.DecodeElement(&url, &element); err != nil {
 					continue
 				}
-				urls = append(urls, url)
+				entries = append(entries, sitemapEntry{Loc: url})
 			}
 		}
 	}
 
-	return urls, nil
+	return entries, nil
 }
 
-func (ws *WebScraper) processSitemap(baseURL *url.URL, sitemapURL string) ([]string, error) {
-	sitemap, err := getSitemapURLs(sitemapURL, ws.client)
-	if err != nil {
-		return nil, err
+func (ws *WebScraper) collectSitemaps(ctx context.Context, sitemaps []string) ([]sitemapEntry, error) { // обход индексов в ширину, с лимитами на вложенность, число файлов и ссылок
+	type pending struct {
+		url 	string
+		level 	int
+	}
+	queue := make([]pending, 0, len(sitemaps))
+	for _, s := range sitemaps {
+		queue = append(queue, pending{url: s})
 	}
+	seen := map[string]bool{}
+	var pages []sitemapEntry
+	var lastErr error
+	for files := 0; len(queue) > 0 && files < maxSitemapFiles && len(pages) < maxSitemapURLs; {
+		next := queue[0]
+		queue = queue[1:]
+		if seen[next.url] {
+			continue
+		}
+		seen[next.url] = true
+		files++
 
-	var nextUrls []string
-	for _, item := range sitemap {
-		abs, err := makeAbsoluteURL(item, baseURL)
-		if abs == "" || err != nil {
+		var entries []sitemapEntry
+		err := ws.withRetry(ctx, next.url, func() error {
+			var err error
+			entries, err = ws.fetchSitemap(ctx, next.url)
+			return err
+		})
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %w", next.url, err)
 			continue
 		}
-		nextUrls = append(nextUrls, abs)
+		base, _ := url.Parse(next.url)
+		for _, entry := range entries {
+			if !entry.Index {
+				pages = append(pages, entry)
+				continue
+			}
+			if next.level + 1 > maxSitemapDepth {
+				continue
+			}
+			if loc, err := base.Parse(strings.TrimSpace(entry.Loc)); err == nil {
+				queue = append(queue, pending{url: loc.String(), level: next.level + 1})
+			}
+		}
+	}
+	if len(pages) > maxSitemapURLs {
+		pages = pages[:maxSitemapURLs]
 	}
+	if len(pages) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return pages, nil
+}
 
-	return nextUrls, nil
+func (ws *WebScraper) rememberHint(abs string, item sitemapEntry) { // подсказки для расписания повторного обхода
+	hint := sitemapHint{changeFreq: strings.ToLower(strings.TrimSpace(item.ChangeFreq))}
+	hint.lastMod, _ = parseLastMod(item.LastMod)
+	if hint.changeFreq == "" && hint.lastMod.IsZero() {
+		return
+	}
+	if normalized, err := normalizeUrl(abs); err == nil {
+		ws.hints.Store(normalized, hint)
+	}
 }
 
-func getSitemapURLs(URL string, cli *http.Client) ([]string, error) {
-	resp, err := cli.Get(URL)
+func sitemapPriority(item sitemapEntry, now time.Time) int { // <priority> 0..1 -> 0..10, по умолчанию 5, недавний <lastmod> поднимает страницу в очереди
+	priority := 0.5
+	if p, err := strconv.ParseFloat(strings.TrimSpace(item.Priority), 64); err == nil && p >= 0 && p <= 1 {
+		priority = p
+	}
+	rank := int(math.Round(priority * 10))
+	if lastMod, ok := parseLastMod(item.LastMod); ok {
+		switch age := now.Sub(lastMod); {
+		case age < 7 * 24 * time.Hour:
+			rank += 5
+		case age < 30 * 24 * time.Hour:
+			rank += 2
+		}
+	}
+	return rank
+}
+
+func (ws *WebScraper) fetchSitemap(ctx context.Context, URL string) ([]sitemapEntry, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", URL, nil)
 	if err != nil {
 		return nil, err
 	}
+	req.Header.Set("User-Agent", ws.userAgent)
+	if err := ws.polite.Acquire(ctx, req.URL.Host); err != nil {
+		return nil, err
+	}
+	resp, err := ws.client.Do(req)
+	if err != nil {
+		ws.polite.Release(req.URL.Host, 0, "")
+		return nil, err
+	}
 	defer resp.Body.Close()
+	defer ws.polite.Release(req.URL.Host, resp.StatusCode, resp.Header.Get("Retry-After"))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &statusError{Code: resp.StatusCode, RetryAfter: resp.Header.Get("Retry-After")}
+	}
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSitemapSize))
 	if err != nil {
 		return nil, err
 	}
+	if len(body) > 1 && body[0] == 0x1f && body[1] == 0x8b { // .xml.gz, отдается как application/gzip без Content-Encoding
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		if body, err = io.ReadAll(io.LimitReader(zr, maxSitemapSize)); err != nil {
+			return nil, err
+		}
+	}
 	body = bytes.TrimPrefix(bytes.ReplaceAll(body, []byte(`xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"`), []byte("")), []byte("\xef\xbb\xbf"))
-	return decodeSitemap(bytes.NewReader(bytes.TrimPrefix(body, []byte("\xef\xbb\xbf"))))
+	return decodeSitemap(bytes.NewReader(body))
 }
 
-func (ws *WebScraper) prepareSitemapLinks(current *url.URL) ([]*linkToken, error) {
-	links := make([]*linkToken, 0)
-	var urls []string
-	var err error
-	if urls, err = ws.haveSitemap(current); err == nil && len(urls) > 0 {
-		for _, link := range urls {
-			parsed, err := url.Parse(link)
-			if err != nil {
-				ws.log.Error("error parsing link: " + err.Error())
-				continue
-			}
-			same := isSameOrigin(parsed, current)
-			if !same && ws.cfg.OnlySameDomain {
-				continue
-			}
-			links = append(links, &linkToken{Link: parsed, SameDomain: same})
-		}
+func (ws *WebScraper) prepareSitemapLinks(ctx context.Context, current *url.URL, sitemaps []string) ([]*linkToken, error) {
+	entries, err := ws.collectSitemaps(ctx, sitemaps)
+	if err != nil {
+		return nil, err
 	}
-	if err == nil {
-		err = errors.New(BaseXMLPageError)
+	now := time.Now()
+	seed := seedOf(ctx)
+	links := make([]*linkToken, 0, len(entries))
+	for _, item := range entries {
+		abs, err := makeAbsoluteURL(strings.TrimSpace(item.Loc), current)
+		if abs == "" || err != nil {
+			continue
+		}
+		parsed, err := url.Parse(abs)
+		if err != nil {
+			ws.log.Error("error parsing link: " + err.Error())
+			continue
+		}
+		ws.cfg.Scope.stripParams(parsed)
+		if !ws.cfg.Scope.allows(parsed, seed) {
+			continue
+		}
+		same := isSameOrigin(parsed, current)
+		if !same && ws.cfg.OnlySameDomain {
+			continue
+		}
+		ws.rememberHint(parsed.String(), item)
+		links = append(links, &linkToken{Link: parsed, SameDomain: same, Priority: sitemapPriority(item, now)})
 	}
-	return links, err
-}
\ No newline at end of file
+	return links, nil
+}
@@ -0,0 +1,78 @@
+package scraper
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"wfts/internal/model"
+)
+
+type CrawlStats struct {
+	Requests 	int64 // все попытки, включая повторные
+	Retries 	int64
+	GaveUp 		int64 // адреса, на которых кончились попытки
+	Skipped 	map[string]int64 // причина из Skip* -> сколько раз страница или ссылка была пропущена
+}
+
+const (
+	SkipRobotsTxt = "robots.txt" // страница запрещена robots.txt и не скачивалась
+	SkipNoIndex = "noindex" // <meta name="robots" content="noindex">, ссылки страницы обходятся
+	SkipXRobotsNoIndex = "x-robots-tag noindex"
+	SkipNoFollow = "nofollow" // ссылки страницы не обходятся, из meta или X-Robots-Tag
+	SkipRelNoFollow = "rel=nofollow" // отдельные ссылки <a rel="nofollow">
+)
+
+type crawlCounters struct {
+	requests 	atomic.Int64
+	retries 	atomic.Int64
+	gaveUp 		atomic.Int64
+	mu 			sync.Mutex
+	skipped 	map[string]int64
+}
+
+func (c *crawlCounters) skip(reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.skipped == nil {
+		c.skipped = make(map[string]int64)
+	}
+	c.skipped[reason]++
+}
+
+func (ws *WebScraper) skipPage(fetched *model.FetchMeta, reason string) { // причина сохраняется в записи fetch: страницы и видна в crawl-status
+	ws.stats.skip(reason)
+	if fetched.SkipReason != "" {
+		fetched.SkipReason += ", "
+	}
+	fetched.SkipReason += reason
+}
+
+func (ws *WebScraper) skipDisallowed(cur *url.URL, norm string, depth int) { // страница не скачивалась, в записи fetch: только причина и срок следующей проверки
+	hashed := sha256.Sum256([]byte(norm))
+	prev, err := ws.idx.GetFetchMeta(hashed)
+	if err != nil {
+		ws.log.Error(fmt.Sprintf("error getting fetch meta: %s, with error: %v", cur, err))
+	}
+	fetched := &model.FetchMeta{FetchedAt: time.Now()}
+	ws.skipPage(fetched, SkipRobotsTxt)
+	ws.saveFetch(hashed, cur, norm, depth, prev, fetched, false)
+}
+
+func (ws *WebScraper) Stats() CrawlStats {
+	ws.stats.mu.Lock()
+	skipped := make(map[string]int64, len(ws.stats.skipped))
+	for reason, n := range ws.stats.skipped {
+		skipped[reason] = n
+	}
+	ws.stats.mu.Unlock()
+	return CrawlStats{
+		Requests: 	ws.stats.requests.Load(),
+		Retries: 	ws.stats.retries.Load(),
+		GaveUp: 	ws.stats.gaveUp.Load(),
+		Skipped: 	skipped,
+	}
+}
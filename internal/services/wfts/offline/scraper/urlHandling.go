@@ -1,8 +1,12 @@
 package scraper
 
 import (
+	"crypto/sha256"
 	"errors"
+	"fmt"
+	"net/http"
 	"net/url"
+	"slices"
 	"strings"
 )
 
@@ -43,7 +47,7 @@ func normalizeUrl(rawUrl string) (string, error) {
 	}
 	path = strings.TrimSuffix(path, "/")
 
-	query := p.Query().Encode()
+	query := p.Query().Encode() // трекинговые параметры не вырезаются: от этой строки считаются ключи посещенных и id уже проиндексированных страниц
 	var sb strings.Builder
 	sb.WriteString(host)
 	sb.WriteString(path)
@@ -54,10 +58,101 @@ func normalizeUrl(rawUrl string) (string, error) {
 	return sb.String(), nil
 }
 
+var trackingParams = map[string]bool{
+	"gclid": true, "dclid": true, "gbraid": true, "wbraid": true, "fbclid": true, "yclid": true, "msclkid": true,
+	"mc_cid": true, "mc_eid": true, "_ga": true, "_gl": true, "igshid": true, "ref_src": true,
+}
+
+func isTrackingParam(name string) bool { // метки рекламы и аналитики, на содержимое страницы не влияют
+	name = strings.ToLower(name)
+	return strings.HasPrefix(name, "utm_") || trackingParams[name]
+}
+
+func dropParams(u *url.URL, drop func(name string) bool) { // порядок и кодировка оставшихся параметров не меняются
+	if u.RawQuery == "" {
+		return
+	}
+	parts := strings.Split(u.RawQuery, "&")
+	kept := parts[:0]
+	for _, part := range parts {
+		name, _, _ := strings.Cut(part, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if !drop(name) {
+			kept = append(kept, part)
+		}
+	}
+	u.RawQuery = strings.Join(kept, "&")
+}
+
+func canonicalURL(u *url.URL) *url.URL { // адрес документа в индексе: без трекинговых параметров и фрагмента
+	c := *u
+	c.Fragment, c.RawFragment = "", ""
+	dropParams(&c, isTrackingParam)
+	return &c
+}
+
 func truncatePort(uri *url.URL) string {
 	return strings.Split(uri.Hostname(), ":")[0]
 }
 
-func isSameOrigin(rawURL *url.URL, baseURL *url.URL) bool {
-	return strings.Contains(truncatePort(baseURL), truncatePort(rawURL))
+func isSameOrigin(rawURL *url.URL, baseURL *url.URL) bool { // один зарегистрированный домен, поддомены тоже свои, x.com и box.com - разные
+	return registeredDomain(truncatePort(rawURL)) == registeredDomain(truncatePort(baseURL))
+}
+
+func redirectChain(resp *http.Response) []string { // клиент сам идет по редиректам, предыдущие запросы видны через Request.Response
+	if resp.Request == nil || resp.Request.Response == nil {
+		return nil
+	}
+	var chain []string
+	for req := resp.Request; req != nil; {
+		chain = append(chain, req.URL.String())
+		if req.Response == nil {
+			break
+		}
+		req = req.Response.Request
+	}
+	slices.Reverse(chain)
+	return chain
+}
+
+func (ws *WebScraper) canonicalize(cur *url.URL, declared string, seen []string) (string, [32]byte, []string) { // адрес и id документа, остальные адреса страницы - синонимы
+	canon := canonicalURL(cur)
+	if declared != "" {
+		if u, err := url.Parse(declared); err == nil && isSameOrigin(u, cur) { // чужой сайт не может забрать документ себе
+			canon = canonicalURL(u)
+		}
+	}
+	norm, err := normalizeUrl(canon.String())
+	if err != nil {
+		norm = canon.String()
+	}
+	var aliases []string
+	for _, alias := range seen {
+		if n, err := normalizeUrl(alias); err == nil && n != norm && !slices.Contains(aliases, alias) {
+			aliases = append(aliases, alias)
+		}
+	}
+	return canon.String(), sha256.Sum256([]byte(norm)), aliases
+}
+
+func (ws *WebScraper) dropAliases(docID [32]byte, aliases []string) { // копии страницы, проиндексированные раньше под другими адресами
+	for _, alias := range aliases {
+		norm, err := normalizeUrl(alias)
+		if err != nil {
+			continue
+		}
+		id := sha256.Sum256([]byte(norm))
+		if id == docID {
+			continue
+		}
+		if err := ws.idx.DeleteDocument(id); err != nil {
+			if err.Error() != "Key not found" {
+				ws.log.Error(fmt.Sprintf("error deleting alias document: %s, with error: %v", alias, err))
+			}
+			continue
+		}
+		ws.log.Debug("dropped duplicate document indexed under alias: " + alias)
+	}
 }
\ No newline at end of file
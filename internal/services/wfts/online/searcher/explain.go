@@ -0,0 +1,71 @@
+package searcher
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+type TermExplanation struct {
+	Term 	string 		`json:"term"`
+	IDF 	float64 	`json:"idf"`
+	TF 		float64 	`json:"tf"`
+	BM25 	float64 	`json:"bm25"`
+	i 		int // порядок терма в запросе
+}
+
+type Explanation struct {
+	Score 			float64 			`json:"score"`
+	BM25 			float64 			`json:"bm25"`
+	TFIDF 			float64 			`json:"tf_idf"`
+	Terms 			[]TermExplanation 	`json:"terms"`
+	Proximity 		int 				`json:"proximity"` // минимальное окно со всеми термами, -1 если терм отсутствует
+	ProximityBonus 	float64 			`json:"proximity_bonus"`
+	HeaderBonus 	float64 			`json:"header_bonus"`
+	URLBonus 		float64 			`json:"url_bonus"`
+	Reranked 		bool 				`json:"reranked,omitempty"`
+	ModelScore 		float64 			`json:"model_score,omitempty"`
+}
+
+func (s *Searcher) explain(r requestRanking, queryLen int) *Explanation {
+	terms := slices.Clone(r.terms)
+	slices.SortFunc(terms, func(a, b TermExplanation) int { return a.i - b.i })
+	proximity := r.termProximity
+	if proximity == math.MaxInt {
+		proximity = -1
+	}
+	proximityBonus, header, url := s.bonuses(r, queryLen)
+	return &Explanation{
+		Score: 			r.score,
+		BM25: 			r.bm25,
+		TFIDF: 			r.tf_idf,
+		Terms: 			terms,
+		Proximity: 		proximity,
+		ProximityBonus: proximityBonus,
+		HeaderBonus: 	header,
+		URLBonus: 		url,
+		Reranked: 		r.reranked,
+		ModelScore: 	r.model,
+	}
+}
+
+func (e *Explanation) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "score %.4f = bm25 + proximity + header + url\n", e.Score)
+	if e.Reranked {
+		fmt.Fprintf(&sb, "  model %.4f = learned model over features, orders the top results\n", e.ModelScore)
+	}
+	fmt.Fprintf(&sb, "  bm25 %.4f, tf-idf %.4f\n", e.BM25, e.TFIDF)
+	for _, t := range e.Terms {
+		fmt.Fprintf(&sb, "  term %q: idf %.4f, tf %.4f, bm25 %.4f\n", t.Term, t.IDF, t.TF, t.BM25)
+	}
+	if e.Proximity < 0 {
+		sb.WriteString("  proximity: not all terms present\n")
+	} else {
+		fmt.Fprintf(&sb, "  proximity: window %d, bonus %.4f\n", e.Proximity, e.ProximityBonus)
+	}
+	fmt.Fprintf(&sb, "  header bonus: %.4f\n", e.HeaderBonus)
+	fmt.Fprintf(&sb, "  url bonus: %.4f", e.URLBonus)
+	return sb.String()
+}
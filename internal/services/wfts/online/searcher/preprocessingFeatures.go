@@ -2,13 +2,12 @@ package searcher
 
 import (
 	"math"
+	"sort"
 
 	"wfts/internal/model"
 )
 
-func calcBM25(idf float64, tf float64, doc *model.Document, avgLen float64) float64 {
-	k1 := 1.2
-	b := 0.75
+func calcBM25(idf float64, tf float64, doc *model.Document, avgLen float64, k1, b float64) float64 {
 	return idf * (tf * (k1 + 1)) / (tf + k1 * (1 - b + b * float64(doc.TokenCount) / avgLen))
 }
 
@@ -54,6 +53,62 @@ func getMinQueryDistInDoc(positions [][]model.Position, lenQuery int) int {
 	return minDencity
 }
 
+func phraseMatches(positions [][]model.Position, slop int) bool {
+	if len(positions) == 0 {
+		return false
+	}
+	dist := getMinQueryDistInDoc(positions, len(positions))
+	return dist != math.MaxInt && dist - (len(positions) - 1) <= slop // соседние термы дают расстояние ровно len - 1
+}
+
+func densestWindow(positions [][]model.Position, width, limit int) []int { // окно из width позиций с наибольшим числом разных термов запроса
+	type hit struct {
+		pos 	int
+		term 	int
+	}
+	flat := []hit{}
+	for term, arr := range positions {
+		for _, p := range arr {
+			if p.I < limit {
+				flat = append(flat, hit{pos: p.I, term: term})
+			}
+		}
+	}
+	if len(flat) == 0 {
+		return nil
+	}
+	sort.Slice(flat, func(i, j int) bool { return flat[i].pos < flat[j].pos })
+
+	inWindow := make([]int, len(positions))
+	distinct := 0
+	bestL, bestR, bestDistinct := 0, 0, -1
+	left := 0
+	for right := range flat {
+		if inWindow[flat[right].term] == 0 {
+			distinct++
+		}
+		inWindow[flat[right].term]++
+		for flat[right].pos - flat[left].pos >= width {
+			inWindow[flat[left].term]--
+			if inWindow[flat[left].term] == 0 {
+				distinct--
+			}
+			left++
+		}
+		if distinct > bestDistinct || (distinct == bestDistinct && right - left > bestR - bestL) {
+			bestL, bestR, bestDistinct = left, right, distinct
+		}
+	}
+
+	out := []int{}
+	for _, h := range flat[bestL:bestR + 1] {
+		if len(out) == 0 || out[len(out) - 1] != h.pos {
+			out = append(out, h.pos)
+		}
+	}
+	return out
+}
+
 func boyerMoorAlgorithm(url string, queryWords []string) (bool, float64) {
 	wordInUrl := 0.0
 	urlRunes := []rune(url)
@@ -76,9 +131,8 @@ func boyerMoorAlgorithm(url string, queryWords []string) (bool, float64) {
 					strp += l
 				}
 			} else {
-				tmp := l // чтобы если отрезки не равны не вернуться в ту же точку
+				end := strp // при частичном совпадении сдвигаемся на один от конца окна, иначе пропускаем вхождения вроде kafka в "/kafka"
 				for sstrp >= 0 && queryWord[sstrp] == urlRunes[strp] {
-					tmp++
 					sstrp--
 					strp--
 				}
@@ -86,7 +140,7 @@ func boyerMoorAlgorithm(url string, queryWords []string) (bool, float64) {
 					wordInUrl += float64(l)
 					break
 				} else {
-					strp += tmp
+					strp = end + 1
 					sstrp = l - 1
 				}
 			}
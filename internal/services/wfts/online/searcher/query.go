@@ -0,0 +1,694 @@
+package searcher
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"wfts/internal/model"
+)
+
+type tokenKind int
+
+const (
+	wordToken tokenKind = iota
+	phraseToken
+	andToken
+	orToken
+	notToken
+	plusToken
+	minusToken
+	lParenToken
+	rParenToken
+	fieldToken
+)
+
+const (
+	siteField = "site"
+	urlField = "url"
+	titleField = "title"
+	headerField = "header"
+)
+
+type queryToken struct {
+	kind 	tokenKind
+	text 	string
+	slop 	int
+	field 	string
+	phrase 	bool
+}
+
+type occur int
+
+const (
+	should occur = iota
+	must
+	mustNot
+	filter // фильтр по полю: сужает выдачу, не делая остальные термы необязательными
+)
+
+type docSet map[[32]byte]struct{}
+
+type queryNode interface {
+	eval(e *evaluator, negated bool) (docSet, error) // nil означает что узел не накладывает ограничений (например запрос из стоп слов)
+	String() string
+}
+
+type termNode struct {
+	text 		string
+	corrected 	string
+}
+
+type phraseNode struct {
+	text 		string
+	slop 		int
+	corrected 	string
+}
+
+type andNode struct {
+	children []queryNode
+}
+
+type orNode struct {
+	children []queryNode
+}
+
+type notNode struct {
+	child queryNode
+}
+
+type fieldNode struct {
+	field 		string
+	value 		string
+	phrase 		bool
+	slop 		int
+	corrected 	string
+}
+
+type clause struct {
+	node 	queryNode
+	occur 	occur
+}
+
+type groupNode struct {
+	clauses []clause
+}
+
+func lexQuery(query string) []queryToken {
+	runes := []rune(query)
+	tokens := []queryToken{}
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: lParenToken})
+
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: rParenToken})
+
+		case r == '"':
+			var text string
+			var slop int
+			text, slop, i = scanPhrase(runes, i)
+			if text != "" {
+				tokens = append(tokens, queryToken{kind: phraseToken, text: text, slop: slop})
+			}
+
+		case r == '+' || r == '-':
+			if i + 1 < len(runes) && !unicode.IsSpace(runes[i + 1]) {
+				kind := plusToken
+				if r == '-' {
+					kind = minusToken
+				}
+				tokens = append(tokens, queryToken{kind: kind})
+			}
+
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && runes[j] != '(' && runes[j] != ')' && runes[j] != '"' {
+				j++
+			}
+			word := string(runes[i:j])
+			i = j - 1
+			if field, value, ok := strings.Cut(word, ":"); ok && isField(strings.ToLower(field)) {
+				field = strings.ToLower(field)
+				if value == "" && j < len(runes) && runes[j] == '"' && field != siteField { // title:"living standard"
+					var slop int
+					value, slop, i = scanPhrase(runes, j)
+					if value != "" {
+						tokens = append(tokens, queryToken{kind: fieldToken, field: field, text: value, slop: slop, phrase: true})
+					}
+					continue
+				}
+				if value != "" {
+					tokens = append(tokens, queryToken{kind: fieldToken, field: field, text: value})
+					continue
+				}
+			}
+			switch word { // операторы только в верхнем регистре, чтобы не путать с обычными словами
+			case "AND", "&&":
+				tokens = append(tokens, queryToken{kind: andToken})
+			case "OR", "||":
+				tokens = append(tokens, queryToken{kind: orToken})
+			case "NOT":
+				tokens = append(tokens, queryToken{kind: notToken})
+			default:
+				tokens = append(tokens, queryToken{kind: wordToken, text: word})
+			}
+		}
+	}
+
+	return tokens
+}
+
+func scanPhrase(runes []rune, i int) (string, int, int) {
+	end := i + 1
+	for end < len(runes) && runes[end] != '"' {
+		end++
+	}
+	text := strings.TrimSpace(string(runes[i + 1:end]))
+	i = end
+
+	slop := 0
+	if i + 1 < len(runes) && runes[i + 1] == '~' { // "a b"~3
+		j := i + 2
+		for j < len(runes) && unicode.IsDigit(runes[j]) {
+			j++
+		}
+		if n, err := strconv.Atoi(string(runes[i + 2:j])); err == nil {
+			slop = n
+		}
+		i = j - 1
+	}
+	return text, slop, i
+}
+
+func isField(field string) bool {
+	switch field {
+	case siteField, urlField, titleField, headerField:
+		return true
+	}
+	return false
+}
+
+type queryParser struct {
+	tokens 	[]queryToken
+	pos 	int
+}
+
+func parseQuery(query string) (*groupNode, error) {
+	p := &queryParser{tokens: lexQuery(query)}
+	root := &groupNode{}
+	for {
+		root.clauses = append(root.clauses, p.parseGroup().clauses...)
+		if p.pos >= len(p.tokens) {
+			break
+		}
+		p.pos++ // лишняя закрывающая скобка
+	}
+	if len(root.clauses) == 0 {
+		return nil, errors.New("empty query")
+	}
+	return root, nil
+}
+
+func (p *queryParser) accept(kind tokenKind) bool {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == kind {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) parseGroup() *groupNode {
+	g := &groupNode{}
+	for p.pos < len(p.tokens) {
+		switch p.tokens[p.pos].kind {
+		case rParenToken:
+			return g
+		case andToken, orToken: // висячий оператор
+			p.pos++
+			continue
+		}
+		if node, occ := p.parseOr(); node != nil {
+			g.clauses = append(g.clauses, clause{node: node, occur: occ})
+		}
+	}
+	return g
+}
+
+func (p *queryParser) parseOr() (queryNode, occur) {
+	node, occ := p.parseAnd()
+	children := []queryNode{}
+	if node != nil {
+		children = append(children, bindOccur(node, occ))
+	}
+	filters := occ == filter
+	for p.accept(orToken) {
+		if next, nocc := p.parseAnd(); next != nil {
+			children = append(children, bindOccur(next, nocc))
+			filters = filters && nocc == filter
+		}
+	}
+	if len(children) <= 1 {
+		return node, occ
+	}
+	if filters { // site:a.com OR site:b.com сужает выдачу так же, как один фильтр
+		return &orNode{children: children}, filter
+	}
+	return &orNode{children: children}, should
+}
+
+func (p *queryParser) parseAnd() (queryNode, occur) {
+	node, occ := p.parseUnary()
+	children := []queryNode{}
+	if node != nil {
+		children = append(children, bindOccur(node, occ))
+	}
+	for p.accept(andToken) {
+		if next, nocc := p.parseUnary(); next != nil {
+			children = append(children, bindOccur(next, nocc))
+		}
+	}
+	if len(children) <= 1 {
+		return node, occ
+	}
+	return &andNode{children: children}, should
+}
+
+func (p *queryParser) parseUnary() (queryNode, occur) {
+	if p.pos >= len(p.tokens) {
+		return nil, should
+	}
+	t := p.tokens[p.pos]
+	switch t.kind {
+	case plusToken:
+		p.pos++
+		node, occ := p.parseUnary()
+		if occ == mustNot {
+			return node, mustNot
+		}
+		return node, must
+
+	case minusToken, notToken:
+		p.pos++
+		node, occ := p.parseUnary()
+		if occ == mustNot { // NOT NOT x
+			return node, must
+		}
+		return node, mustNot
+
+	case lParenToken:
+		p.pos++
+		g := p.parseGroup()
+		p.accept(rParenToken)
+		if len(g.clauses) == 0 {
+			return nil, should
+		}
+		if len(g.clauses) == 1 {
+			return g.clauses[0].node, g.clauses[0].occur
+		}
+		return g, should
+
+	case wordToken:
+		p.pos++
+		return &termNode{text: t.text}, should
+
+	case phraseToken:
+		p.pos++
+		return &phraseNode{text: t.text, slop: t.slop}, should
+
+	case fieldToken:
+		p.pos++
+		return &fieldNode{field: t.field, value: t.text, phrase: t.phrase, slop: t.slop}, filter
+	}
+	return nil, should
+}
+
+func bindOccur(node queryNode, occ occur) queryNode {
+	if occ == mustNot {
+		return &notNode{child: node}
+	}
+	return node
+}
+
+type evaluator struct {
+	s 			*Searcher
+	universe 	docSet
+	docs 		[]*model.Document
+	words 		[]string
+	index 		[]map[[32]byte]model.WordCountAndPositions
+	corrected 	bool
+}
+
+func (e *evaluator) all() (docSet, error) {
+	if e.universe != nil {
+		return e.universe, nil
+	}
+	docs, err := e.s.repo.GetAllDocuments()
+	if err != nil {
+		return nil, err
+	}
+	e.docs = docs
+	e.universe = make(docSet, len(docs))
+	for _, doc := range docs {
+		e.universe[doc.Id] = struct{}{}
+	}
+	return e.universe, nil
+}
+
+func (e *evaluator) lookup(text string, negated bool) ([]string, []map[[32]byte]model.WordCountAndPositions, string, error) {
+	stems, index, corrected, err := e.s.idx.HandleTextQuery(text)
+	if err != nil {
+		if err.Error() == "empty tokens" { // лист из одних стоп слов
+			return nil, nil, "", nil
+		}
+		return nil, nil, "", err
+	}
+	if corrected != "" {
+		e.corrected = true
+	}
+	if !negated { // в ранжировании участвуют только положительные листья
+		e.words = append(e.words, stems...)
+		e.index = append(e.index, index...)
+	}
+	return stems, index, corrected, nil
+}
+
+func (n *termNode) eval(e *evaluator, negated bool) (docSet, error) {
+	stems, index, corrected, err := e.lookup(n.text, negated)
+	if err != nil || stems == nil {
+		return nil, err
+	}
+	n.corrected = corrected
+	docs := make(docSet)
+	for i := range stems {
+		for id := range index[i] {
+			docs[id] = struct{}{}
+		}
+	}
+	return docs, nil
+}
+
+func (n *phraseNode) eval(e *evaluator, negated bool) (docSet, error) {
+	stems, index, corrected, err := e.lookup(n.text, negated)
+	if err != nil || len(stems) == 0 { // фраза из одних стоп слов ничего не находит
+		return nil, err
+	}
+	n.corrected = corrected
+	docs := make(docSet)
+	for id := range index[0] {
+		positions := make([][]model.Position, len(stems))
+		for i := range stems {
+			positions[i] = index[i][id].Positions
+		}
+		if phraseMatches(positions, n.slop) {
+			docs[id] = struct{}{}
+		}
+	}
+	return docs, nil
+}
+
+func (n *fieldNode) eval(e *evaluator, negated bool) (docSet, error) {
+	docs := make(docSet)
+	switch n.field {
+	case siteField:
+		ids, err := e.s.repo.GetDocumentsByHost(n.value)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			docs[id] = struct{}{}
+		}
+
+	case urlField:
+		if _, err := e.all(); err != nil {
+			return nil, err
+		}
+		substr := strings.ToLower(n.value)
+		for _, doc := range e.docs {
+			if strings.Contains(strings.ToLower(doc.URL), substr) {
+				docs[doc.Id] = struct{}{}
+			}
+		}
+
+	case titleField, headerField:
+		stems, index, corrected, err := e.lookup(n.value, negated)
+		if err != nil || len(stems) == 0 {
+			return nil, err
+		}
+		n.corrected = corrected
+		posType := byte(model.HeaderType)
+		if n.field == titleField {
+			posType = model.TitleType
+		}
+		for id := range index[0] {
+			positions := make([][]model.Position, len(stems))
+			for i := range stems {
+				positions[i] = positionsOfType(index[i][id].Positions, posType)
+			}
+			if n.phrase && phraseMatches(positions, n.slop) {
+				docs[id] = struct{}{}
+			}
+			if !n.phrase && len(positions[0]) > 0 {
+				docs[id] = struct{}{}
+			}
+		}
+		for i := 1; i < len(stems) && !n.phrase; i++ { // как и у обычного терма, составное значение это объединение
+			for id, item := range index[i] {
+				if len(positionsOfType(item.Positions, posType)) > 0 {
+					docs[id] = struct{}{}
+				}
+			}
+		}
+	}
+	return docs, nil
+}
+
+func positionsOfType(positions []model.Position, t byte) []model.Position {
+	out := []model.Position{}
+	for _, p := range positions {
+		if p.Type == t {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func (n *notNode) eval(e *evaluator, negated bool) (docSet, error) {
+	excluded, err := n.child.eval(e, !negated)
+	if err != nil || excluded == nil {
+		return nil, err
+	}
+	all, err := e.all()
+	if err != nil {
+		return nil, err
+	}
+	return subtract(all, excluded), nil
+}
+
+func (n *orNode) eval(e *evaluator, negated bool) (docSet, error) {
+	var result docSet
+	for _, child := range n.children {
+		docs, err := child.eval(e, negated)
+		if err != nil {
+			return nil, err
+		}
+		result = union(result, docs)
+	}
+	return result, nil
+}
+
+func (n *andNode) eval(e *evaluator, negated bool) (docSet, error) {
+	g := &groupNode{}
+	for _, child := range n.children {
+		if not, ok := child.(*notNode); ok {
+			g.clauses = append(g.clauses, clause{node: not.child, occur: mustNot})
+			continue
+		}
+		g.clauses = append(g.clauses, clause{node: child, occur: must})
+	}
+	return g.eval(e, negated)
+}
+
+func (n *groupNode) eval(e *evaluator, negated bool) (docSet, error) {
+	var required, optional, excluded, filtered docSet
+	hasRequired, hasExcluded, hasFilter := false, false, false
+	for _, c := range n.clauses {
+		docs, err := c.node.eval(e, negated != (c.occur == mustNot))
+		if err != nil {
+			return nil, err
+		}
+		if docs == nil {
+			continue
+		}
+		switch c.occur {
+		case must:
+			if !hasRequired {
+				required, hasRequired = docs, true
+			} else {
+				required = intersect(required, docs)
+			}
+		case mustNot:
+			excluded, hasExcluded = union(excluded, docs), true
+		case filter:
+			if !hasFilter {
+				filtered, hasFilter = docs, true
+			} else {
+				filtered = intersect(filtered, docs)
+			}
+		default:
+			optional = union(optional, docs)
+		}
+	}
+
+	result := required // при наличии обязательных термов, необязательные влияют только на ранжирование
+	if !hasRequired {
+		result = optional
+	}
+	if hasFilter {
+		if result == nil {
+			result = filtered
+		} else {
+			result = intersect(result, filtered)
+		}
+	}
+	if result == nil && hasExcluded {
+		all, err := e.all()
+		if err != nil {
+			return nil, err
+		}
+		result = all
+	}
+	if result == nil {
+		return nil, nil
+	}
+	return subtract(result, excluded), nil
+}
+
+func union(a, b docSet) docSet {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	out := make(docSet, len(a) + len(b))
+	for id := range a {
+		out[id] = struct{}{}
+	}
+	for id := range b {
+		out[id] = struct{}{}
+	}
+	return out
+}
+
+func intersect(a, b docSet) docSet {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	out := make(docSet)
+	for id := range a {
+		if _, ok := b[id]; ok {
+			out[id] = struct{}{}
+		}
+	}
+	return out
+}
+
+func subtract(a, b docSet) docSet {
+	out := make(docSet, len(a))
+	for id := range a {
+		if _, ok := b[id]; !ok {
+			out[id] = struct{}{}
+		}
+	}
+	return out
+}
+
+func (n *termNode) String() string {
+	if n.corrected != "" {
+		return n.corrected
+	}
+	return n.text
+}
+
+func (n *phraseNode) String() string {
+	text := n.text
+	if n.corrected != "" {
+		text = n.corrected
+	}
+	if n.slop > 0 {
+		return fmt.Sprintf("%q~%d", text, n.slop)
+	}
+	return fmt.Sprintf("%q", text)
+}
+
+func (n *fieldNode) String() string {
+	value := n.value
+	if n.corrected != "" {
+		value = n.corrected
+	}
+	if !n.phrase {
+		return n.field + ":" + value
+	}
+	if n.slop > 0 {
+		return fmt.Sprintf("%s:%q~%d", n.field, value, n.slop)
+	}
+	return fmt.Sprintf("%s:%q", n.field, value)
+}
+
+func (n *notNode) String() string {
+	return "NOT " + wrapNode(n.child)
+}
+
+func (n *orNode) String() string {
+	return joinNodes(n.children, " OR ")
+}
+
+func (n *andNode) String() string {
+	return joinNodes(n.children, " AND ")
+}
+
+func (n *groupNode) String() string {
+	parts := make([]string, 0, len(n.clauses))
+	for _, c := range n.clauses {
+		prefix := ""
+		switch c.occur {
+		case must:
+			prefix = "+"
+		case mustNot:
+			prefix = "-"
+		}
+		switch c.node.(type) {
+		case *orNode, *andNode: // соседство связывает слабее операторов, скобки нужны только перед +/-
+			if prefix == "" {
+				parts = append(parts, c.node.String())
+				continue
+			}
+		}
+		parts = append(parts, prefix + wrapNode(c.node))
+	}
+	return strings.Join(parts, " ")
+}
+
+func joinNodes(nodes []queryNode, sep string) string {
+	parts := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		parts = append(parts, wrapNode(node))
+	}
+	return strings.Join(parts, sep)
+}
+
+func wrapNode(node queryNode) string {
+	switch node.(type) {
+	case *groupNode, *orNode, *andNode:
+		return "(" + node.String() + ")"
+	}
+	return node.String()
+}
@@ -0,0 +1,89 @@
+package searcher
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"wfts/internal/model"
+	"wfts/internal/utils/ltr"
+)
+
+var FeatureNames = []string{"bm25", "tf_idf", "proximity", "header", "url", "coverage", "doc_len"}
+
+func (s *Searcher) SetRanker(m *ltr.Model) error {
+	if m != nil && !m.Compatible(FeatureNames) {
+		return fmt.Errorf("model features %v do not match searcher features %v", m.Features, FeatureNames)
+	}
+	s.mu.Lock()
+	s.ranker = m
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Searcher) features(doc *model.Document, r requestRanking, queryLen int) []float64 {
+	proximity := 0.0
+	if queryLen > 1 && r.termProximity != math.MaxInt {
+		proximity = math.Exp(-s.weights.ProximityDecay * float64(max(r.termProximity - (queryLen - 1), 0)))
+	}
+	header := 0.0
+	if r.hasWordInHeader {
+		header = 1
+	}
+	covered := map[string]struct{}{}
+	for _, t := range r.terms {
+		covered[t.Term] = struct{}{}
+	}
+	coverage := 0.0
+	if queryLen > 0 {
+		coverage = float64(len(covered)) / float64(queryLen)
+	}
+	return []float64{r.bm25, r.tf_idf, proximity, header, r.logLenWordInURL, coverage, math.Log(1 + float64(doc.TokenCount))}
+}
+
+func (s *Searcher) rerankDepth() int {
+	if s.ranker == nil {
+		return 0
+	}
+	return s.weights.RerankTopK
+}
+
+func (s *Searcher) rerank(top []*model.Document, c *candidates) { // линейная оценка отбирает кандидатов, модель упорядочивает первые RerankTopK
+	if s.ranker == nil {
+		return
+	}
+	head := top[:min(len(top), s.weights.RerankTopK)]
+	for _, doc := range head {
+		r := c.rank[doc.Id]
+		r.model = s.ranker.Score(s.features(doc, r, len(c.words)))
+		r.reranked = true
+		c.rank[doc.Id] = r
+	}
+	sort.SliceStable(head, func(i, j int) bool {
+		return c.rank[head[i].Id].model > c.rank[head[j].Id].model
+	})
+}
+
+func (s *Searcher) LogFeatures(w io.Writer, qid int, query string, grade func(url string) int) (int, error) { // пишет кандидатов запроса в формате LETOR, как их увидит rerank
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, err := s.collect(query)
+	if err != nil {
+		return 0, err
+	}
+	top := topK(c.docs, c.rank, s.weights.RerankTopK)
+	for _, doc := range top {
+		sample := ltr.Sample{
+			Label: 		grade(doc.URL),
+			QID: 		qid,
+			Features: 	s.features(doc, c.rank[doc.Id], len(c.words)),
+			Comment: 	fmt.Sprintf("query=%q url=%s", query, doc.URL),
+		}
+		if err := ltr.WriteSample(w, sample); err != nil {
+			return 0, err
+		}
+	}
+	return len(top), nil
+}
@@ -5,21 +5,30 @@ import (
 	"io"
 	"log/slog"
 	"math"
-	"sort"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"wfts/configs"
 	"wfts/internal/model"
+	"wfts/internal/utils/ltr"
 )
 
 type index interface {
-	HandleTextQuery(string) ([]string, []map[[32]byte]model.WordCountAndPositions, error)
+	HandleTextQuery(string) ([]string, []map[[32]byte]model.WordCountAndPositions, string, error)
 	GetAVGLen() (float64, error)
+	PositionSpans(string) [][2]int
 }
 
 type resitory interface {
 	GetDocumentsCount() (int, error)
 	GetDocumentByID([32]byte) (*model.Document, error)
+	GetAllDocuments() ([]*model.Document, error)
+	GetDocumentsByHost(string) ([][32]byte, error)
+	GetDocumentText([32]byte) (string, error)
+	GetDeletedDocuments() (map[[32]byte]struct{}, error)
 }
 
 type Searcher struct {
@@ -27,15 +36,18 @@ type Searcher struct {
 	mu         	*sync.RWMutex
 	idx 		index
 	repo 	 	resitory
+	weights 	configs.RankingConfig
+	ranker 		*ltr.Model
 }
 
-func NewSearcher(wr io.Writer, idx index, repo resitory) *Searcher {
+func NewSearcher(wr io.Writer, idx index, repo resitory, weights configs.RankingConfig) *Searcher {
 	log := slog.New(slog.NewTextHandler(wr, &slog.HandlerOptions{}))
 	return &Searcher{
 		log: 		log,
 		mu:        	&sync.RWMutex{},
 		idx:       	idx,
 		repo: 	 	repo,
+		weights: 	weights,
 	}
 }
 
@@ -45,40 +57,151 @@ type requestRanking struct {
 	logLenWordInURL 	float64
 	termProximity 		int
 	hasWordInHeader 	bool
+	terms 				[]TermExplanation
+	score 				float64
+	model 				float64
+	reranked 			bool
 	//any ranking scores
 }
 
-func (s *Searcher) Search(query string, maxLen int) []*model.Document {
+type Hit struct {
+	Document 		*model.Document
+	Score 			float64 // линейная оценка, одна шкала для всей выдачи
+	ModelScore 		float64 // оценка модели, есть только у первых RerankTopK
+	Reranked 		bool
+	MatchedTerms 	[]string
+	Snippet 		*Snippet
+	Explain 		*Explanation
+}
+
+const DefaultLimit = 10
+
+type SearchRequest struct {
+	Query 	string
+	Offset 	int
+	Limit 	int
+}
+
+type SearchResponse struct {
+	Hits 			[]*Hit
+	Total 			int // число всех найденных документов, а не только текущей страницы
+	Took 			time.Duration
+	CorrectedQuery 	string
+}
+
+type candidates struct {
+	docs 		[]*model.Document
+	rank 		map[[32]byte]requestRanking
+	words 		[]string
+	index 		[]map[[32]byte]model.WordCountAndPositions
+	corrected 	string
+}
+
+type QueryError struct { // запрос не разобрать, в отличие от ошибок индекса виноват клиент
+	Query 	string
+	Err 	error
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("invalid query %q: %v", e.Query, e.Err)
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+func (s *Searcher) Search(req SearchRequest) (*SearchResponse, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	
-	words, index, err := s.idx.HandleTextQuery(query)
+
+	start := time.Now()
+	if req.Limit <= 0 {
+		req.Limit = DefaultLimit
+	}
+	req.Offset = max(req.Offset, 0)
+
+	c, err := s.collect(req.Query)
 	if err != nil {
-		s.log.Error("handling words error: " + err.Error())
-		return nil
+		return nil, err
+	}
+
+	resp := &SearchResponse{Hits: []*Hit{}, Total: len(c.docs), CorrectedQuery: c.corrected}
+	if resp.Total == 0 {
+		s.log.Info("empty result")
+		resp.Took = time.Since(start)
+		return resp, nil
+	}
+
+	top := topK(c.docs, c.rank, max(req.Offset + req.Limit, s.rerankDepth()))
+	s.rerank(top, c)
+	top = top[:min(req.Offset + req.Limit, len(top))]
+	for _, doc := range top[min(req.Offset, len(top)):] {
+		matched := []string{}
+		positions := [][]model.Position{}
+		for i := range c.words {
+			item, ex := c.index[i][doc.Id]
+			if !ex {
+				continue
+			}
+			positions = append(positions, item.Positions)
+			if !slices.Contains(matched, c.words[i]) {
+				matched = append(matched, c.words[i])
+			}
+		}
+		resp.Hits = append(resp.Hits, &Hit{
+			Document: 		doc,
+			Score: 			c.rank[doc.Id].score,
+			ModelScore: 	c.rank[doc.Id].model,
+			Reranked: 		c.rank[doc.Id].reranked,
+			MatchedTerms: 	matched,
+			Snippet: 		s.snippet(doc, positions),
+			Explain: 		s.explain(c.rank[doc.Id], len(c.words)),
+		})
+	}
+
+	resp.Took = time.Since(start)
+	return resp, nil
+}
+
+func (s *Searcher) collect(query string) (*candidates, error) {
+	root, err := parseQuery(query)
+	if err != nil {
+		return nil, &QueryError{Query: query, Err: err}
+	}
+	e := &evaluator{s: s}
+	allowed, err := root.eval(e, false)
+	if err != nil {
+		return nil, fmt.Errorf("handling words: %w", err)
+	}
+	words, index := e.words, e.index
+	corrected := ""
+	if e.corrected {
+		corrected = root.String()
 	}
 	
 	queryLen := len(words)
 	
 	avgLen, err := s.idx.GetAVGLen()
 	if err != nil {
-		s.log.Error(err.Error())
-		return nil
+		return nil, err
 	}
 	
 	length, err := s.repo.GetDocumentsCount()
 	if err != nil {
-		s.log.Error(err.Error())
-		return nil
+		return nil, err
 	}
 	
+	deleted, err := s.repo.GetDeletedDocuments() // постинги могли быть прочитаны до удаления документа
+	if err != nil {
+		return nil, err
+	}
+
 	rank := make(map[[32]byte]requestRanking)
 	result := make([]*model.Document, 0)
 	alreadyIncluded := make(map[[32]byte]struct{})
 	var wg sync.WaitGroup
 	var rankMu sync.RWMutex
 	var resultMu sync.Mutex
-	tokenFreq := make([]int, queryLen)
 	done := make(chan struct{})
 
 	for i := range words {
@@ -88,11 +211,16 @@ func (s *Searcher) Search(query string, maxLen int) []*model.Document {
 	
 			idf := math.Log(float64(length) / float64(len(index[i]) + 1)) + 1
 			s.log.Info(fmt.Sprintf("len documents with word: %s, %d", words[i], len(index[i])))
-			for _, item := range index[i] {
-				tokenFreq[i] += item.Count
-			}
 	
 			for docID, item := range index[i] {
+				if allowed != nil {
+					if _, ok := allowed[docID]; !ok {
+						continue
+					}
+				}
+				if _, gone := deleted[docID]; gone {
+					continue
+				}
 				rankMu.RLock()
 				doc, err := s.repo.GetDocumentByID(docID)
 				if err != nil || doc == nil {
@@ -104,9 +232,11 @@ func (s *Searcher) Search(query string, maxLen int) []*model.Document {
 				
 				rankMu.Lock()
 				r := rank[docID]
-				tf := float64(tokenFreq[i]) / float64(doc.TokenCount)
-				r.tf_idf += tf * idf
-				r.bm25 += calcBM25(idf, tf, doc, avgLen)
+				tf := float64(item.Count)
+				bm25 := calcBM25(idf, tf, doc, avgLen, s.weights.BM25K1, s.weights.BM25B)
+				r.tf_idf += tf / float64(max(doc.TokenCount, 1)) * idf
+				r.bm25 += bm25
+				r.terms = append(r.terms, TermExplanation{Term: words[i], IDF: idf, TF: tf, BM25: bm25, i: i})
 				if r.termProximity == 0 {
 					positions := [][]model.Position{}
 					for i := range words {
@@ -114,9 +244,9 @@ func (s *Searcher) Search(query string, maxLen int) []*model.Document {
 					}
 					r.termProximity = getMinQueryDistInDoc(positions, queryLen)
 					_, r.logLenWordInURL = boyerMoorAlgorithm(strings.ToLower(doc.URL), words)
-					for i := 0; i < item.Count && !r.hasWordInHeader; i++ {
-						r.hasWordInHeader = item.Positions[i].Type == model.HeaderType
-					}
+				}
+				for i := 0; i < len(item.Positions) && !r.hasWordInHeader; i++ { // по каждому терму, а не только первому обработанному
+					r.hasWordInHeader = item.Positions[i].Type == model.HeaderType || item.Positions[i].Type == model.TitleType
 				}
 				rank[docID] = r
 				rankMu.Unlock()
@@ -142,31 +272,69 @@ func (s *Searcher) Search(query string, maxLen int) []*model.Document {
 	
 	<-done
 
-	length = len(result)
-	if length == 0 {
-		s.log.Info("empty result")
-		return nil
-	}
-
-	sort.Slice(result, func(i, j int) bool {
-		if rank[result[i].Id].bm25 != rank[result[j].Id].bm25 {
-			return rank[result[i].Id].bm25 > rank[result[j].Id].bm25
+	for docID := range allowed { // документы прошедшие только через отрицания, без положительных термов
+		if _, exists := alreadyIncluded[docID]; exists {
+			continue
 		}
-		if rank[result[i].Id].tf_idf != rank[result[j].Id].tf_idf {
-			return rank[result[i].Id].tf_idf > rank[result[j].Id].tf_idf
+		if _, gone := deleted[docID]; gone {
+			continue
 		}
-		return rank[result[i].Id].termProximity > rank[result[j].Id].termProximity
-	})
-
-	topN := result[:min(length, maxLen)]
-	sort.Slice(topN, func(i, j int) bool {
-		if rank[topN[i].Id].logLenWordInURL != rank[topN[j].Id].logLenWordInURL {
-			return rank[topN[i].Id].logLenWordInURL > rank[topN[i].Id].logLenWordInURL
+		doc, err := s.repo.GetDocumentByID(docID)
+		if err != nil || doc == nil {
+			s.log.Error(fmt.Sprintf("error: %v, doc: %v", err, doc))
+			continue
 		}
-		return rank[topN[i].Id].hasWordInHeader && !rank[topN[j].Id].hasWordInHeader
-	})
+		result = append(result, doc)
+	}
+
+	for id, r := range rank {
+		r.score = s.score(r, queryLen)
+		rank[id] = r
+	}
 
-	return topN
+	return &candidates{docs: result, rank: rank, words: words, index: index, corrected: corrected}, nil
+}
+
+func (s *Searcher) bonuses(r requestRanking, queryLen int) (proximity, header, url float64) {
+	if queryLen > 1 && r.termProximity != math.MaxInt { // для одного терма близость одинакова у всех документов
+		proximity = s.weights.ProximityBoost * math.Exp(-s.weights.ProximityDecay * float64(max(r.termProximity - (queryLen - 1), 0)))
+	}
+	if r.hasWordInHeader {
+		header = s.weights.HeaderBoost
+	}
+	return proximity, header, s.weights.URLBoost * r.logLenWordInURL
+}
+
+func (s *Searcher) score(r requestRanking, queryLen int) float64 {
+	proximity, header, url := s.bonuses(r, queryLen)
+	return r.bm25 + proximity + header + url
+}
+
+func (s *Searcher) snippet(doc *model.Document, positions [][]model.Position) *Snippet {
+	text, err := s.repo.GetDocumentText(doc.Id)
+	if err != nil {
+		s.log.Error(fmt.Sprintf("error loading text of %s: %v", doc.URL, err))
+	}
+	if text == "" {
+		return &Snippet{Text: doc.Description}
+	}
+	return buildSnippet(text, s.idx.PositionSpans(text), positions, doc.Description)
+}
+
+func FormatRange(offset, shown, total int) string { // results 11-20 of 3,412
+	return fmt.Sprintf("results %d-%d of %s", offset + 1, offset + shown, groupDigits(total))
+}
+
+func groupDigits(n int) string {
+	raw := strconv.Itoa(n)
+	var sb strings.Builder
+	for i, r := range raw {
+		if i > 0 && r != '-' && (len(raw) - i) % 3 == 0 && raw[i - 1] != '-' {
+			sb.WriteByte(',')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
 }
 
 func TruncateToTwoDecimalPlaces(f float64) float64 {
@@ -1,11 +1,21 @@
 package searcher
 
 import (
+	"crypto/sha256"
+	"errors"
+	"io"
 	"math"
+	"net/url"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"testing"
 
+	"wfts/configs"
 	"wfts/internal/model"
+	"wfts/internal/utils/ltr"
 )
 
 func TestGetMinQueryDistInDoc(t *testing.T) {
@@ -107,6 +117,12 @@ func TestBoyerMoorAlgorithm(t *testing.T) {
 			query: []string{"search", "example"},
 			expected: math.Log(1 + 6 + 7),
 		},
+		{
+			name: "match after partial overlap",
+			base: "https://kafka.dev/intro",
+			query: []string{"kafka"},
+			expected: math.Log(1 + 5),
+		},
 	}
 	
 	for _, tt := range tests {
@@ -116,4 +132,712 @@ func TestBoyerMoorAlgorithm(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		name 		string
+		query 		string
+		expected 	string
+	}{
+		{
+			name: "plain terms",
+			query: "html parser",
+			expected: "html parser",
+		},
+		{
+			name: "required and excluded",
+			query: "+golang -java tutorial",
+			expected: "+golang -java tutorial",
+		},
+		{
+			name: "operator precedence",
+			query: "a OR b AND c",
+			expected: "a OR (b AND c)",
+		},
+		{
+			name: "grouping with not",
+			query: "go AND (web OR http) NOT java",
+			expected: "go AND (web OR http) -java",
+		},
+		{
+			name: "not inside and",
+			query: "spec AND NOT draft",
+			expected: "spec AND NOT draft",
+		},
+		{
+			name: "phrase with slop",
+			query: `"url parsing"~3 spec`,
+			expected: `"url parsing"~3 spec`,
+		},
+		{
+			name: "double negation",
+			query: "NOT -x",
+			expected: "+x",
+		},
+		{
+			name: "unbalanced parens and dangling operator",
+			query: "(a b AND",
+			expected: "(a b)",
+		},
+		{
+			name: "field filters",
+			query: "transformer site:developer.mozilla.org -url:papers",
+			expected: "transformer site:developer.mozilla.org -url:papers",
+		},
+		{
+			name: "field phrase",
+			query: `Title:"living standard"~1`,
+			expected: `title:"living standard"~1`,
+		},
+		{
+			name: "unknown field is a term",
+			query: "https://example.com foo:bar",
+			expected: "https://example.com foo:bar",
+		},
+		{
+			name: "lowercase operators are terms",
+			query: "cats and dogs",
+			expected: "cats and dogs",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := parseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("parseQuery(%q): %v", tt.query, err)
+			}
+			if got := root.String(); got != tt.expected {
+				t.Errorf("parseQuery(%q) = %q, want %q", tt.query, got, tt.expected)
+			}
+		})
+	}
+
+	if _, err := parseQuery(" ( ) "); err == nil {
+		t.Errorf("parseQuery of empty query: expected error")
+	}
+	s := newFakeSearcher(map[string]string{"https://a.com": "go"})
+	if _, err := s.Search(SearchRequest{Query: " ( ) "}); !errors.As(err, new(*QueryError)) {
+		t.Errorf("Search of empty query = %v, want QueryError", err)
+	}
+}
+
+var fakeStopWords = map[string]bool{"the": true, "of": true}
+
+type fakeIndex struct {
+	postings map[string]map[[32]byte]model.WordCountAndPositions
+}
+
+func (f *fakeIndex) HandleTextQuery(text string) ([]string, []map[[32]byte]model.WordCountAndPositions, string, error) {
+	words := strings.Fields(strings.ToLower(text))
+	if len(words) == 0 {
+		return nil, nil, "", errors.New("empty tokens")
+	}
+	stems := []string{} // как у настоящего индекса: после стоп слов может не остаться ни одного терма
+	index := make([]map[[32]byte]model.WordCountAndPositions, 0, len(words))
+	for _, w := range words {
+		if fakeStopWords[w] {
+			continue
+		}
+		stems = append(stems, w)
+		index = append(index, f.postings[w])
+	}
+	return stems, index, "", nil
+}
+
+func (f *fakeIndex) GetAVGLen() (float64, error) {
+	return 4, nil
+}
+
+func (f *fakeIndex) PositionSpans(text string) [][2]int {
+	spans := [][2]int{}
+	start := -1
+	for i, r := range text + " " {
+		switch {
+		case r == ' ' || r == '\n':
+			if start >= 0 {
+				spans = append(spans, [2]int{start, i})
+			}
+			start = -1
+		case start < 0:
+			start = i
+		}
+	}
+	return spans
+}
+
+type fakeRepo struct {
+	docs 	map[[32]byte]*model.Document
+	texts 	map[[32]byte]string
+	deleted map[[32]byte]bool
+	deletedLoads int
+}
+
+func (f *fakeRepo) GetDocumentsCount() (int, error) {
+	return len(f.docs), nil
+}
+
+func (f *fakeRepo) GetDocumentByID(id [32]byte) (*model.Document, error) {
+	return f.docs[id], nil
+}
+
+func (f *fakeRepo) GetAllDocuments() ([]*model.Document, error) {
+	out := []*model.Document{}
+	for _, doc := range f.docs {
+		out = append(out, doc)
+	}
+	return out, nil
+}
+
+func (f *fakeRepo) GetDocumentsByHost(host string) ([][32]byte, error) {
+	out := [][32]byte{}
+	for id, doc := range f.docs {
+		u, _ := url.Parse(doc.URL)
+		if h := u.Hostname(); h == host || strings.HasSuffix(h, "." + host) {
+			out = append(out, id)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeRepo) GetDocumentText(id [32]byte) (string, error) {
+	return f.texts[id], nil
+}
+
+func (f *fakeRepo) GetDeletedDocuments() (map[[32]byte]struct{}, error) {
+	f.deletedLoads++
+	out := make(map[[32]byte]struct{})
+	for id, gone := range f.deleted {
+		if gone {
+			out[id] = struct{}{}
+		}
+	}
+	return out, nil
+}
+
+func newFakeSearcher(corpus map[string]string) *Searcher { // префиксы t: и h: помечают слова заголовка страницы и h1/h2
+	idx := &fakeIndex{postings: make(map[string]map[[32]byte]model.WordCountAndPositions)}
+	repo := &fakeRepo{docs: make(map[[32]byte]*model.Document), texts: make(map[[32]byte]string), deleted: make(map[[32]byte]bool)}
+	for url, text := range corpus {
+		id := sha256.Sum256([]byte(url))
+		words := strings.Fields(text)
+		repo.docs[id] = &model.Document{Id: id, URL: url, TokenCount: len(words)}
+		plain := make([]string, 0, len(words))
+		for i, w := range words {
+			posType := byte(model.BodyType)
+			if t, word, ok := strings.Cut(w, ":"); ok {
+				posType, w = t[0], word
+			}
+			plain = append(plain, w)
+			if idx.postings[w] == nil {
+				idx.postings[w] = make(map[[32]byte]model.WordCountAndPositions)
+			}
+			item := idx.postings[w][id]
+			item.Count++
+			item.Positions = append(item.Positions, model.Position{I: i, Type: posType})
+			idx.postings[w][id] = item
+		}
+		repo.texts[id] = strings.Join(plain, " ")
+	}
+	return NewSearcher(io.Discard, idx, repo, configs.DefaultRanking())
+}
+
+func mustSearch(t *testing.T, s *Searcher, req SearchRequest) *SearchResponse {
+	t.Helper()
+	res, err := s.Search(req)
+	if err != nil {
+		t.Fatalf("Search(%q): %v", req.Query, err)
+	}
+	return res
+}
+
+func TestBooleanSearch(t *testing.T) {
+	s := newFakeSearcher(map[string]string{
+		"https://a.com": "t:go t:web t:server",
+		"https://b.com": "go java h:compiler",
+		"https://c.com": "web http server",
+		"https://d.com": "java http client",
+		"https://docs.c.com/http": "http docs guide",
+	})
+	tests := []struct {
+		query 		string
+		expected 	[]string
+	}{
+		{"go web", []string{"https://a.com", "https://b.com", "https://c.com"}},
+		{"+go web", []string{"https://a.com", "https://b.com"}},
+		{"go -java", []string{"https://a.com"}},
+		{"go AND web", []string{"https://a.com"}},
+		{"server AND NOT go", []string{"https://c.com"}},
+		{"(go OR http) AND java", []string{"https://b.com", "https://d.com"}},
+		{"http -guide", []string{"https://c.com", "https://d.com"}},
+		{"NOT server", []string{"https://b.com", "https://d.com", "https://docs.c.com/http"}},
+		{"go site:b.com", []string{"https://b.com"}},
+		{"server -site:a.com", []string{"https://c.com"}},
+		{"site:b.com OR site:d.com", []string{"https://b.com", "https://d.com"}},
+		{"site:a.com OR site:b.com web", []string{"https://a.com"}},
+		{"site:a.com OR web", []string{"https://a.com", "https://c.com"}},
+		{"url:docs", []string{"https://docs.c.com/http"}},
+		{"http site:c.com", []string{"https://c.com", "https://docs.c.com/http"}},
+		{"title:go", []string{"https://a.com"}},
+		{"header:compiler", []string{"https://b.com"}},
+		{"header:java", []string{}},
+		{`title:"web server"`, []string{"https://a.com"}},
+		{`"http server"`, []string{"https://c.com"}},
+		{`"server http"`, []string{}},
+		{`"web server"`, []string{"https://a.com"}},
+		{`"http server"~1 OR compiler`, []string{"https://c.com", "https://b.com"}},
+		{`"the of"`, []string{}},
+		{`go "the of"`, []string{"https://a.com", "https://b.com"}},
+		{`title:"the of"`, []string{}},
+		{"header:the", []string{}},
+		{"compiler OR title:of", []string{"https://b.com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got := []string{}
+			if res := mustSearch(t, s, SearchRequest{Query: tt.query}); res != nil {
+				for _, hit := range res.Hits {
+					got = append(got, hit.Document.URL)
+				}
+			}
+			sort.Strings(got)
+			sort.Strings(tt.expected)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDeletedDocumentsSkipped(t *testing.T) {
+	s := newFakeSearcher(map[string]string{
+		"https://a.com": "go web server",
+		"https://b.com": "go compiler",
+		"https://c.com": "java compiler",
+	})
+	s.repo.(*fakeRepo).deleted[sha256.Sum256([]byte("https://b.com"))] = true // постинги на месте, как у поиска начатого до удаления
+
+	for query, expected := range map[string][]string{
+		"go": 			{"https://a.com"},
+		"compiler": 	{"https://c.com"},
+		"NOT web": 		{"https://c.com"},
+	} {
+		res := mustSearch(t, s, SearchRequest{Query: query})
+		got := []string{}
+		for _, hit := range res.Hits {
+			got = append(got, hit.Document.URL)
+		}
+		if !reflect.DeepEqual(got, expected) || res.Total != len(expected) {
+			t.Errorf("Search(%q) = %v (total %d), want %v", query, got, res.Total, expected)
+		}
+	}
+	if loads := s.repo.(*fakeRepo).deletedLoads; loads != 3 {
+		t.Errorf("tombstones loaded %d times for 3 queries, want once per query", loads)
+	}
+}
+
+func TestPhraseMatches(t *testing.T) {
+	tests := []struct {
+		name 		string
+		positions 	[][]model.Position
+		slop 		int
+		expected 	bool
+	}{
+		{
+			name: "consecutive terms",
+			positions: [][]model.Position{{{I: 3}, {I: 10}}, {{I: 11}}},
+			expected: true,
+		},
+		{
+			name: "gap without slop",
+			positions: [][]model.Position{{{I: 3}}, {{I: 5}}},
+			expected: false,
+		},
+		{
+			name: "gap within slop",
+			positions: [][]model.Position{{{I: 3}}, {{I: 5}}, {{I: 8}}},
+			slop: 3,
+			expected: true,
+		},
+		{
+			name: "wrong order",
+			positions: [][]model.Position{{{I: 7}}, {{I: 6}}},
+			slop: 5,
+			expected: false,
+		},
+		{
+			name: "missing term",
+			positions: [][]model.Position{{{I: 1}}, {}},
+			expected: false,
+		},
+		{
+			name: "single term",
+			positions: [][]model.Position{{{I: 42}}},
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := phraseMatches(tt.positions, tt.slop); got != tt.expected {
+				t.Errorf("phraseMatches(%v, %d) = %t, want %t", tt.positions, tt.slop, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDensestWindow(t *testing.T) {
+	tests := []struct {
+		name 		string
+		positions 	[][]model.Position
+		width 		int
+		expected 	[]int
+	}{
+		{
+			name: "all terms close together",
+			positions: [][]model.Position{{{I: 2}, {I: 40}}, {{I: 41}}},
+			width: 5,
+			expected: []int{40, 41},
+		},
+		{
+			name: "more distinct terms wins over repeats",
+			positions: [][]model.Position{{{I: 0}, {I: 1}, {I: 2}, {I: 20}}, {{I: 22}}},
+			width: 5,
+			expected: []int{20, 22},
+		},
+		{
+			name: "positions outside text are ignored",
+			positions: [][]model.Position{{{I: 3}, {I: 100}}},
+			width: 5,
+			expected: []int{3},
+		},
+		{
+			name: "no positions",
+			positions: [][]model.Position{},
+			width: 5,
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := densestWindow(tt.positions, tt.width, 50); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("densestWindow(%v, %d) = %v, want %v", tt.positions, tt.width, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	words := make([]string, 60)
+	for i := range words {
+		words[i] = "w" + strconv.Itoa(i)
+	}
+	words[45], words[47] = "golang", "channels"
+	s := newFakeSearcher(map[string]string{"https://go.dev": strings.Join(words, " ")})
+
+	res := mustSearch(t, s, SearchRequest{Query: "golang channels"})
+	if res == nil || len(res.Hits) != 1 || res.Hits[0].Snippet == nil {
+		t.Fatalf("Search() returned no snippet: %+v", res)
+	}
+	sn := res.Hits[0].Snippet
+	if !strings.HasPrefix(sn.Text, ellipsis) {
+		t.Errorf("snippet %q should start with ellipsis", sn.Text)
+	}
+	if strings.Contains(sn.Text, "w0 ") {
+		t.Errorf("snippet %q should not include the beginning of the text", sn.Text)
+	}
+	marked := sn.Render(func(s string) string { return "[" + s + "]" })
+	if !strings.Contains(marked, "[golang] w46 [channels]") {
+		t.Errorf("Render() = %q, expected highlighted terms", marked)
+	}
+
+	res = mustSearch(t, s, SearchRequest{Query: "w1"})
+	if res == nil || len(res.Hits) != 1 {
+		t.Fatalf("Search(w1) = %+v", res)
+	}
+	if marked := res.Hits[0].Snippet.Render(func(s string) string { return "[" + s + "]" }); !strings.HasPrefix(marked, "w0 [w1] w2") {
+		t.Errorf("snippet near text start = %q", marked)
+	}
+}
+
+func TestPagination(t *testing.T) {
+	corpus := map[string]string{}
+	for i := range 25 {
+		corpus["https://site" + strconv.Itoa(i) + ".com"] = strings.Repeat("go ", i % 7 + 1) + strings.Repeat("filler ", i)
+	}
+	s := newFakeSearcher(corpus)
+
+	full := mustSearch(t, s, SearchRequest{Query: "go", Limit: 100})
+	if full == nil || full.Total != 25 || len(full.Hits) != 25 {
+		t.Fatalf("Search(limit 100) = %+v", full)
+	}
+
+	seen := []string{}
+	for offset := 0; offset < 30; offset += 10 {
+		page := mustSearch(t, s, SearchRequest{Query: "go", Offset: offset, Limit: 10})
+		if page == nil || page.Total != 25 {
+			t.Fatalf("Search(offset %d) total = %+v", offset, page)
+		}
+		if expected := min(10, 25 - offset); len(page.Hits) != expected {
+			t.Errorf("Search(offset %d) returned %d hits, want %d", offset, len(page.Hits), expected)
+		}
+		for _, hit := range page.Hits {
+			seen = append(seen, hit.Document.URL)
+		}
+	}
+	for i, hit := range full.Hits {
+		if i < len(seen) && seen[i] != hit.Document.URL {
+			t.Fatalf("page concatenation differs from full ranking at %d: %s != %s", i, seen[i], hit.Document.URL)
+		}
+	}
+
+	if past := mustSearch(t, s, SearchRequest{Query: "go", Offset: 40}); past == nil || len(past.Hits) != 0 || past.Total != 25 {
+		t.Errorf("Search(offset past end) = %+v", past)
+	}
+}
+
+func TestTopK(t *testing.T) {
+	docs := []*model.Document{}
+	rank := map[[32]byte]requestRanking{}
+	for i := range 50 {
+		doc := &model.Document{Id: sha256.Sum256([]byte{byte(i)}), URL: "https://x.com/" + strconv.Itoa(i)}
+		docs = append(docs, doc)
+		rank[doc.Id] = requestRanking{bm25: float64((i * 37) % 11)}
+	}
+	sorted := slices.Clone(docs)
+	sort.Slice(sorted, func(i, j int) bool {
+		return better(rankedDoc{sorted[i], rank[sorted[i].Id]}, rankedDoc{sorted[j], rank[sorted[j].Id]})
+	})
+
+	for _, k := range []int{0, 1, 7, 50, 80} {
+		got := topK(docs, rank, k)
+		if expected := sorted[:min(k, len(sorted))]; !slices.Equal(got, expected) {
+			t.Errorf("topK(%d) differs from full sort", k)
+		}
+	}
+}
+
+func TestFormatRange(t *testing.T) {
+	tests := []struct {
+		offset, shown, total 	int
+		expected 				string
+	}{
+		{0, 10, 3, "results 1-10 of 3"},
+		{10, 10, 3412, "results 11-20 of 3,412"},
+		{0, 1, 1234567, "results 1-1 of 1,234,567"},
+		{990, 10, 1000, "results 991-1000 of 1,000"},
+	}
+	for _, tt := range tests {
+		if got := FormatRange(tt.offset, tt.shown, tt.total); got != tt.expected {
+			t.Errorf("FormatRange(%d, %d, %d) = %q, want %q", tt.offset, tt.shown, tt.total, got, tt.expected)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	s := newFakeSearcher(map[string]string{
+		"https://go.dev/tour": "t:go tour of go channels",
+		"https://rust.org": "rust book",
+	})
+
+	res := mustSearch(t, s, SearchRequest{Query: "tour go rust"})
+	if res == nil || len(res.Hits) != 2 {
+		t.Fatalf("Search() = %+v", res)
+	}
+	for _, hit := range res.Hits {
+		e := hit.Explain
+		if e == nil {
+			t.Fatalf("hit %s has no explanation", hit.Document.URL)
+		}
+		if e.Score != hit.Score {
+			t.Errorf("explain score %f != hit score %f", e.Score, hit.Score)
+		}
+		sum := 0.0
+		for i, term := range e.Terms {
+			sum += term.BM25
+			if i > 0 && term.i < e.Terms[i - 1].i {
+				t.Errorf("terms of %s are not in query order: %+v", hit.Document.URL, e.Terms)
+			}
+		}
+		if math.Abs(sum - e.BM25) > 1e-9 {
+			t.Errorf("term contributions %f do not add up to bm25 %f", sum, e.BM25)
+		}
+		if e.Proximity != -1 {
+			t.Errorf("%s: proximity = %d, want -1 because not all terms are present", hit.Document.URL, e.Proximity)
+		}
+	}
+
+	tour := res.Hits[0]
+	if tour.Document.URL != "https://go.dev/tour" {
+		tour = res.Hits[1]
+	}
+	if got := []string{tour.Explain.Terms[0].Term, tour.Explain.Terms[1].Term}; !reflect.DeepEqual(got, []string{"tour", "go"}) {
+		t.Errorf("terms = %v, want [tour go]", got)
+	}
+	if tour.Explain.HeaderBonus == 0 || tour.Explain.URLBonus == 0 {
+		t.Errorf("expected header and url bonuses for %s: %+v", tour.Document.URL, tour.Explain)
+	}
+	if !strings.Contains(tour.Explain.String(), `term "tour"`) {
+		t.Errorf("String() = %q", tour.Explain.String())
+	}
+}
+
+func TestRankingOrder(t *testing.T) {
+	corpus := map[string]string{
+		"https://notes.org/kafka-title": "t:kafka streams guide notes",
+		"https://notes.org/plain": "kafka streams guide notes",
+		"https://kafka.dev/intro": "intro to kafka consumer lag",
+		"https://notes.org/far": "kafka lag metrics and the consumer",
+		"https://cache.org/many": "redis redis redis cache",
+		"https://cache.org/once": "redis cache store fast",
+		"https://cache.org/long": "redis cache store fast and durable with replication snapshots and modules",
+	}
+	tests := []struct {
+		name 		string
+		query 		string
+		weights 	func(*configs.RankingConfig)
+		expected 	[]string
+	}{
+		{
+			name: "header and url bonuses break bm25 ties",
+			query: "kafka streams",
+			expected: []string{"https://notes.org/kafka-title", "https://notes.org/plain", "https://kafka.dev/intro", "https://notes.org/far"},
+		},
+		{
+			name: "adjacent terms beat distant ones",
+			query: "kafka consumer",
+			expected: []string{"https://kafka.dev/intro", "https://notes.org/far", "https://notes.org/kafka-title", "https://notes.org/plain"},
+		},
+		{
+			name: "term frequency and length normalization",
+			query: "redis",
+			expected: []string{"https://cache.org/many", "https://cache.org/once", "https://cache.org/long"},
+		},
+		{
+			name: "without bonuses bm25 alone decides",
+			query: "kafka consumer",
+			weights: func(w *configs.RankingConfig) { w.ProximityBoost, w.URLBoost, w.HeaderBoost = 0, 0, 0 },
+			expected: []string{"https://kafka.dev/intro", "https://notes.org/far", "https://notes.org/kafka-title", "https://notes.org/plain"},
+		},
+		{
+			name: "url boost outweighs proximity",
+			query: "kafka lag",
+			weights: func(w *configs.RankingConfig) { w.URLBoost = 5 },
+			expected: []string{"https://kafka.dev/intro", "https://notes.org/kafka-title", "https://notes.org/far", "https://notes.org/plain"},
+		},
+		{
+			name: "proximity decides when url boost is off",
+			query: "kafka lag",
+			weights: func(w *configs.RankingConfig) { w.URLBoost = 0 },
+			expected: []string{"https://notes.org/far", "https://kafka.dev/intro", "https://notes.org/kafka-title", "https://notes.org/plain"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeSearcher(corpus)
+			if tt.weights != nil {
+				tt.weights(&s.weights)
+			}
+			got := []string{}
+			if res := mustSearch(t, s, SearchRequest{Query: tt.query}); res != nil {
+				for _, hit := range res.Hits {
+					got = append(got, hit.Document.URL)
+					if e := hit.Explain; math.Abs(e.BM25 + e.ProximityBonus + e.HeaderBonus + e.URLBonus - hit.Score) > 1e-9 {
+						t.Errorf("%s: score %f is not the sum of its parts %+v", hit.Document.URL, hit.Score, e)
+					}
+				}
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRerankWithModel(t *testing.T) {
+	s := newFakeSearcher(map[string]string{
+		"https://a.org/long": "guide guide guide to kafka",
+		"https://b.org/header": "h:guide filler filler filler filler",
+		"https://c.org/plain": "guide filler",
+	})
+	base := mustSearch(t, s, SearchRequest{Query: "guide"})
+	if base == nil || len(base.Hits) != 3 {
+		t.Fatalf("linear ranking = %+v", base)
+	}
+
+	if err := s.SetRanker(&ltr.Model{Features: []string{"bm25"}, Mean: []float64{0}, Scale: []float64{1}, Weights: []float64{1}}); err == nil {
+		t.Errorf("SetRanker() accepted a model with different features")
+	}
+
+	n := len(FeatureNames)
+	m := &ltr.Model{Features: FeatureNames, Mean: make([]float64, n), Scale: make([]float64, n), Weights: make([]float64, n)}
+	for i := range m.Scale {
+		m.Scale[i] = 1
+	}
+	m.Weights[slices.Index(FeatureNames, "header")] = 10
+	m.Weights[slices.Index(FeatureNames, "doc_len")] = -1
+	if err := s.SetRanker(m); err != nil {
+		t.Fatalf("SetRanker(): %v", err)
+	}
+
+	linear := map[string]float64{}
+	for _, hit := range base.Hits {
+		linear[hit.Document.URL] = hit.Score
+	}
+	got := []string{}
+	res := mustSearch(t, s, SearchRequest{Query: "guide"})
+	for _, hit := range res.Hits {
+		got = append(got, hit.Document.URL)
+		if !hit.Reranked || !hit.Explain.Reranked || hit.ModelScore != hit.Explain.ModelScore {
+			t.Errorf("%s: expected model score, got %+v", hit.Document.URL, hit.Explain)
+		}
+		if hit.Score != linear[hit.Document.URL] { // модель меняет порядок, но не шкалу Score
+			t.Errorf("%s: score %f, want linear score %f", hit.Document.URL, hit.Score, linear[hit.Document.URL])
+		}
+	}
+	if expected := []string{"https://b.org/header", "https://c.org/plain", "https://a.org/long"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("reranked = %v, want %v", got, expected)
+	}
+
+	s.weights.RerankTopK = 1 // модель видит только лучшего кандидата линейной оценки
+	if res := mustSearch(t, s, SearchRequest{Query: "guide"}); res.Hits[0].Document.URL != base.Hits[0].Document.URL || res.Hits[1].Reranked || res.Hits[1].ModelScore != 0 {
+		t.Errorf("rerank depth not respected: %+v", res.Hits)
+	} else if res.Hits[0].Score < res.Hits[1].Score {
+		t.Errorf("scores of reranked and linear hits are not comparable: %f < %f", res.Hits[0].Score, res.Hits[1].Score)
+	}
+}
+
+func TestLogFeatures(t *testing.T) {
+	s := newFakeSearcher(map[string]string{
+		"https://a.org": "kafka streams",
+		"https://b.org": "kafka",
+	})
+	var buf strings.Builder
+	n, err := s.LogFeatures(&buf, 7, "kafka streams", func(url string) int {
+		if url == "https://a.org" {
+			return 2
+		}
+		return 0
+	})
+	if err != nil || n != 2 {
+		t.Fatalf("LogFeatures() = %d, %v", n, err)
+	}
+	samples, err := ltr.ReadSamples(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatalf("ReadSamples(): %v", err)
+	}
+	for _, sample := range samples {
+		if sample.QID != 7 || len(sample.Features) != len(FeatureNames) {
+			t.Errorf("unexpected sample %+v", sample)
+		}
+		if strings.Contains(sample.Comment, "https://a.org") != (sample.Label == 2) {
+			t.Errorf("label %d does not match comment %q", sample.Label, sample.Comment)
+		}
+	}
+	if coverage := samples[0].Features[slices.Index(FeatureNames, "coverage")]; coverage != 1 {
+		t.Errorf("best candidate coverage = %f, want 1", coverage)
+	}
+}
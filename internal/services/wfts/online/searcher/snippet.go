@@ -0,0 +1,68 @@
+package searcher
+
+import (
+	"strings"
+
+	"wfts/internal/model"
+)
+
+const (
+	snippetWidth = 30 // в токенах
+	snippetContext = 6
+	ellipsis = "…"
+)
+
+type Snippet struct {
+	Text 		string
+	Highlights 	[][2]int // байтовые смещения совпавших слов в Text
+}
+
+func (s *Snippet) Render(mark func(string) string) string {
+	var sb strings.Builder
+	last := 0
+	for _, h := range s.Highlights {
+		sb.WriteString(s.Text[last:h[0]])
+		sb.WriteString(mark(s.Text[h[0]:h[1]]))
+		last = h[1]
+	}
+	sb.WriteString(s.Text[last:])
+	return sb.String()
+}
+
+func buildSnippet(text string, spans [][2]int, positions [][]model.Position, fallback string) *Snippet {
+	matched := densestWindow(positions, snippetWidth, len(spans))
+	if len(matched) == 0 {
+		if fallback != "" || len(spans) == 0 {
+			return &Snippet{Text: fallback}
+		}
+		return cutSnippet(text, spans, 0, min(len(spans), snippetWidth), nil)
+	}
+
+	start := max(0, matched[0] - snippetContext)
+	end := min(len(spans), start + snippetWidth)
+	start = max(0, min(start, end - snippetWidth)) // в конце текста сдвигаем окно влево
+	return cutSnippet(text, spans, start, end, matched)
+}
+
+func cutSnippet(text string, spans [][2]int, start, end int, matched []int) *Snippet {
+	from, to := spans[start][0], min(spans[end - 1][1], len(text))
+	if from >= to {
+		return &Snippet{}
+	}
+	prefix, suffix := "", ""
+	if start > 0 {
+		prefix = ellipsis + " "
+	}
+	if end < len(spans) {
+		suffix = " " + ellipsis
+	}
+
+	snippet := &Snippet{Text: prefix + strings.ReplaceAll(text[from:to], "\n", " ") + suffix}
+	for _, p := range matched {
+		if p < start || p >= end || spans[p][1] > to {
+			continue
+		}
+		snippet.Highlights = append(snippet.Highlights, [2]int{spans[p][0] - from + len(prefix), spans[p][1] - from + len(prefix)})
+	}
+	return snippet
+}
@@ -0,0 +1,56 @@
+package searcher
+
+import (
+	"container/heap"
+
+	"wfts/internal/model"
+)
+
+type rankedDoc struct {
+	doc 	*model.Document
+	rank 	requestRanking
+}
+
+func better(a, b rankedDoc) bool {
+	if a.rank.score != b.rank.score {
+		return a.rank.score > b.rank.score
+	}
+	return a.doc.URL < b.doc.URL // стабильный порядок между страницами выдачи
+}
+
+type topHeap []rankedDoc // на вершине худший из отобранных
+
+func (h topHeap) Len() int { return len(h) }
+func (h topHeap) Less(i, j int) bool { return better(h[j], h[i]) }
+func (h topHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *topHeap) Push(x any) { *h = append(*h, x.(rankedDoc)) }
+func (h *topHeap) Pop() any {
+	old := *h
+	x := old[len(old) - 1]
+	*h = old[:len(old) - 1]
+	return x
+}
+
+func topK(docs []*model.Document, rank map[[32]byte]requestRanking, k int) []*model.Document {
+	if k <= 0 {
+		return nil
+	}
+	h := make(topHeap, 0, min(k, len(docs)))
+	for _, doc := range docs {
+		d := rankedDoc{doc: doc, rank: rank[doc.Id]}
+		if h.Len() < k {
+			heap.Push(&h, d)
+			continue
+		}
+		if better(d, h[0]) {
+			h[0] = d
+			heap.Fix(&h, 0)
+		}
+	}
+
+	out := make([]*model.Document, h.Len())
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = heap.Pop(&h).(rankedDoc).doc
+	}
+	return out
+}
@@ -0,0 +1,48 @@
+package ltr
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type Judgements map[string]map[string]int // запрос -> url -> оценка релевантности
+
+func (j Judgements) Queries() []string {
+	out := make([]string, 0, len(j))
+	for q := range j {
+		out = append(out, q)
+	}
+	return out
+}
+
+func (j Judgements) Grade(query, url string) int {
+	return j[query][url]
+}
+
+func ReadJudgements(r io.Reader) (Judgements, error) { // строки вида: query<TAB>url<TAB>grade
+	j := Judgements{}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Split(line, "\t")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("line %d: expected query, url and grade separated by tabs", n)
+		}
+		grade, err := strconv.Atoi(strings.TrimSpace(parts[2]))
+		if err != nil || grade < 0 {
+			return nil, fmt.Errorf("line %d: invalid grade %q", n, parts[2])
+		}
+		query := strings.TrimSpace(parts[0])
+		if j[query] == nil {
+			j[query] = map[string]int{}
+		}
+		j[query][strings.TrimSpace(parts[1])] = grade
+	}
+	return j, sc.Err()
+}
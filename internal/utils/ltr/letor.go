@@ -0,0 +1,86 @@
+package ltr
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type Sample struct {
+	Label 		int
+	QID 		int
+	Features 	[]float64 // в формате SVMlight индексы фич начинаются с 1
+	Comment 	string
+}
+
+func WriteSample(w io.Writer, s Sample) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d qid:%d", s.Label, s.QID)
+	for i, f := range s.Features {
+		fmt.Fprintf(&sb, " %d:%s", i + 1, strconv.FormatFloat(f, 'g', -1, 64))
+	}
+	if s.Comment != "" {
+		sb.WriteString(" # " + strings.ReplaceAll(s.Comment, "\n", " "))
+	}
+	sb.WriteByte('\n')
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func ReadSamples(r io.Reader) ([]Sample, error) {
+	samples := []Sample{}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64 << 10), 1 << 20)
+	for n := 1; sc.Scan(); n++ {
+		line, comment, _ := strings.Cut(sc.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		s, err := parseSample(fields)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		s.Comment = strings.TrimSpace(comment)
+		samples = append(samples, s)
+	}
+	return samples, sc.Err()
+}
+
+func parseSample(fields []string) (Sample, error) {
+	var s Sample
+	label, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return s, errors.New("invalid label " + fields[0])
+	}
+	s.Label = label
+
+	for _, f := range fields[1:] {
+		key, val, ok := strings.Cut(f, ":")
+		if !ok {
+			return s, errors.New("invalid pair " + f)
+		}
+		if key == "qid" {
+			if s.QID, err = strconv.Atoi(val); err != nil {
+				return s, errors.New("invalid qid " + val)
+			}
+			continue
+		}
+		idx, err := strconv.Atoi(key)
+		if err != nil || idx < 1 {
+			return s, errors.New("invalid feature index " + key)
+		}
+		v, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return s, errors.New("invalid feature value " + val)
+		}
+		for len(s.Features) < idx { // пропущенные фичи в разреженной записи равны нулю
+			s.Features = append(s.Features, 0)
+		}
+		s.Features[idx - 1] = v
+	}
+	return s, nil
+}
@@ -0,0 +1,107 @@
+package ltr
+
+import (
+	"bytes"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLETORRoundTrip(t *testing.T) {
+	samples := []Sample{
+		{Label: 2, QID: 1, Features: []float64{0.5, 0, 3}, Comment: "query=go url=https://go.dev"},
+		{Label: 0, QID: 1, Features: []float64{1e-9, 7, 0}},
+	}
+	var buf bytes.Buffer
+	for _, s := range samples {
+		if err := WriteSample(&buf, s); err != nil {
+			t.Fatalf("WriteSample(): %v", err)
+		}
+	}
+	if first := strings.SplitN(buf.String(), "\n", 2)[0]; first != "2 qid:1 1:0.5 2:0 3:3 # query=go url=https://go.dev" {
+		t.Errorf("unexpected line %q", first)
+	}
+
+	got, err := ReadSamples(&buf)
+	if err != nil {
+		t.Fatalf("ReadSamples(): %v", err)
+	}
+	if !reflect.DeepEqual(got, samples) {
+		t.Errorf("ReadSamples() = %+v, want %+v", got, samples)
+	}
+}
+
+func TestReadSamplesErrors(t *testing.T) {
+	tests := []string{
+		"x qid:1 1:0.5",
+		"1 qid:a 1:0.5",
+		"1 qid:1 0:0.5",
+		"1 qid:1 1:abc",
+		"1 qid:1 1",
+	}
+	for _, line := range tests {
+		if _, err := ReadSamples(strings.NewReader(line)); err == nil {
+			t.Errorf("ReadSamples(%q): expected error", line)
+		}
+	}
+
+	got, err := ReadSamples(strings.NewReader("1 qid:3 3:1\n\n# comment only\n"))
+	if err != nil || len(got) != 1 || !reflect.DeepEqual(got[0].Features, []float64{0, 0, 1}) {
+		t.Errorf("sparse sample = %+v, %v", got, err)
+	}
+}
+
+func TestReadJudgements(t *testing.T) {
+	j, err := ReadJudgements(strings.NewReader("# query\turl\tgrade\ngo tour\thttps://go.dev/tour\t3\ngo tour\thttps://go.dev\t1\n"))
+	if err != nil {
+		t.Fatalf("ReadJudgements(): %v", err)
+	}
+	if j.Grade("go tour", "https://go.dev/tour") != 3 || j.Grade("go tour", "https://example.com") != 0 || len(j.Queries()) != 1 {
+		t.Errorf("ReadJudgements() = %v", j)
+	}
+	if _, err := ReadJudgements(strings.NewReader("go tour\thttps://go.dev\n")); err == nil {
+		t.Errorf("expected error on missing grade")
+	}
+}
+
+func TestTrain(t *testing.T) {
+	// релевантность определяется второй фичей, первая шумовая, третья константная
+	samples := []Sample{}
+	for q := range 5 {
+		for d := range 6 {
+			samples = append(samples, Sample{
+				Label: 		d / 2,
+				QID: 		q,
+				Features: 	[]float64{float64((q * 7 + d * 3) % 5), float64(d) + 0.1 * float64(q), 1},
+			})
+		}
+	}
+	m, err := Train(samples, []string{"noise", "signal", "const"}, DefaultTrainOptions())
+	if err != nil {
+		t.Fatalf("Train(): %v", err)
+	}
+	if m.Weights[1] <= 0 || m.Weights[1] < 2 * math.Abs(m.Weights[0]) {
+		t.Errorf("expected signal feature to dominate, weights %v", m.Weights)
+	}
+	if m.Score([]float64{0, 5, 1}) <= m.Score([]float64{0, 1, 1}) {
+		t.Errorf("model does not prefer higher signal")
+	}
+
+	path := filepath.Join(t.TempDir(), "model.json")
+	if err := m.Save(path); err != nil {
+		t.Fatalf("Save(): %v", err)
+	}
+	loaded, err := LoadModel(path)
+	if err != nil {
+		t.Fatalf("LoadModel(): %v", err)
+	}
+	if !reflect.DeepEqual(loaded, m) || !loaded.Compatible([]string{"noise", "signal", "const"}) {
+		t.Errorf("LoadModel() = %+v, want %+v", loaded, m)
+	}
+
+	if _, err := Train([]Sample{{Label: 1, QID: 1, Features: []float64{1}}}, []string{"f"}, DefaultTrainOptions()); err == nil {
+		t.Errorf("expected error without pairs")
+	}
+}
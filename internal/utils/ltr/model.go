@@ -0,0 +1,60 @@
+package ltr
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+)
+
+type Model struct {
+	Features 	[]string 	`json:"features"`
+	Mean 		[]float64 	`json:"mean"`
+	Scale 		[]float64 	`json:"scale"`
+	Weights 	[]float64 	`json:"weights"`
+}
+
+func (m *Model) Score(x []float64) float64 {
+	score := 0.0
+	for i, w := range m.Weights {
+		v := 0.0
+		if i < len(x) {
+			v = x[i]
+		}
+		score += w * (v - m.Mean[i]) / m.Scale[i]
+	}
+	return score
+}
+
+func (m *Model) Compatible(features []string) bool {
+	return slices.Equal(m.Features, features)
+}
+
+func (m *Model) Save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func LoadModel(path string) (*Model, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Model
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	n := len(m.Features)
+	if len(m.Weights) != n || len(m.Mean) != n || len(m.Scale) != n {
+		return nil, errors.New("model dimensions do not match feature list")
+	}
+	for _, s := range m.Scale {
+		if s == 0 {
+			return nil, errors.New("model has zero feature scale")
+		}
+	}
+	return &m, nil
+}
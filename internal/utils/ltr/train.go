@@ -0,0 +1,103 @@
+package ltr
+
+import (
+	"errors"
+	"math"
+)
+
+type TrainOptions struct {
+	Epochs 			int
+	LearningRate 	float64
+	L2 				float64
+}
+
+func DefaultTrainOptions() TrainOptions {
+	return TrainOptions{Epochs: 300, LearningRate: 0.1, L2: 1e-3}
+}
+
+type pair struct {
+	better, worse int
+}
+
+func Train(samples []Sample, features []string, opts TrainOptions) (*Model, error) { // попарная логистическая регрессия (линейный RankNet)
+	dims := len(features)
+	if dims == 0 {
+		return nil, errors.New("empty feature list")
+	}
+	m := &Model{
+		Features: 	features,
+		Mean: 		make([]float64, dims),
+		Scale: 		make([]float64, dims),
+		Weights: 	make([]float64, dims),
+	}
+
+	x := make([][]float64, len(samples))
+	for i, s := range samples {
+		x[i] = make([]float64, dims)
+		copy(x[i], s.Features)
+		for d := range dims {
+			m.Mean[d] += x[i][d]
+		}
+	}
+	for d := range dims {
+		m.Mean[d] /= float64(max(len(samples), 1))
+		for i := range x {
+			m.Scale[d] += (x[i][d] - m.Mean[d]) * (x[i][d] - m.Mean[d])
+		}
+		m.Scale[d] = math.Sqrt(m.Scale[d] / float64(max(len(samples), 1)))
+		if m.Scale[d] == 0 {
+			m.Scale[d] = 1 // константная фича ни на что не влияет
+		}
+		for i := range x {
+			x[i][d] = (x[i][d] - m.Mean[d]) / m.Scale[d]
+		}
+	}
+
+	pairs := makePairs(samples)
+	if len(pairs) == 0 {
+		return nil, errors.New("no pairs with different labels inside one query")
+	}
+
+	grad := make([]float64, dims)
+	for range opts.Epochs {
+		clear(grad)
+		for _, p := range pairs {
+			diff := 0.0
+			for d := range dims {
+				diff += m.Weights[d] * (x[p.better][d] - x[p.worse][d])
+			}
+			g := -1 / (1 + math.Exp(diff)) // производная log(1 + e^-diff)
+			for d := range dims {
+				grad[d] += g * (x[p.better][d] - x[p.worse][d])
+			}
+		}
+		for d := range dims {
+			m.Weights[d] -= opts.LearningRate * (grad[d] / float64(len(pairs)) + opts.L2 * m.Weights[d])
+		}
+	}
+	return m, nil
+}
+
+func makePairs(samples []Sample) []pair {
+	byQuery := map[int][]int{}
+	order := []int{}
+	for i, s := range samples {
+		if _, ex := byQuery[s.QID]; !ex {
+			order = append(order, s.QID)
+		}
+		byQuery[s.QID] = append(byQuery[s.QID], i)
+	}
+
+	pairs := []pair{}
+	for _, qid := range order {
+		group := byQuery[qid]
+		for _, i := range group {
+			for _, j := range group {
+				if samples[i].Label > samples[j].Label {
+					pairs = append(pairs, pair{better: i, worse: j})
+				}
+			}
+		}
+	}
+	return pairs
+}
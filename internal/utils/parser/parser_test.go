@@ -0,0 +1,153 @@
+package parser
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+const robotsFixture = `# comment line
+User-agent: FooBot
+User-agent: barbot/2.0
+Disallow: /private
+Allow: /private/open   # trailing comment
+Crawl-delay: 1.5
+
+user-agent: *
+disallow:/*.php$
+Disallow: /search?q=*&
+Disallow: /fish*
+Allow: /fish/salmon
+Disallow: /ünïcode
+Disallow: /%7Euser/
+Allow: /page
+Disallow: /*.html
+Disallow: /tie
+Allow: /tie
+Disallow:
+
+Sitemap: https://example.org/sitemap.xml
+
+User-agent: FooBot
+Disallow: /merged
+
+User-agent: emptybot
+Allow: /
+`
+
+func TestRobotsConformance(t *testing.T) {
+	robots := ParseRobotsTxt(robotsFixture)
+	tests := []struct {
+		name 		string
+		agent 		string
+		path 		string
+		allowed 	bool
+	}{
+		{"grouped agents share rules", "FooBot", "/private/x", false},
+		{"second agent of the group", "BarBot/2.0 (+https://bar.example)", "/private/x", false},
+		{"longer allow wins", "foobot", "/private/open/doc", true},
+		{"merged group of the same agent", "FooBot", "/merged/page", false},
+		{"specific group replaces star", "FooBot", "/fish", true},
+		{"robots.txt is always allowed", "FooBot", "/robots.txt", true},
+		{"unknown agent falls back to star", "OtherBot", "/fish", false},
+		{"star matches any suffix", "OtherBot", "/fishheads/yummy", false},
+		{"longer allow beats wildcard", "OtherBot", "/fish/salmon", true},
+		{"dollar anchors the end", "OtherBot", "/index.php", false},
+		{"dollar does not match longer path", "OtherBot", "/index.php?x=1", true},
+		{"wildcard in the middle", "OtherBot", "/dir/a.php", false},
+		{"query is matched", "OtherBot", "/search?q=go&lang=en", false},
+		{"query without the pattern tail", "OtherBot", "/search?q=go", true},
+		{"longer disallow beats shorter allow", "OtherBot", "/page.html", false},
+		{"tie between allow and disallow goes to allow", "OtherBot", "/tie", true},
+		{"plain prefix allow", "OtherBot", "/page/", true},
+		{"non ascii is compared percent-encoded", "OtherBot", "/%C3%BCn%C3%AFcode/x", false},
+		{"unreserved escapes are decoded", "OtherBot", "/~user/home", false},
+		{"empty disallow allows", "OtherBot", "/", true},
+		{"empty path is root", "OtherBot", "", true},
+		{"allow all group", "EmptyBot", "/fish", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := robots.IsAllowed(tt.agent, tt.path); got != tt.allowed {
+				t.Errorf("IsAllowed(%q, %q) = %t, want %t", tt.agent, tt.path, got, tt.allowed)
+			}
+		})
+	}
+
+	if want := []string{"https://example.org/sitemap.xml"}; !reflect.DeepEqual(robots.Sitemaps, want) {
+		t.Errorf("Sitemaps = %q, want %q", robots.Sitemaps, want)
+	}
+	if d := robots.CrawlDelay("barbot"); d != 2 {
+		t.Errorf("CrawlDelay(barbot) = %d, want 2", d)
+	}
+	if d := robots.CrawlDelay("otherbot"); d != 0 {
+		t.Errorf("CrawlDelay(otherbot) = %d, want 0", d)
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern, path 	string
+		match 			bool
+	}{
+		{"/", "/anything", true},
+		{"/fish", "/fish.html", true},
+		{"/fish", "/Fish.asp", false},
+		{"/fish/", "/fish", false},
+		{"/*.php", "/folder/filename.php?parameters", true},
+		{"/*.php$", "/filename.php/", false},
+		{"/fish*.php", "/fishheads/catfish.php?parameters", true},
+		{"/fish*.php", "/Fish.PHP", false},
+		{"/a*b*c$", "/aXbYbZc", true},
+		{"/a*b*c$", "/aXbYc/d", false},
+		{"*", "/", true},
+		{"/$", "/", true},
+		{"/$", "/page", false},
+	}
+	for _, tt := range tests {
+		if got := matchPattern(tt.pattern, tt.path); got != tt.match {
+			t.Errorf("matchPattern(%q, %q) = %t, want %t", tt.pattern, tt.path, got, tt.match)
+		}
+	}
+}
+
+func TestFetchRobotsTxt(t *testing.T) {
+	status := http.StatusOK
+	var agent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agent = r.Header.Get("User-Agent")
+		w.WriteHeader(status)
+		w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		status 		int
+		wantErr 	bool
+		allowed 	bool // для /private
+	}{
+		{http.StatusOK, false, false},
+		{http.StatusNotFound, false, true},
+		{http.StatusForbidden, false, true},
+		{http.StatusTooManyRequests, true, false},
+		{http.StatusServiceUnavailable, true, false},
+	}
+	for _, tt := range tests {
+		status = tt.status
+		robots, err := FetchRobotsTxt(context.Background(), srv.URL, "wfts/1.0", srv.Client())
+		if (err != nil) != tt.wantErr {
+			t.Errorf("status %d: error = %v, wantErr %t", tt.status, err, tt.wantErr)
+		}
+		if got := robots.IsAllowed("wfts", "/private"); got != tt.allowed {
+			t.Errorf("status %d: IsAllowed(/private) = %t, want %t", tt.status, got, tt.allowed)
+		}
+		if tt.status == http.StatusServiceUnavailable && robots.IsAllowed("wfts", "/") {
+			t.Errorf("status %d: unreachable robots.txt must disallow everything", tt.status)
+		}
+	}
+	if agent != "wfts/1.0" {
+		t.Errorf("User-Agent = %q", agent)
+	}
+}
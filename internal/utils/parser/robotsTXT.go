@@ -4,12 +4,15 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 )
 
+const maxRobotsSize = 500 << 10 // RFC 9309: разбирать нужно хотя бы первые 500 КиБ
+
 type Rule struct {
 	Allow    []string
 	Disallow []string
@@ -17,108 +20,238 @@ type Rule struct {
 }
 
 type RobotsTxt struct {
-	Rules map[string]Rule
+	Rules    map[string]Rule // ключ - product token в нижнем регистре или "*"
+	Sitemaps []string
+}
+
+type StatusError struct { // robots.txt недоступен: 429 или 5xx
+    Code       int
+    RetryAfter string
+}
+
+func (e *StatusError) Error() string {
+    return fmt.Sprintf("robots.txt unreachable: status code %d", e.Code)
+}
+
+func DisallowAll() *RobotsTxt { // robots.txt недоступен из за ошибки сервера, RFC 9309 2.3.1.4
+    return &RobotsTxt{Rules: map[string]Rule{"*": {Disallow: []string{"/"}}}}
 }
 
 func ParseRobotsTxt(content string) *RobotsTxt {
     robots := &RobotsTxt{Rules: make(map[string]Rule)}
-    var currentAgent string
-    var currentRule *Rule
+    var agents []string // агенты текущей группы, несколько user-agent подряд делят одни правила
+    inRules := false
 
+    content = strings.TrimPrefix(content, "\xef\xbb\xbf")
     lines := strings.SplitSeq(content, "\n")
     for line := range lines {
-        line = strings.TrimSpace(line)
-        if len(line) == 0 || strings.HasPrefix(line, "#") {
-            continue
+        if i := strings.IndexByte(line, '#'); i >= 0 {
+            line = line[:i]
         }
-
-        parts := strings.Fields(line)
-        if len(parts) < 2 {
+        key, value, ok := strings.Cut(line, ":")
+        if !ok {
             continue
         }
-
-        directive := strings.ToLower(parts[0])
-        value := parts[1]
+        directive := strings.ToLower(strings.TrimSpace(key))
+        value = strings.TrimSpace(value)
 
         switch directive {
-        case "user-agent:":
-            currentAgent = value
-            if _, ex := robots.Rules[currentAgent]; !ex {
-                currentRule = &Rule{Allow: []string{}, Disallow: []string{}}
+        case "user-agent":
+            if inRules { // user-agent после правил начинает новую группу
+                agents, inRules = nil, false
             }
-            robots.Rules[currentAgent] = *currentRule
-        case "allow:":
-            if currentRule != nil {
-                currentRule.Allow = append(currentRule.Allow, value)
+            agent := ProductToken(value)
+            if value == "*" {
+                agent = "*"
             }
-        case "disallow:":
-            if currentRule != nil {
-                currentRule.Disallow = append(currentRule.Disallow, value)
+            if agent == "" {
+                continue
             }
-        case "crawl-delay:":
-            if currentRule != nil {
-                currentRule.Delay, _ = strconv.Atoi(value)
+            agent = strings.ToLower(agent)
+            agents = append(agents, agent)
+            if _, ex := robots.Rules[agent]; !ex { // группы одного агента сливаются
+                robots.Rules[agent] = Rule{Allow: []string{}, Disallow: []string{}}
             }
+        case "allow", "disallow", "crawl-delay":
+            inRules = true
+            for _, agent := range agents {
+                rule := robots.Rules[agent]
+                switch {
+                case value == "": // пустой disallow ничего не запрещает
+                case directive == "allow":
+                    rule.Allow = append(rule.Allow, normalizeEscapes(value))
+                case directive == "disallow":
+                    rule.Disallow = append(rule.Disallow, normalizeEscapes(value))
+                default:
+                    if delay, err := strconv.ParseFloat(value, 64); err == nil && delay > 0 {
+                        rule.Delay = int(math.Ceil(delay))
+                    }
+                }
+                robots.Rules[agent] = rule
+            }
+        case "sitemap": // не относится к группам
+            robots.Sitemaps = append(robots.Sitemaps, value)
         }
     }
 
     return robots
 }
 
-func (r *RobotsTxt) IsAllowed(userAgent, url string) bool {
-    if rule, ok := r.Rules[userAgent]; ok {
-        for _, disallow := range rule.Disallow {
-            if strings.HasPrefix(url, disallow) {
-                return false
-            }
-        }
-        for _, allow := range rule.Allow {
-            if strings.HasPrefix(url, allow) {
-                return true
-            }
+func ProductToken(userAgent string) string { // "Googlebot/2.1 (+http://...)" -> "Googlebot", в токене только буквы, '_' и '-'
+    end := 0
+    for end < len(userAgent) {
+        c := userAgent[end]
+        if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == '-') {
+            break
         }
+        end++
+    }
+    return userAgent[:end]
+}
+
+func (r *RobotsTxt) group(userAgent string) (Rule, bool) {
+    if r == nil {
+        return Rule{}, false
+    }
+    if rule, ok := r.Rules[strings.ToLower(ProductToken(userAgent))]; ok {
+        return rule, true
+    }
+    rule, ok := r.Rules["*"]
+    return rule, ok
+}
+
+func (r *RobotsTxt) IsAllowed(userAgent, path string) bool { // path вместе с query, побеждает самое длинное совпавшее правило, при равенстве allow
+    rule, ok := r.group(userAgent)
+    if !ok {
+        return true
+    }
+    if path == "" {
+        path = "/"
+    }
+    if path == "/robots.txt" {
         return true
     }
+    path = normalizeEscapes(path)
 
-    if rule, ok := r.Rules["*"]; ok {
-        for _, disallow := range rule.Disallow {
-            if strings.HasPrefix(url, disallow) {
-                return false
-            }
+    allowed, best := true, -1
+    for _, disallow := range rule.Disallow {
+        if len(disallow) > best && matchPattern(disallow, path) {
+            allowed, best = false, len(disallow)
         }
-        for _, allow := range rule.Allow {
-            if strings.HasPrefix(url, allow) {
-                return true
+    }
+    for _, allow := range rule.Allow {
+        if len(allow) >= best && matchPattern(allow, path) {
+            allowed, best = true, len(allow)
+        }
+    }
+    return allowed
+}
+
+func (r *RobotsTxt) CrawlDelay(userAgent string) int {
+    rule, _ := r.group(userAgent)
+    return rule.Delay
+}
+
+func matchPattern(pattern, path string) bool { // '*' - любая последовательность, '$' в конце - конец пути
+    anchored := strings.HasSuffix(pattern, "$")
+    if anchored {
+        pattern = pattern[:len(pattern)-1]
+    }
+    parts := strings.Split(pattern, "*")
+    if !strings.HasPrefix(path, parts[0]) {
+        return false
+    }
+    rest := path[len(parts[0]):]
+    if len(parts) == 1 {
+        return !anchored || rest == ""
+    }
+    for _, part := range parts[1:len(parts)-1] { // самое левое вхождение оставляет больше всего места остальным частям
+        i := strings.Index(rest, part)
+        if i < 0 {
+            return false
+        }
+        rest = rest[i+len(part):]
+    }
+    last := parts[len(parts)-1]
+    if anchored {
+        return strings.HasSuffix(rest, last)
+    }
+    return strings.Contains(rest, last)
+}
+
+func normalizeEscapes(s string) string { // правила и пути сравниваются в одном виде: %7E -> ~, %2f -> %2F, не ascii -> %XX
+    const hex = "0123456789ABCDEF"
+    var b strings.Builder
+    for i := 0; i < len(s); i++ {
+        c := s[i]
+        if c == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+            decoded := unhex(s[i+1])<<4 | unhex(s[i+2])
+            i += 2
+            if isUnreserved(decoded) {
+                b.WriteByte(decoded)
+            } else {
+                b.WriteByte('%')
+                b.WriteByte(hex[decoded>>4])
+                b.WriteByte(hex[decoded&15])
             }
+            continue
         }
-        return true
+        if c >= 0x80 || c <= ' ' {
+            b.WriteByte('%')
+            b.WriteByte(hex[c>>4])
+            b.WriteByte(hex[c&15])
+            continue
+        }
+        b.WriteByte(c)
     }
+    return b.String()
+}
 
-    return true
+func isUnreserved(c byte) bool {
+    return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~'
 }
 
-func FetchRobotsTxt(ctx context.Context, url string, cli *http.Client) (string, error) {
+func isHex(c byte) bool {
+    return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+func unhex(c byte) byte {
+    switch {
+    case c >= 'a':
+        return c - 'a' + 10
+    case c >= 'A':
+        return c - 'A' + 10
+    }
+    return c - '0'
+}
+
+func FetchRobotsTxt(ctx context.Context, base, userAgent string, cli *http.Client) (*RobotsTxt, error) { // base - scheme://host, ошибка значит что сервер недоступен и обход запрещен
     c, cancel := context.WithTimeout(ctx, time.Second * 3)
     defer cancel()
-    req, err := http.NewRequestWithContext(c, "GET", url + "/robots.txt", nil)
+    req, err := http.NewRequestWithContext(c, "GET", base + "/robots.txt", nil)
     if err != nil {
-        return "", err
+        return DisallowAll(), err
     }
+    req.Header.Set("User-Agent", userAgent)
 
-    resp, err := cli.Do(req)
+    resp, err := cli.Do(req) // редиректы клиент проходит сам, до 10
     if err != nil {
-        return "", err
+        return DisallowAll(), err
     }
     defer resp.Body.Close()
 
-    if resp.StatusCode != http.StatusOK {
-        return "", fmt.Errorf("invalid status code: %s", resp.Status)
+    switch {
+    case resp.StatusCode >= 200 && resp.StatusCode < 300:
+    case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+        return DisallowAll(), &StatusError{Code: resp.StatusCode, RetryAfter: resp.Header.Get("Retry-After")}
+    default: // 4xx: файла нет, можно все
+        return &RobotsTxt{Rules: make(map[string]Rule)}, nil
     }
 
-    body, err := io.ReadAll(resp.Body)
+    body, err := io.ReadAll(io.LimitReader(resp.Body, maxRobotsSize))
     if err != nil {
-        return "", err
+        return DisallowAll(), err
     }
 
-    return string(body), nil
-}
\ No newline at end of file
+    return ParseRobotsTxt(string(body)), nil
+}
@@ -0,0 +1,99 @@
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+const maxRecordSize = 64 << 20
+
+type Record struct {
+	Header 		textproto.MIMEHeader
+	Block 		[]byte
+}
+
+func (r *Record) Type() string {
+	return r.Header.Get("WARC-Type")
+}
+
+func (r *Record) TargetURI() string { // в WARC/1.0 адрес иногда записан в угловых скобках
+	return strings.Trim(r.Header.Get("WARC-Target-URI"), "<>")
+}
+
+func (r *Record) HTTPResponse() (*http.Response, error) { // блок response записи - сырой HTTP ответ вместе со статусом и заголовками
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(r.Block)), nil)
+}
+
+type Reader struct {
+	br 		*bufio.Reader
+	tp 		*textproto.Reader
+	closer 	io.Closer
+}
+
+func NewReader(r io.Reader) (*Reader, error) { // .warc и .warc.gz, у сжатого файла каждая запись отдельный gzip member
+	br := bufio.NewReader(r)
+	wr := &Reader{}
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		wr.closer = zr
+		br = bufio.NewReader(zr)
+	}
+	wr.br = br
+	wr.tp = textproto.NewReader(br)
+	return wr, nil
+}
+
+func (wr *Reader) Next() (*Record, error) {
+	var version string
+	for { // между записями две пустые строки, а в конце файла бывают лишние
+		line, err := wr.tp.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			version = line
+			break
+		}
+	}
+	if !strings.HasPrefix(version, "WARC/") {
+		return nil, fmt.Errorf("bad warc record start: %.40q", version)
+	}
+
+	header, err := wr.tp.ReadMIMEHeader()
+	if err != nil && !(errors.Is(err, io.EOF) && len(header) != 0) {
+		return nil, err
+	}
+	size, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if err != nil || size < 0 {
+		return nil, fmt.Errorf("bad warc content length: %q", header.Get("Content-Length"))
+	}
+	if size > maxRecordSize {
+		if _, err := io.CopyN(io.Discard, wr.br, size); err != nil {
+			return nil, err
+		}
+		return &Record{Header: header}, nil // слишком большой блок пропускаем, заголовки все равно отдаем
+	}
+	block := make([]byte, size)
+	if _, err := io.ReadFull(wr.br, block); err != nil {
+		return nil, err
+	}
+	return &Record{Header: header, Block: block}, nil
+}
+
+func (wr *Reader) Close() error {
+	if wr.closer != nil {
+		return wr.closer.Close()
+	}
+	return nil
+}
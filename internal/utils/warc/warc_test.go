@@ -0,0 +1,158 @@
+package warc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func record(typ, uri, contentType, block string) string {
+	return fmt.Sprintf("WARC/1.0\r\nWARC-Type: %s\r\nWARC-Target-URI: %s\r\nContent-Type: %s\r\nContent-Length: %d\r\n\r\n%s\r\n\r\n",
+		typ, uri, contentType, len(block), block)
+}
+
+func TestReader(t *testing.T) {
+	response := "HTTP/1.1 200 OK\r\nContent-Type: text/html; charset=utf-8\r\nContent-Length: 12\r\n\r\n<p>hello</p>"
+	records := []string{
+		record("warcinfo", "", "application/warc-fields", "software: test\r\n"),
+		record("request", "https://go.dev/", "application/http; msgtype=request", "GET / HTTP/1.1\r\nHost: go.dev\r\n\r\n"),
+		record("response", "<https://go.dev/>", "application/http; msgtype=response", response),
+		record("resource", "https://go.dev/notes.md", "text/markdown", "# notes\n"),
+	}
+
+	plain := strings.Join(records, "")
+	var gz bytes.Buffer
+	for _, r := range records { // как у wget и heritrix: отдельный gzip member на запись
+		zw := gzip.NewWriter(&gz)
+		zw.Write([]byte(r))
+		zw.Close()
+	}
+
+	for name, data := range map[string][]byte{"plain": []byte(plain), "gzip": gz.Bytes()} {
+		t.Run(name, func(t *testing.T) {
+			wr, err := NewReader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("NewReader(): %v", err)
+			}
+			defer wr.Close()
+
+			types := []string{}
+			for {
+				rec, err := wr.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Next(): %v", err)
+				}
+				types = append(types, rec.Type())
+				switch rec.Type() {
+				case "response":
+					if rec.TargetURI() != "https://go.dev/" {
+						t.Errorf("TargetURI() = %q", rec.TargetURI())
+					}
+					resp, err := rec.HTTPResponse()
+					if err != nil {
+						t.Fatalf("HTTPResponse(): %v", err)
+					}
+					body, _ := io.ReadAll(resp.Body)
+					if resp.StatusCode != 200 || string(body) != "<p>hello</p>" || resp.Header.Get("Content-Type") != "text/html; charset=utf-8" {
+						t.Errorf("response = %d %q %q", resp.StatusCode, resp.Header, body)
+					}
+				case "resource":
+					if string(rec.Block) != "# notes\n" {
+						t.Errorf("resource block = %q", rec.Block)
+					}
+				}
+			}
+			if got := strings.Join(types, ","); got != "warcinfo,request,response,resource" {
+				t.Errorf("record types = %s", got)
+			}
+		})
+	}
+}
+
+func TestReaderRejectsGarbage(t *testing.T) {
+	for _, data := range []string{
+		"<html>not a warc</html>\n",
+		"WARC/1.0\r\nWARC-Type: response\r\nContent-Length: abc\r\n\r\n",
+		"WARC/1.0\r\nWARC-Type: response\r\nContent-Length: 100\r\n\r\nshort",
+	} {
+		wr, err := NewReader(strings.NewReader(data))
+		if err != nil {
+			t.Fatalf("NewReader(): %v", err)
+		}
+		if _, err := wr.Next(); err == nil || err == io.EOF {
+			t.Errorf("Next() on %.30q = %v, want an error", data, err)
+		}
+	}
+}
+
+func TestWriterRotation(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWriter(dir, "test", 1) // каждый ответ переполняет файл
+	if err != nil {
+		t.Fatalf("NewWriter(): %v", err)
+	}
+	pages := map[string]string{
+		"https://go.dev/": 		"<p>go</p>",
+		"https://go.dev/doc": 	"<p>docs\r\n\r\nwith blank lines</p>",
+	}
+	for _, u := range []string{"https://go.dev/", "https://go.dev/doc"} {
+		resp := &http.Response{
+			Status: 	"200 OK",
+			StatusCode: 200,
+			Header: 	http.Header{"Content-Type": {"text/html"}, "Transfer-Encoding": {"chunked"}, "Content-Length": {"9999"}},
+		}
+		if err := w.WriteResponse(u, resp, []byte(pages[u])); err != nil {
+			t.Fatalf("WriteResponse(%s): %v", u, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close(): %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "test-*.warc.gz"))
+	if len(files) != 2 {
+		t.Fatalf("files = %v, want one per record after rotation", files)
+	}
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wr, err := NewReader(f)
+		if err != nil {
+			t.Fatalf("NewReader(%s): %v", name, err)
+		}
+		info, err := wr.Next()
+		if err != nil || info.Type() != "warcinfo" || info.Header.Get("WARC-Filename") != filepath.Base(name) {
+			t.Errorf("%s: first record = %+v, %v; want warcinfo", name, info, err)
+		}
+		rec, err := wr.Next()
+		if err != nil {
+			t.Fatalf("%s: Next(): %v", name, err)
+		}
+		resp, err := rec.HTTPResponse()
+		if err != nil {
+			t.Fatalf("%s: HTTPResponse(): %v", name, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if string(body) != pages[rec.TargetURI()] || resp.StatusCode != 200 {
+			t.Errorf("%s: replayed %s = %d %q, want %q", name, rec.TargetURI(), resp.StatusCode, body, pages[rec.TargetURI()])
+		}
+		if !strings.HasPrefix(rec.Header.Get("WARC-Record-ID"), "<urn:uuid:") || !strings.HasPrefix(rec.Header.Get("WARC-Payload-Digest"), "sha1:") {
+			t.Errorf("%s: record header = %v", name, rec.Header)
+		}
+		if _, err := wr.Next(); err != io.EOF {
+			t.Errorf("%s: extra record after response: %v", name, err)
+		}
+		f.Close()
+	}
+}
@@ -0,0 +1,146 @@
+package warc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Writer struct {
+	dir 		string
+	prefix 		string
+	maxSize 	int64 // после записи, перевалившей за размер, открывается следующий файл
+	mu 			*sync.Mutex
+	f 			*os.File
+	size 		int64
+	seq 		int
+	started 	string
+}
+
+type field struct {
+	name, value string
+}
+
+func NewWriter(dir, prefix string, maxSize int64) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Writer{
+		dir: 		dir,
+		prefix: 	prefix,
+		maxSize: 	maxSize,
+		mu: 		new(sync.Mutex),
+		started: 	time.Now().UTC().Format("20060102150405"),
+	}, nil
+}
+
+func (w *Writer) WriteResponse(targetURI string, resp *http.Response, body []byte) error { // заголовки как их отдал http.Client, тело уже без сжатия и chunked
+	header := resp.Header.Clone()
+	header.Del("Transfer-Encoding")
+	header.Del("Content-Encoding")
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	var block bytes.Buffer
+	fmt.Fprintf(&block, "HTTP/1.1 %s\r\n", resp.Status) // h2 ответы пишутся как HTTP/1.1, иначе их не прочитают другие инструменты
+	header.Write(&block)
+	block.WriteString("\r\n")
+	block.Write(body)
+
+	return w.write([]field{
+		{"WARC-Type", "response"},
+		{"WARC-Target-URI", targetURI},
+		{"WARC-Payload-Digest", digest(body)},
+		{"Content-Type", "application/http; msgtype=response"},
+	}, block.Bytes())
+}
+
+func (w *Writer) write(fields []field, block []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+	if err := w.append(fields, block); err != nil {
+		return err
+	}
+	if w.maxSize > 0 && w.size >= w.maxSize {
+		err := w.f.Close()
+		w.f = nil
+		return err
+	}
+	return nil
+}
+
+func (w *Writer) open() error {
+	w.seq++
+	name := fmt.Sprintf("%s-%s-%05d.warc.gz", w.prefix, w.started, w.seq) // имена сортируются в порядке записи
+	f, err := os.OpenFile(filepath.Join(w.dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	w.f, w.size = f, 0
+	return w.append([]field{
+		{"WARC-Type", "warcinfo"},
+		{"WARC-Filename", name},
+		{"Content-Type", "application/warc-fields"},
+	}, []byte("software: wfts\r\nformat: WARC File Format 1.1\r\n"))
+}
+
+func (w *Writer) append(fields []field, block []byte) error { // каждая запись - отдельный gzip member, так файл можно читать с любой записи
+	var rec bytes.Buffer
+	rec.WriteString("WARC/1.1\r\n")
+	fields = append([]field{{"WARC-Record-ID", recordID()}, {"WARC-Date", time.Now().UTC().Format(time.RFC3339)}}, fields...)
+	fields = append(fields, field{"WARC-Block-Digest", digest(block)}, field{"Content-Length", strconv.Itoa(len(block))})
+	for _, f := range fields {
+		fmt.Fprintf(&rec, "%s: %s\r\n", f.name, f.value)
+	}
+	rec.WriteString("\r\n")
+	rec.Write(block)
+	rec.WriteString("\r\n\r\n")
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	if _, err := zw.Write(rec.Bytes()); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	n, err := w.f.Write(gz.Bytes())
+	w.size += int64(n)
+	return err
+}
+
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Close()
+	w.f = nil
+	return err
+}
+
+func recordID() string {
+	var u [16]byte
+	rand.Read(u[:])
+	u[6] = u[6] & 0x0f | 0x40 // uuid v4
+	u[8] = u[8] & 0x3f | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+}
+
+func digest(data []byte) string {
+	sum := sha1.Sum(data)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
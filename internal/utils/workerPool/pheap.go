@@ -11,6 +11,9 @@ func (cs CrawlStream) Less(i, j int) bool {
 	if cs[i].Depth != cs[j].Depth {
         return cs[i].Depth < cs[j].Depth
     }
+	if cs[i].Priority != cs[j].Priority {
+		return cs[i].Priority > cs[j].Priority
+	}
     return cs[i].SameDomain && !cs[j].SameDomain
 }
 
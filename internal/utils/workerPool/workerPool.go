@@ -17,6 +17,8 @@ type WorkerPool struct {
 	mu 			*sync.Mutex
 	ctx 		context.Context
 	workers   	int32
+	running 	map[uint64]model.CrawlNode // выполняются сейчас, в том числе синхронно при полном буфере
+	nextID 		uint64
 }
 
 func NewWorkerPool(size int, queueCapacity int, c context.Context) *WorkerPool {
@@ -29,6 +31,7 @@ func NewWorkerPool(size int, queueCapacity int, c context.Context) *WorkerPool {
 		wg:        	new(sync.WaitGroup),
 		mu:			new(sync.Mutex),
 		ctx: 		c,
+		running: 	make(map[uint64]model.CrawlNode),
 	}
 	for range size {
 		go wp.worker()
@@ -41,15 +44,26 @@ func (wp *WorkerPool) Submit(task model.CrawlNode) {
 	//wp.log.Write(logger.NewMessage(logger.WORKER_POOL_LAYER, logger.DEBUG, "Submitting task. Buffer: %d, Workers: %d", len(wp.buf), wp.workers))
 
 	orig := task.Activation
+	data := task
+	data.Activation = nil
+	id := atomic.AddUint64(&wp.nextID, 1)
 	task.Activation = func() {
 		defer wp.wg.Done()
+		wp.mu.Lock()
+		wp.running[id] = data
+		wp.mu.Unlock()
+		defer func() {
+			wp.mu.Lock()
+			delete(wp.running, id)
+			wp.mu.Unlock()
+		}()
 		orig()
 	}
 
 	wp.mu.Lock()
 	select{
 	case wp.buf <- struct{}{}:
-		wp.crawlHeap.Push(task)
+		heap.Push(&wp.crawlHeap, task) // через container/heap, иначе очередь работает как стек и глубина не учитывается
 		wp.mu.Unlock()
 	default:
 		wp.mu.Unlock()
@@ -67,7 +81,11 @@ func (wp *WorkerPool) worker() {
 				return
 			}
 			wp.mu.Lock()
-			if f := wp.crawlHeap.Pop().(model.CrawlNode); f.Activation != nil {
+			if wp.crawlHeap.Len() == 0 {
+				wp.mu.Unlock()
+				continue
+			}
+			if f := heap.Pop(&wp.crawlHeap).(model.CrawlNode); f.Activation != nil {
 				wp.mu.Unlock()
 				f.Activation()
 				continue
@@ -79,6 +97,20 @@ func (wp *WorkerPool) worker() {
 	}
 }
 
+func (wp *WorkerPool) Frontier() []model.CrawlNode { // снимок очереди и выполняющихся задач без замыканий, для сохранения между запусками
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	nodes := make([]model.CrawlNode, 0, len(wp.crawlHeap) + len(wp.running))
+	for _, node := range wp.running {
+		nodes = append(nodes, node)
+	}
+	for _, node := range wp.crawlHeap {
+		node.Activation = nil
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
 func (wp *WorkerPool) Wait() {
 	wp.wg.Wait()
 }
@@ -0,0 +1,68 @@
+package workerPool
+
+import (
+	"container/heap"
+	"context"
+	"slices"
+	"testing"
+
+	"wfts/internal/model"
+)
+
+func TestCrawlStreamOrder(t *testing.T) {
+	cs := CrawlStream{}
+	for _, n := range []model.CrawlNode{
+		{Depth: 2, SameDomain: true},
+		{Depth: 0, SameDomain: false},
+		{Depth: 1, SameDomain: false},
+		{Depth: 0, SameDomain: true},
+		{Depth: 1, SameDomain: true},
+	} {
+		heap.Push(&cs, n)
+	}
+
+	expected := []model.CrawlNode{
+		{Depth: 0, SameDomain: true},
+		{Depth: 0, SameDomain: false},
+		{Depth: 1, SameDomain: true},
+		{Depth: 1, SameDomain: false},
+		{Depth: 2, SameDomain: true},
+	}
+	for i, want := range expected {
+		got := heap.Pop(&cs).(model.CrawlNode)
+		if got.Depth != want.Depth || got.SameDomain != want.SameDomain {
+			t.Errorf("pop %d = depth %d same %t, want depth %d same %t", i, got.Depth, got.SameDomain, want.Depth, want.SameDomain)
+		}
+	}
+}
+
+func TestFrontierSnapshot(t *testing.T) {
+	wp := NewWorkerPool(1, 10, context.Background())
+	started, release := make(chan struct{}), make(chan struct{})
+	wp.Submit(model.CrawlNode{URL: "https://a.example/", Activation: func() {
+		close(started)
+		<-release
+	}})
+	<-started
+	wp.Submit(model.CrawlNode{URL: "https://b.example/", Depth: 1, Activation: func() {}})
+	wp.Submit(model.CrawlNode{URL: "https://c.example/", Depth: 2, Priority: 1, Activation: func() {}})
+
+	urls := []string{}
+	for _, node := range wp.Frontier() {
+		if node.Activation != nil {
+			t.Errorf("snapshot node %s keeps its closure", node.URL)
+		}
+		urls = append(urls, node.URL)
+	}
+	slices.Sort(urls)
+	if want := []string{"https://a.example/", "https://b.example/", "https://c.example/"}; !slices.Equal(urls, want) {
+		t.Errorf("Frontier() = %v, want running and queued %v", urls, want)
+	}
+
+	close(release)
+	wp.Wait()
+	if left := wp.Frontier(); len(left) != 0 {
+		t.Errorf("Frontier() after Wait = %+v, want empty", left)
+	}
+	wp.Stop()
+}